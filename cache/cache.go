@@ -0,0 +1,58 @@
+// Package cache provides caching for Prediction Guard API calls with
+// pluggable storage.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store represents the storage behind a cache. Get reports false for keys
+// that don't exist or have expired. A zero ttl means the value doesn't
+// expire. Implementations must be safe for concurrent use.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Compile time checks that the stores implement Store.
+var (
+	_ Store = (*Memory)(nil)
+	_ Store = (*Disk)(nil)
+)
+
+// Stats represents the activity of a cache or store. Entries and Bytes are
+// only reported by stores.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Errors    uint64
+	Entries   int
+	Bytes     int64
+}
+
+// HitRate returns the fraction of lookups that were hits.
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// =============================================================================
+
+// expired reports whether a value with the specified expiry has expired. A
+// zero expiry never expires.
+func expired(expires time.Time, now time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+func expiry(ttl time.Duration, now time.Time) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
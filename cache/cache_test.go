@@ -0,0 +1,523 @@
+package cache_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/cache"
+)
+
+func Test_Memory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("lru", func(t *testing.T) {
+		m := cache.NewMemory(cache.MemoryConfig{MaxEntries: 2})
+
+		m.Set(ctx, "a", []byte("1"), 0)
+		m.Set(ctx, "b", []byte("2"), 0)
+		m.Get(ctx, "a")
+		m.Set(ctx, "c", []byte("3"), 0)
+
+		if _, ok, _ := m.Get(ctx, "b"); ok {
+			t.Fatalf("Should evict the least recently used key")
+		}
+
+		if v, ok, _ := m.Get(ctx, "a"); !ok || string(v) != "1" {
+			t.Fatalf("Should keep the recently used key, got %q %v", v, ok)
+		}
+
+		stats := m.Stats()
+		if stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 2 || stats.Misses != 1 {
+			t.Fatalf("Should get the expected stats, got %+v", stats)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		m := cache.NewMemory(cache.MemoryConfig{MaxBytes: 10})
+
+		for i := range 5 {
+			m.Set(ctx, fmt.Sprint(i), []byte("1234"), 0)
+		}
+
+		if stats := m.Stats(); stats.Bytes > 10 || stats.Entries != 2 {
+			t.Fatalf("Should stay within the byte bound, got %+v", stats)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		m := cache.NewMemory(cache.MemoryConfig{})
+
+		m.Set(ctx, "a", []byte("1"), time.Millisecond)
+		m.Set(ctx, "b", []byte("2"), 0)
+		time.Sleep(5 * time.Millisecond)
+
+		if _, ok, _ := m.Get(ctx, "a"); ok {
+			t.Fatalf("Should expire the value")
+		}
+
+		if _, ok, _ := m.Get(ctx, "b"); !ok {
+			t.Fatalf("Should keep the value without a ttl")
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		m := cache.NewMemory(cache.MemoryConfig{})
+
+		buf := []byte("1")
+		m.Set(ctx, "a", buf, 0)
+		buf[0] = '3'
+
+		v, _, _ := m.Get(ctx, "a")
+		v[0] = '2'
+
+		if v, _, _ := m.Get(ctx, "a"); string(v) != "1" {
+			t.Fatalf("Should not share the stored value, got %q", v)
+		}
+	})
+}
+
+func Test_Disk(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	d, err := cache.NewDisk(dir, cache.DiskConfig{})
+	if err != nil {
+		t.Fatalf("Should be able to open the store: %s", err)
+	}
+
+	d.Set(ctx, "a", []byte("hello"), 0)
+	d.Set(ctx, "b", []byte("bye"), time.Millisecond)
+	d.Set(ctx, "c/../x", []byte("odd key"), 0)
+
+	t.Run("reopen", func(t *testing.T) {
+		d, err := cache.NewDisk(dir, cache.DiskConfig{})
+		if err != nil {
+			t.Fatalf("Should be able to reopen the store: %s", err)
+		}
+
+		if v, ok, err := d.Get(ctx, "a"); err != nil || !ok || string(v) != "hello" {
+			t.Fatalf("Should get the value written before, got %q %v %v", v, ok, err)
+		}
+
+		if v, ok, _ := d.Get(ctx, "c/../x"); !ok || string(v) != "odd key" {
+			t.Fatalf("Should store keys that aren't valid file names, got %q %v", v, ok)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		time.Sleep(5 * time.Millisecond)
+
+		if _, ok, _ := d.Get(ctx, "b"); ok {
+			t.Fatalf("Should expire the value")
+		}
+
+		d.Set(ctx, "e", []byte("soon"), time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		if n, err := d.Prune(); err != nil || n != 1 {
+			t.Fatalf("Should prune the expired value, got %d %v", n, err)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		d, err := cache.NewDisk(t.TempDir(), cache.DiskConfig{MaxBytes: 100})
+		if err != nil {
+			t.Fatalf("Should be able to open the store: %s", err)
+		}
+
+		for i := range 10 {
+			d.Set(ctx, fmt.Sprint(i), make([]byte, 22), 0)
+
+			// Keep the first key recently used.
+			d.Get(ctx, "0")
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		stats := d.Stats()
+		if stats.Bytes > 100 || stats.Evictions == 0 {
+			t.Fatalf("Should stay within the byte bound, got %+v", stats)
+		}
+
+		if _, ok, _ := d.Get(ctx, "0"); !ok {
+			t.Fatalf("Should keep the recently used key")
+		}
+
+		if _, ok, _ := d.Get(ctx, "1"); ok {
+			t.Fatalf("Should evict the least recently used key")
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		d, err := cache.NewDisk(t.TempDir(), cache.DiskConfig{})
+		if err != nil {
+			t.Fatalf("Should be able to open the store: %s", err)
+		}
+
+		d.Set(ctx, "a", []byte("12"), 0)
+		d.Set(ctx, "b", []byte("1234"), 0)
+		d.Set(ctx, "b", []byte("123"), 0)
+		d.Delete(ctx, "a")
+
+		// Each file holds an 8 byte expiry ahead of the value.
+		if stats := d.Stats(); stats.Entries != 1 || stats.Bytes != 11 {
+			t.Fatalf("Should keep the running totals, got %+v", stats)
+		}
+	})
+
+	t.Run("temp", func(t *testing.T) {
+		dir := t.TempDir()
+
+		d, err := cache.NewDisk(dir, cache.DiskConfig{})
+		if err != nil {
+			t.Fatalf("Should be able to open the store: %s", err)
+		}
+
+		// A directory in place of the value's file makes the rename fail.
+		sum := sha256.Sum256([]byte("a"))
+		name := hex.EncodeToString(sum[:])
+		os.MkdirAll(filepath.Join(dir, name[:2], name+".cache", "x"), 0o755)
+
+		if err := d.Set(ctx, "a", []byte("1"), 0); err == nil {
+			t.Fatalf("Should fail to write over a directory")
+		}
+
+		// A temporary file left by a writer that stopped.
+		stale := filepath.Join(dir, name[:2], ".tmp-1")
+		os.WriteFile(stale, []byte("1"), 0o644)
+		old := time.Now().Add(-2 * time.Hour)
+		os.Chtimes(stale, old, old)
+
+		if _, err := cache.NewDisk(dir, cache.DiskConfig{}); err != nil {
+			t.Fatalf("Should be able to reopen the store: %s", err)
+		}
+
+		var temps []string
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if strings.HasPrefix(entry.Name(), ".tmp-") {
+				temps = append(temps, path)
+			}
+			return nil
+		})
+
+		if len(temps) != 0 {
+			t.Fatalf("Should remove the temporary files, got %v", temps)
+		}
+	})
+}
+
+func Test_Embedder(t *testing.T) {
+	var sent atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []struct {
+				Text string `json:"text"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		sent.Add(int32(len(body.Input)))
+
+		resp := client.Embedding{Model: "multilingual-e5-large-instruct"}
+		for i, in := range body.Input {
+			resp.Data = append(resp.Data, client.EmbeddingData{
+				Index:     i,
+				Object:    "embedding",
+				Embedding: []float64{float64(len(in.Text)), float64(strings.Count(in.Text, "a"))},
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key")
+
+	store := cache.NewMemory(cache.MemoryConfig{})
+	model := "multilingual-e5-large-instruct"
+
+	input := func(texts ...string) []client.D {
+		ds := make([]client.D, len(texts))
+		for i, text := range texts {
+			ds[i] = client.D{"text": text}
+		}
+		return ds
+	}
+
+	e := cache.NewEmbedder(cln, srv.URL+"/embeddings", store, cache.EmbedderConfig{
+		Embed: client.EmbedConfig{Options: client.D{"truncate": true}},
+	})
+
+	ctx := context.Background()
+
+	got, err := e.Embed(ctx, model, input("banana", "apple", "banana"))
+	if err != nil {
+		t.Fatalf("Should be able to embed: %s", err)
+	}
+
+	if sent.Load() != 2 {
+		t.Fatalf("Should send each distinct input once, sent %d", sent.Load())
+	}
+
+	if got[0][0] != 6 || got[0][1] != 3 || got[1][0] != 5 || got[2][0] != 6 {
+		t.Fatalf("Should get the vectors in input order, got %v", got)
+	}
+
+	got, err = e.Embed(ctx, model, input("cherry", "apple", "banana"))
+	if err != nil {
+		t.Fatalf("Should be able to embed: %s", err)
+	}
+
+	if sent.Load() != 3 {
+		t.Fatalf("Should only send the miss, sent %d", sent.Load())
+	}
+
+	if got[0][0] != 6 || got[0][1] != 0 || got[1][0] != 5 || got[2][1] != 3 {
+		t.Fatalf("Should merge hits and misses in input order, got %v", got)
+	}
+
+	stats := e.Stats()
+	if stats.Hits != 2 || stats.Misses != 4 {
+		t.Fatalf("Should count hits and misses per input, got %+v", stats)
+	}
+
+	other := cache.NewEmbedder(cln, srv.URL+"/embeddings", store, cache.EmbedderConfig{
+		Embed: client.EmbedConfig{Options: client.D{"truncate": false}},
+	})
+
+	if _, err := other.Embed(ctx, model, input("apple")); err != nil {
+		t.Fatalf("Should be able to embed: %s", err)
+	}
+
+	if sent.Load() != 4 {
+		t.Fatalf("Should key the cache by the request options, sent %d", sent.Load())
+	}
+
+	if err := e.Invalidate(ctx, model, client.D{"text": "apple"}); err != nil {
+		t.Fatalf("Should be able to invalidate: %s", err)
+	}
+
+	if _, err := e.Embed(ctx, model, input("apple")); err != nil {
+		t.Fatalf("Should be able to embed: %s", err)
+	}
+
+	if sent.Load() != 5 {
+		t.Fatalf("Should send the invalidated input again, sent %d", sent.Load())
+	}
+}
+
+func Test_Transport(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tokenize", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		if fail.Load() {
+			http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprint(w, `{"id":"token-1","object":"tokens","created":1729871708,"model":"neural-chat-7b-v3-3","tokens":[{"id":1,"start":0,"stop":0,"text":"<s>"}]}`)
+	})
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1715628729,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tr := cache.NewTransport(cache.TransportConfig{})
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key", client.WithClient(&http.Client{Transport: tr}))
+
+	ctx := context.Background()
+
+	call := func(ctx context.Context, path string, d client.D) error {
+		var resp map[string]any
+		return cln.Do(ctx, http.MethodPost, srv.URL+path, d, &resp)
+	}
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		path  string
+		body  client.D
+		fail  bool
+		calls int32
+	}{
+		{"first", ctx, "/tokenize", client.D{"model": "neural-chat-7b-v3-3", "input": "hi"}, false, 1},
+		{"hit", ctx, "/tokenize", client.D{"input": "hi", "model": "neural-chat-7b-v3-3"}, false, 1},
+		{"other-input", ctx, "/tokenize", client.D{"model": "neural-chat-7b-v3-3", "input": "bye"}, false, 2},
+		{"bypass", cache.Bypass(ctx), "/tokenize", client.D{"model": "neural-chat-7b-v3-3", "input": "hi"}, false, 3},
+		{"error", ctx, "/tokenize", client.D{"model": "neural-chat-7b-v3-3", "input": "new"}, true, 4},
+		{"error-not-cached", ctx, "/tokenize", client.D{"model": "neural-chat-7b-v3-3", "input": "new"}, false, 5},
+		{"chat-zero", ctx, "/chat/completions", client.D{"model": "neural-chat-7b-v3-3", "messages": "hi", "temperature": 0}, false, 6},
+		{"chat-zero-hit", ctx, "/chat/completions", client.D{"model": "neural-chat-7b-v3-3", "messages": "hi", "temperature": 0.0}, false, 6},
+		{"chat-warm", ctx, "/chat/completions", client.D{"model": "neural-chat-7b-v3-3", "messages": "hi", "temperature": 0.7}, false, 7},
+		{"chat-warm-again", ctx, "/chat/completions", client.D{"model": "neural-chat-7b-v3-3", "messages": "hi", "temperature": 0.7}, false, 8},
+	}
+
+	for _, tt := range tests {
+		fail.Store(tt.fail)
+
+		err := call(tt.ctx, tt.path, tt.body)
+		if (err != nil) != tt.fail {
+			t.Fatalf("%s: Should get error %v, got %v", tt.name, tt.fail, err)
+		}
+
+		if calls.Load() != tt.calls {
+			t.Fatalf("%s: Should reach the service %d times, got %d", tt.name, tt.calls, calls.Load())
+		}
+	}
+
+	if stats := tr.Stats(); stats.Hits != 2 {
+		t.Fatalf("Should count the hits, got %+v", stats)
+	}
+}
+
+func Test_Semantic(t *testing.T) {
+	var chats atomic.Int32
+
+	vocab := []string{"reset", "password", "change", "email", "refund", "order", "my", "how"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []struct {
+				Text string `json:"text"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		resp := client.Embedding{Model: "multilingual-e5-large-instruct"}
+		for i, in := range body.Input {
+			vec := make([]float64, len(vocab)+1)
+			vec[len(vocab)] = 0.01
+			for _, word := range strings.Fields(strings.ToLower(in.Text)) {
+				for j, v := range vocab {
+					if strings.Trim(word, "?.,") == v {
+						vec[j]++
+					}
+				}
+			}
+
+			resp.Data = append(resp.Data, client.EmbeddingData{Index: i, Object: "embedding", Embedding: vec})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		n := chats.Add(1)
+		fmt.Fprintf(w, `{"id":"chat-%d","object":"chat.completion","created":1715628729,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"message":{"role":"assistant","content":"answer %d"}}]}`, n, n)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key")
+
+	s := cache.NewSemantic(cln, cache.SemanticConfig{
+		Host:           srv.URL,
+		EmbeddingModel: "multilingual-e5-large-instruct",
+		Threshold:      0.9,
+	})
+
+	ctx := context.Background()
+	model := "neural-chat-7b-v3-3"
+	system := "You are a support agent."
+
+	tests := []struct {
+		name   string
+		model  string
+		system string
+		prompt string
+		hit    bool
+		answer string
+	}{
+		{"first", model, system, "How do I reset my password?", false, "answer 1"},
+		{"paraphrase", model, system, "how to reset my password", true, "answer 1"},
+		{"different", model, system, "How do I get a refund for my order?", false, "answer 2"},
+		{"other-system", model, "You are a pirate.", "How do I reset my password?", false, "answer 3"},
+		{"other-model", "Hermes-3-Llama-3.1-8B", system, "How do I reset my password?", false, "answer 4"},
+		{"refund-paraphrase", model, system, "refund my order how?", true, "answer 2"},
+	}
+
+	for _, tt := range tests {
+		got, err := s.Chat(ctx, tt.model, tt.system, tt.prompt, client.D{"max_tokens": 100})
+		if err != nil {
+			t.Fatalf("%s: Should be able to chat: %s", tt.name, err)
+		}
+
+		if got.Hit != tt.hit || got.Chat.Choices[0].Message.Content != tt.answer {
+			t.Fatalf("%s: Should get hit %v with %q, got %v with %q", tt.name, tt.hit, tt.answer, got.Hit, got.Chat.Choices[0].Message.Content)
+		}
+
+		if got.Hit && got.Similarity < 0.9 {
+			t.Fatalf("%s: Should report the similarity of the match, got %v", tt.name, got.Similarity)
+		}
+	}
+
+	n, err := s.Invalidate(ctx, model, system, "how to reset my password")
+	if err != nil || n != 1 {
+		t.Fatalf("Should invalidate the matching answer, got %d %v", n, err)
+	}
+
+	got, err := s.Chat(ctx, model, system, "How do I reset my password?", nil)
+	if err != nil || got.Hit {
+		t.Fatalf("Should call the model after invalidating, got hit %v %v", got.Hit, err)
+	}
+
+	if n := s.InvalidateScope(model, system); n != 2 {
+		t.Fatalf("Should invalidate the scope, got %d", n)
+	}
+
+	if stats := s.Stats(); stats.Hits != 2 || stats.Misses != 5 || stats.Entries != 2 {
+		t.Fatalf("Should get the expected stats, got %+v", stats)
+	}
+}
+
+func Test_SemanticTTL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"index":0,"object":"embedding","embedding":[1,0]}]}`)
+	})
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"chat-1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	s := cache.NewSemantic(client.New(logger, "key"), cache.SemanticConfig{Host: srv.URL, TTL: time.Millisecond})
+
+	ctx := context.Background()
+
+	s.Chat(ctx, "m", "", "hello", nil)
+	time.Sleep(5 * time.Millisecond)
+
+	got, err := s.Chat(ctx, "m", "", "hello", nil)
+	if err != nil || got.Hit {
+		t.Fatalf("Should not serve an expired answer, got hit %v %v", got.Hit, err)
+	}
+}
@@ -0,0 +1,370 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskConfig defines the bounds of a Disk store.
+type DiskConfig struct {
+	// MaxBytes is the total size of the cached files. When a write takes
+	// the store past it, the least recently used files are removed until
+	// the store is back under 90% of it. Zero means no limit.
+	MaxBytes int64
+}
+
+// Disk is a store that keeps every value in its own file below a directory,
+// so the cache survives restarts and can be shared between processes.
+// Reading a value refreshes the file's modification time, which is used to
+// pick the least recently used files for eviction.
+type Disk struct {
+	dir     string
+	cfg     DiskConfig
+	mu      sync.Mutex
+	entries int
+	bytes   int64
+	stats   Stats
+}
+
+// diskHeader is the size of the expiry written ahead of each value.
+const diskHeader = 8
+
+const diskExt = ".cache"
+
+// Values are written to temporary files first. Temporary files older than
+// diskTempAge were left by a writer that stopped before renaming them and
+// are removed the next time the directory is walked.
+const (
+	diskTemp    = ".tmp-"
+	diskTempAge = time.Hour
+)
+
+// NewDisk constructs a store in the specified directory, creating it if
+// needed. Values left by a previous run are kept.
+func NewDisk(dir string, cfg DiskConfig) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+
+	d := Disk{
+		dir: dir,
+		cfg: cfg,
+	}
+
+	files, err := d.files()
+	if err != nil {
+		return nil, err
+	}
+
+	d.entries = len(files)
+	for _, f := range files {
+		d.bytes += f.size
+	}
+
+	return &d, nil
+}
+
+// Get returns the value stored for the key.
+func (d *Disk) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	path := d.path(key)
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		d.count(func(s *Stats) { s.Misses++ })
+		return nil, false, nil
+
+	case err != nil:
+		d.count(func(s *Stats) { s.Errors++ })
+		return nil, false, fmt.Errorf("read: %w", err)
+	}
+
+	now := time.Now()
+
+	if len(data) < diskHeader {
+		d.remove(path)
+		d.count(func(s *Stats) { s.Misses++ })
+		return nil, false, nil
+	}
+
+	if nanos := int64(binary.LittleEndian.Uint64(data)); nanos != 0 && expired(time.Unix(0, nanos), now) {
+		d.remove(path)
+		d.count(func(s *Stats) { s.Misses++ })
+		return nil, false, nil
+	}
+
+	// A failure here only makes the file look older than it is.
+	os.Chtimes(path, now, now)
+
+	d.count(func(s *Stats) { s.Hits++ })
+
+	return data[diskHeader:], true, nil
+}
+
+// Set stores the value for the key. The file is written to a temporary name
+// and renamed, so readers never see a partial value.
+func (d *Disk) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	path := d.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+
+	var nanos int64
+	if exp := expiry(ttl, time.Now()); !exp.IsZero() {
+		nanos = exp.UnixNano()
+	}
+
+	data := make([]byte, diskHeader+len(value))
+	binary.LittleEndian.PutUint64(data, uint64(nanos))
+	copy(data[diskHeader:], value)
+
+	f, err := os.CreateTemp(filepath.Dir(path), diskTemp+"*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+
+	// The temporary file is removed unless it was renamed.
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	// The totals are updated under the lock so concurrent writes of the
+	// same key count the file once.
+	d.mu.Lock()
+
+	info, statErr := os.Stat(path)
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		d.mu.Unlock()
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	d.bytes += int64(len(data))
+	if statErr == nil {
+		d.bytes -= info.Size()
+	} else {
+		d.entries++
+	}
+	over := d.cfg.MaxBytes > 0 && d.bytes > d.cfg.MaxBytes
+
+	d.mu.Unlock()
+
+	if over {
+		return d.evict(d.cfg.MaxBytes * 9 / 10)
+	}
+
+	return nil
+}
+
+// Delete removes the value stored for the key.
+func (d *Disk) Delete(ctx context.Context, key string) error {
+	d.remove(d.path(key))
+	return nil
+}
+
+// Prune removes every expired value and returns the number removed.
+func (d *Disk) Prune() (int, error) {
+	files, err := d.files()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	var n int
+	for _, f := range files {
+		if f.expired(now) {
+			d.remove(f.path)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Stats returns the activity of the store. Entries and Bytes are running
+// totals of the files found when the store was opened and the changes made
+// through it, so they miss writes by other processes sharing the directory.
+func (d *Disk) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := d.stats
+	stats.Entries = d.entries
+	stats.Bytes = d.bytes
+
+	return stats
+}
+
+// =============================================================================
+
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (f diskFile) expired(now time.Time) bool {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	var header [diskHeader]byte
+	if _, err := file.Read(header[:]); err != nil {
+		return true
+	}
+
+	nanos := int64(binary.LittleEndian.Uint64(header[:]))
+	return nanos != 0 && expired(time.Unix(0, nanos), now)
+}
+
+// path spreads the files over 256 subdirectories named after the first byte
+// of the hashed key.
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+
+	return filepath.Join(d.dir, name[:2], name+diskExt)
+}
+
+// files lists the cached files and removes the stale temporary files found
+// along the way.
+func (d *Disk) files() ([]diskFile, error) {
+	var files []diskFile
+	stale := time.Now().Add(-diskTempAge)
+
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed while walking are skipped.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		temp := strings.HasPrefix(entry.Name(), diskTemp)
+		if !temp && !strings.HasSuffix(path, diskExt) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		if temp {
+			if info.ModTime().Before(stale) {
+				os.Remove(path)
+			}
+			return nil
+		}
+
+		files = append(files, diskFile{
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("walk: %w", err)
+	}
+
+	return files, nil
+}
+
+func (d *Disk) remove(path string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if err := os.Remove(path); err != nil {
+		return false
+	}
+
+	d.entries--
+	d.bytes -= info.Size()
+
+	return true
+}
+
+// evict removes expired files and then the least recently used ones until
+// the store holds no more than target bytes.
+func (d *Disk) evict(target int64) error {
+	files, err := d.files()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+
+	now := time.Now()
+
+	for i, f := range files {
+		if f.expired(now) && d.remove(f.path) {
+			size -= f.size
+			files[i].path = ""
+		}
+	}
+
+	for _, f := range files {
+		if size <= target {
+			break
+		}
+
+		if f.path != "" && d.remove(f.path) {
+			size -= f.size
+			d.count(func(s *Stats) { s.Evictions++ })
+		}
+	}
+
+	return nil
+}
+
+func (d *Disk) count(fn func(s *Stats)) {
+	d.mu.Lock()
+	fn(&d.stats)
+	d.mu.Unlock()
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// EmbedderConfig defines the behavior of an Embedder.
+type EmbedderConfig struct {
+	// TTL is how long vectors are kept. Zero keeps them until the store
+	// evicts them.
+	TTL time.Duration
+
+	// Embed controls how misses are batched and sent. Its Options, such as
+	// "truncate" and "truncate_direction", are part of the cache key.
+	Embed client.EmbedConfig
+}
+
+// Embedder serves embeddings from a store and only sends the inputs it
+// hasn't seen before to the embeddings endpoint. Entries are keyed by a hash
+// of the model, the input and the request options, so the same text or
+// image embedded under different truncate settings is cached separately.
+// It is safe for concurrent use.
+type Embedder struct {
+	cln   *client.Client
+	url   string
+	store Store
+	cfg   EmbedderConfig
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewEmbedder constructs an embedder that sends misses to the specified
+// embeddings url.
+func NewEmbedder(cln *client.Client, url string, store Store, cfg EmbedderConfig) *Embedder {
+	e := Embedder{
+		cln:   cln,
+		url:   url,
+		store: store,
+		cfg:   cfg,
+	}
+
+	return &e
+}
+
+// Embed returns a vector for every input in input order. Each input is a D
+// such as {"text": ...} or {"text": ..., "image": ...}. A store that fails
+// is treated as a miss so the call still succeeds; failures are counted in
+// Stats.Errors.
+func (e *Embedder) Embed(ctx context.Context, model string, inputs []client.D) ([][]float64, error) {
+	vectors := make([][]float64, len(inputs))
+
+	// Inputs repeated within the call are only sent once.
+	var misses []client.D
+	var missKeys []string
+	pending := make(map[string][]int)
+
+	var hits, errs uint64
+
+	for i, input := range inputs {
+		key, err := e.Key(model, input)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+
+		if idx, exists := pending[key]; exists {
+			pending[key] = append(idx, i)
+			continue
+		}
+
+		data, ok, err := e.store.Get(ctx, key)
+		if err != nil {
+			errs++
+		}
+
+		if ok {
+			if v, err := decodeVector(data); err == nil {
+				vectors[i] = v
+				hits++
+				continue
+			}
+			errs++
+		}
+
+		pending[key] = []int{i}
+		misses = append(misses, input)
+		missKeys = append(missKeys, key)
+	}
+
+	e.count(func(s *Stats) {
+		s.Hits += hits
+		s.Misses += uint64(len(inputs)) - hits
+		s.Errors += errs
+	})
+
+	if len(misses) == 0 {
+		return vectors, nil
+	}
+
+	fresh, err := e.cln.EmbedAll(ctx, e.url, model, misses, e.cfg.Embed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range missKeys {
+		for _, idx := range pending[key] {
+			vectors[idx] = fresh[i]
+		}
+
+		if err := e.store.Set(ctx, key, encodeVector(fresh[i]), e.cfg.TTL); err != nil {
+			e.count(func(s *Stats) { s.Errors++ })
+		}
+	}
+
+	return vectors, nil
+}
+
+// Invalidate removes the cached vector for the input.
+func (e *Embedder) Invalidate(ctx context.Context, model string, input client.D) error {
+	key, err := e.Key(model, input)
+	if err != nil {
+		return err
+	}
+
+	return e.store.Delete(ctx, key)
+}
+
+// Key returns the cache key for the input. Map keys are sorted when the
+// input is encoded, so equal inputs always produce the same key.
+func (e *Embedder) Key(model string, input client.D) (string, error) {
+	data, err := json.Marshal([]any{model, input, e.cfg.Embed.Options})
+	if err != nil {
+		return "", fmt.Errorf("encoding key: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return "embed:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Stats returns the hits and misses of the embedder, counted per input.
+func (e *Embedder) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.stats
+}
+
+// =============================================================================
+
+func (e *Embedder) count(fn func(s *Stats)) {
+	e.mu.Lock()
+	fn(&e.stats)
+	e.mu.Unlock()
+}
+
+// encodeVector stores the vector as little endian float64 values.
+func encodeVector(v []float64) []byte {
+	data := make([]byte, 8*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(f))
+	}
+	return data
+}
+
+func decodeVector(data []byte) ([]float64, error) {
+	if len(data) == 0 || len(data)%8 != 0 {
+		return nil, fmt.Errorf("invalid vector size %d", len(data))
+	}
+
+	v := make([]float64, len(data)/8)
+	for i := range v {
+		v[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+	}
+	return v, nil
+}
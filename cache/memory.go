@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryConfig defines the bounds of a Memory store. A zero value means no
+// limit.
+type MemoryConfig struct {
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// Memory is an in-memory store that evicts the least recently used values
+// once it grows past its bounds. Expired values are removed when they are
+// next looked up.
+type Memory struct {
+	cfg   MemoryConfig
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+	stats Stats
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory constructs an empty in-memory store.
+func NewMemory(cfg MemoryConfig) *Memory {
+	m := Memory{
+		cfg:   cfg,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+
+	return &m
+}
+
+// Get returns a copy of the value stored for the key.
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, exists := m.items[key]
+	if !exists {
+		m.stats.Misses++
+		return nil, false, nil
+	}
+
+	e := el.Value.(*memoryEntry)
+	if expired(e.expires, time.Now()) {
+		m.remove(el)
+		m.stats.Misses++
+		return nil, false, nil
+	}
+
+	m.ll.MoveToFront(el)
+	m.stats.Hits++
+
+	return slices.Clone(e.value), true, nil
+}
+
+// Set stores a copy of the value for the key.
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, exists := m.items[key]; exists {
+		m.remove(el)
+	}
+
+	e := memoryEntry{
+		key:     key,
+		value:   slices.Clone(value),
+		expires: expiry(ttl, time.Now()),
+	}
+
+	m.items[key] = m.ll.PushFront(&e)
+	m.bytes += int64(len(value))
+
+	m.evict()
+
+	return nil
+}
+
+// Delete removes the value stored for the key.
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, exists := m.items[key]; exists {
+		m.remove(el)
+	}
+
+	return nil
+}
+
+// Len returns the number of values stored, including any that have expired
+// but not yet been removed.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ll.Len()
+}
+
+// Clear removes every value.
+func (m *Memory) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ll.Init()
+	clear(m.items)
+	m.bytes = 0
+}
+
+// Stats returns the activity of the store.
+func (m *Memory) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Entries = m.ll.Len()
+	stats.Bytes = m.bytes
+
+	return stats
+}
+
+// =============================================================================
+
+func (m *Memory) remove(el *list.Element) {
+	e := m.ll.Remove(el).(*memoryEntry)
+	delete(m.items, e.key)
+	m.bytes -= int64(len(e.value))
+}
+
+// evict drops values from the back of the list until the store is within
+// its bounds. The newest value is always kept.
+func (m *Memory) evict() {
+	over := func() bool {
+		return (m.cfg.MaxEntries > 0 && m.ll.Len() > m.cfg.MaxEntries) ||
+			(m.cfg.MaxBytes > 0 && m.bytes > m.cfg.MaxBytes)
+	}
+
+	for m.ll.Len() > 1 && over() {
+		m.remove(m.ll.Back())
+		m.stats.Evictions++
+	}
+}
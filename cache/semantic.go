@@ -0,0 +1,349 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/vector"
+)
+
+// Default values used by a Semantic cache when the config is empty.
+const (
+	DefaultSemanticThreshold  = 0.95
+	DefaultSemanticMaxEntries = 10_000
+)
+
+// SemanticConfig defines the behavior of a Semantic cache.
+type SemanticConfig struct {
+	// Host is the base URL of the Prediction Guard API.
+	Host string
+
+	// EmbeddingModel embeds the prompts.
+	EmbeddingModel string
+
+	// Threshold is the cosine similarity a previous prompt needs to reach
+	// for its answer to be reused.
+	Threshold float64
+
+	// TTL is how long answers are kept. Zero keeps them until they are
+	// evicted.
+	TTL time.Duration
+
+	// MaxEntries bounds the number of answers kept. The oldest are evicted
+	// first.
+	MaxEntries int
+}
+
+// SemanticResult represents an answer and where it came from.
+type SemanticResult struct {
+	Chat client.Chat
+
+	// Hit reports whether the answer came from the cache. Prompt and
+	// Similarity describe the cached prompt that matched.
+	Hit        bool
+	Prompt     string
+	Similarity float64
+}
+
+// Semantic caches chat answers by the meaning of the prompt, so a paraphrase
+// of a question asked before gets the earlier answer without calling the
+// model. Answers are only shared between requests with the same model and
+// system prompt; other chat options aren't part of the scope. It is safe for
+// concurrent use.
+type Semantic struct {
+	cln     *client.Client
+	cfg     SemanticConfig
+	index   *vector.Flat
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	seq     int
+	stats   Stats
+}
+
+type semanticEntry struct {
+	id      string
+	scope   string
+	prompt  string
+	chat    client.Chat
+	expires time.Time
+}
+
+const metaScope = "scope"
+
+// NewSemantic constructs an empty semantic cache.
+func NewSemantic(cln *client.Client, cfg SemanticConfig) *Semantic {
+	if cfg.Host == "" {
+		cfg.Host = client.DefaultHost
+	}
+	cfg.Host = strings.TrimSuffix(cfg.Host, "/")
+
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultSemanticThreshold
+	}
+
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultSemanticMaxEntries
+	}
+
+	s := Semantic{
+		cln:     cln,
+		cfg:     cfg,
+		index:   vector.NewFlat(vector.Metrics.Cosine),
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+
+	return &s
+}
+
+// Chat answers the prompt from the cache when a similar prompt was asked
+// before under the same model and system prompt, and calls the chat model
+// otherwise. The options are extra fields for the chat request, such as
+// "max_tokens" and "temperature". Answers are only cached when the model
+// returns at least one choice.
+func (s *Semantic) Chat(ctx context.Context, model string, system string, prompt string, options client.D) (SemanticResult, error) {
+	scope := semanticScope(model, system)
+
+	vec, err := s.embed(ctx, prompt)
+	if err != nil {
+		return SemanticResult{}, err
+	}
+
+	if r, ok := s.lookup(scope, vec); ok {
+		s.count(func(st *Stats) { st.Hits++ })
+		return r, nil
+	}
+
+	s.count(func(st *Stats) { st.Misses++ })
+
+	var messages []client.D
+	if system != "" {
+		messages = append(messages, client.D{"role": client.Roles.System, "content": system})
+	}
+	messages = append(messages, client.D{"role": client.Roles.User, "content": prompt})
+
+	d := client.D{
+		"model":    model,
+		"messages": messages,
+	}
+
+	for k, v := range options {
+		d[k] = v
+	}
+
+	var resp client.Chat
+	if err := s.cln.Do(ctx, http.MethodPost, s.cfg.Host+"/chat/completions", d, &resp); err != nil {
+		return SemanticResult{}, fmt.Errorf("chat: %w", err)
+	}
+
+	if len(resp.Choices) > 0 {
+		s.store(scope, prompt, vec, resp)
+	}
+
+	return SemanticResult{Chat: resp}, nil
+}
+
+// Invalidate removes the cached answers whose prompts match the prompt
+// under the model and system prompt, and returns the number removed.
+func (s *Semantic) Invalidate(ctx context.Context, model string, system string, prompt string) (int, error) {
+	vec, err := s.embed(ctx, prompt)
+	if err != nil {
+		return 0, err
+	}
+
+	results, err := s.index.Search(vec, s.index.Len(), vector.Match(map[string]any{metaScope: semanticScope(model, system)}))
+	if err != nil {
+		return 0, fmt.Errorf("search: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, r := range results {
+		if r.Score < s.cfg.Threshold {
+			break
+		}
+
+		if el, exists := s.entries[r.ID]; exists {
+			s.remove(el)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// InvalidateScope removes every cached answer for the model and system
+// prompt and returns the number removed.
+func (s *Semantic) InvalidateScope(model string, system string) int {
+	scope := semanticScope(model, system)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for el := s.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*semanticEntry).scope == scope {
+			s.remove(el)
+			n++
+		}
+		el = next
+	}
+
+	return n
+}
+
+// Clear removes every cached answer.
+func (s *Semantic) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for el := s.order.Front(); el != nil; {
+		next := el.Next()
+		s.remove(el)
+		el = next
+	}
+}
+
+// Stats returns the hits, misses and evictions of the cache.
+func (s *Semantic) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Entries = s.order.Len()
+
+	return stats
+}
+
+// =============================================================================
+
+func semanticScope(model string, system string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + system))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Semantic) embed(ctx context.Context, prompt string) ([]float64, error) {
+	d := client.D{
+		"model": s.cfg.EmbeddingModel,
+		"input": []client.D{{"text": prompt}},
+	}
+
+	var resp client.Embedding
+	if err := s.cln.Do(ctx, http.MethodPost, s.cfg.Host+"/embeddings", d, &resp); err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+
+	if len(resp.Data) != 1 || len(resp.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("embeddings: expected 1 vector, got %d", len(resp.Data))
+	}
+
+	return resp.Data[0].Embedding, nil
+}
+
+// lookup returns the answer of the most similar live prompt in the scope.
+// Expired answers found along the way are removed.
+func (s *Semantic) lookup(scope string, vec []float64) (SemanticResult, bool) {
+	filter := vector.Match(map[string]any{metaScope: scope})
+
+	for k := 4; ; k *= 4 {
+		results, err := s.index.Search(vec, k, filter)
+		if err != nil {
+			return SemanticResult{}, false
+		}
+
+		now := time.Now()
+
+		s.mu.Lock()
+		for _, r := range results {
+			if r.Score < s.cfg.Threshold {
+				s.mu.Unlock()
+				return SemanticResult{}, false
+			}
+
+			el, exists := s.entries[r.ID]
+			if !exists {
+				continue
+			}
+
+			e := el.Value.(*semanticEntry)
+			if expired(e.expires, now) {
+				s.remove(el)
+				continue
+			}
+
+			s.mu.Unlock()
+
+			result := SemanticResult{
+				Chat:       e.chat,
+				Hit:        true,
+				Prompt:     e.prompt,
+				Similarity: r.Score,
+			}
+
+			return result, true
+		}
+		s.mu.Unlock()
+
+		if len(results) < k {
+			return SemanticResult{}, false
+		}
+	}
+}
+
+func (s *Semantic) store(scope string, prompt string, vec []float64, chat client.Chat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+
+	e := semanticEntry{
+		id:      strconv.Itoa(s.seq),
+		scope:   scope,
+		prompt:  prompt,
+		chat:    chat,
+		expires: expiry(s.cfg.TTL, time.Now()),
+	}
+
+	item := vector.Item{
+		ID:       e.id,
+		Vector:   vec,
+		Metadata: map[string]any{metaScope: scope},
+	}
+
+	if err := s.index.Add(item); err != nil {
+		s.stats.Errors++
+		return
+	}
+
+	s.entries[e.id] = s.order.PushBack(&e)
+
+	for s.order.Len() > s.cfg.MaxEntries {
+		s.remove(s.order.Front())
+		s.stats.Evictions++
+	}
+}
+
+func (s *Semantic) remove(el *list.Element) {
+	e := s.order.Remove(el).(*semanticEntry)
+	delete(s.entries, e.id)
+	s.index.Delete(e.id)
+}
+
+func (s *Semantic) count(fn func(st *Stats)) {
+	s.mu.Lock()
+	fn(&s.stats)
+	s.mu.Unlock()
+}
@@ -0,0 +1,312 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTLs are the endpoints cached by a Transport when no TTLs are
+// configured. Chat completions are only cached for requests with a
+// temperature of 0 that don't stream.
+var DefaultTTLs = map[string]time.Duration{
+	"/tokenize":         24 * time.Hour,
+	"/models":           time.Hour,
+	"/translate":        24 * time.Hour,
+	"/injection":        24 * time.Hour,
+	"/toxicity":         24 * time.Hour,
+	"/chat/completions": time.Hour,
+}
+
+// Default bounds of the store a Transport creates when none is configured.
+const (
+	DefaultTransportMaxBytes      = 64 << 20
+	DefaultTransportMaxEntryBytes = 1 << 20
+)
+
+// HeaderCache is set on responses served by a Transport to "HIT" or "MISS".
+const HeaderCache = "X-Cache"
+
+// TransportConfig defines the behavior of a Transport.
+type TransportConfig struct {
+	// Base sends the requests that aren't served from the cache. It
+	// defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Store holds the responses. It defaults to a Memory store bounded by
+	// DefaultTransportMaxBytes.
+	Store Store
+
+	// TTLs maps endpoint paths to how long their responses are kept. A
+	// path matches the end of the request path or any path below it, so
+	// "/models" covers "/models/completion". Endpoints not listed aren't
+	// cached. It defaults to DefaultTTLs.
+	TTLs map[string]time.Duration
+
+	// MaxEntryBytes is the largest response body that is cached. It
+	// defaults to DefaultTransportMaxEntryBytes.
+	MaxEntryBytes int
+}
+
+// Transport is an http.RoundTripper that caches the responses of endpoints
+// that return the same output for the same input. The key is the method,
+// the path, the API key and the request body with its JSON canonicalized,
+// so requests that only differ in field order or whitespace share an entry.
+// Only successful responses are cached. It is safe for concurrent use.
+//
+// Install it with client.WithClient(&http.Client{Transport: t}).
+type Transport struct {
+	cfg   TransportConfig
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewTransport constructs a caching transport.
+func NewTransport(cfg TransportConfig) *Transport {
+	if cfg.Base == nil {
+		cfg.Base = http.DefaultTransport
+	}
+
+	if cfg.Store == nil {
+		cfg.Store = NewMemory(MemoryConfig{MaxBytes: DefaultTransportMaxBytes})
+	}
+
+	if cfg.TTLs == nil {
+		cfg.TTLs = DefaultTTLs
+	}
+
+	if cfg.MaxEntryBytes <= 0 {
+		cfg.MaxEntryBytes = DefaultTransportMaxEntryBytes
+	}
+
+	t := Transport{
+		cfg: cfg,
+	}
+
+	return &t
+}
+
+type bypassKey struct{}
+
+// Bypass returns a context whose requests skip the cache: they are neither
+// served from it nor stored in it.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	v, _ := ctx.Value(bypassKey{}).(bool)
+	return v
+}
+
+// RoundTrip implements http.RoundTripper. The Cache-Control header the
+// client sends on every request is ignored.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ttl, ok := t.ttl(req.URL.Path)
+	if !ok || bypassed(req.Context()) {
+		return t.cfg.Base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	key, ok := t.key(req, body)
+	if !ok {
+		return t.cfg.Base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+
+	data, ok, err := t.cfg.Store.Get(ctx, key)
+	if err != nil {
+		t.count(func(s *Stats) { s.Errors++ })
+	}
+
+	if ok {
+		if resp, err := decodeResponse(req, data); err == nil {
+			t.count(func(s *Stats) { s.Hits++ })
+			return resp, nil
+		}
+		t.count(func(s *Stats) { s.Errors++ })
+	}
+
+	t.count(func(s *Stats) { s.Misses++ })
+
+	resp, err := t.cfg.Base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return resp, err
+	}
+
+	// Read one byte past the limit to know whether the body fits.
+	data, err = io.ReadAll(io.LimitReader(resp.Body, int64(t.cfg.MaxEntryBytes)+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if len(data) > t.cfg.MaxEntryBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if entry, err := encodeResponse(resp, data); err == nil {
+		if err := t.cfg.Store.Set(ctx, key, entry, ttl); err != nil {
+			t.count(func(s *Stats) { s.Errors++ })
+		}
+	}
+
+	resp.Header.Set(HeaderCache, "MISS")
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+
+	return resp, nil
+}
+
+// Stats returns the hits and misses of the cacheable requests.
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.stats
+}
+
+// =============================================================================
+
+// ttl returns the ttl of the endpoint the path belongs to, preferring the
+// longest match.
+func (t *Transport) ttl(path string) (time.Duration, bool) {
+	var best string
+	var ttl time.Duration
+
+	for endpoint, d := range t.cfg.TTLs {
+		if len(endpoint) <= len(best) || d <= 0 {
+			continue
+		}
+
+		if strings.HasSuffix(path, endpoint) || strings.Contains(path, endpoint+"/") {
+			best, ttl = endpoint, d
+		}
+	}
+
+	return ttl, best != ""
+}
+
+// key builds the cache key for the request. It reports false for requests
+// that must not be cached, such as chat with a temperature other than 0.
+func (t *Transport) key(req *http.Request, body []byte) (string, bool) {
+	canonical := body
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return "", false
+		}
+
+		if strings.HasSuffix(req.URL.Path, "/chat/completions") && !deterministic(v) {
+			return "", false
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		canonical = data
+	}
+
+	h := sha256.New()
+	for _, part := range []string{req.Method, req.URL.Path, req.URL.RawQuery, req.Header.Get("Authorization")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(canonical)
+
+	return "http:" + hex.EncodeToString(h.Sum(nil)), true
+}
+
+// deterministic reports whether a chat request asks for a temperature of 0
+// without streaming.
+func deterministic(v any) bool {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	if stream, _ := m["stream"].(bool); stream {
+		return false
+	}
+
+	temp, ok := m["temperature"].(json.Number)
+	if !ok {
+		return false
+	}
+
+	f, err := temp.Float64()
+	return err == nil && f == 0
+}
+
+type cachedResponse struct {
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func encodeResponse(resp *http.Response, body []byte) ([]byte, error) {
+	header := resp.Header.Clone()
+	header.Del(HeaderCache)
+
+	return json.Marshal(cachedResponse{Header: header, Body: body})
+}
+
+func decodeResponse(req *http.Request, data []byte) (*http.Response, error) {
+	var cr cachedResponse
+	if err := json.Unmarshal(data, &cr); err != nil {
+		return nil, err
+	}
+
+	if cr.Header == nil {
+		cr.Header = make(http.Header)
+	}
+	cr.Header.Set(HeaderCache, "HIT")
+
+	resp := http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cr.Header,
+		Body:          io.NopCloser(bytes.NewReader(cr.Body)),
+		ContentLength: int64(len(cr.Body)),
+		Request:       req,
+	}
+
+	return &resp, nil
+}
+
+func (t *Transport) count(fn func(s *Stats)) {
+	t.mu.Lock()
+	fn(&t.stats)
+	t.mu.Unlock()
+}
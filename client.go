@@ -9,13 +9,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
 // TODO: Maintain this version when a new tag is created.
-const version = "v2.0.0"
+const version = "v2.1.0"
+
+// DefaultHost is the Prediction Guard API used when no host is configured.
+const DefaultHost = "https://api.predictionguard.com"
 
 var ErrUnauthorized = errors.New("api understands the request but refuses to authorize it")
 
@@ -40,16 +47,31 @@ type Logger func(context.Context, string, ...any)
 // =============================================================================
 
 type Client struct {
-	log    Logger
-	apiKey string
-	http   *http.Client
+	log      Logger
+	apiKey   string
+	http     *http.Client
+	flight   *flight
+	usage    *UsageTracker
+	metrics  Metrics
+	tracer   Tracer
+	slog     *slog.Logger
+	logCfg   LogConfig
+	debug    *debug
+	models   sync.Map
+	modelTTL time.Duration
 }
 
+// New constructs a client. A nil log discards the messages of the client.
 func New(log Logger, apiKey string, options ...func(cln *Client)) *Client {
+	if log == nil {
+		log = func(context.Context, string, ...any) {}
+	}
+
 	cln := Client{
-		log:    log,
-		apiKey: apiKey,
-		http:   &defaultClient,
+		log:      log,
+		apiKey:   apiKey,
+		http:     &defaultClient,
+		modelTTL: DefaultModelTTL,
 	}
 
 	for _, option := range options {
@@ -66,32 +88,85 @@ func WithClient(http *http.Client) func(cln *Client) {
 }
 
 func (cln *Client) Do(ctx context.Context, method string, endpoint string, body D, v any) error {
+	if cln.usage != nil && !untracked(ctx) {
+		return cln.usage.do(ctx, cln, method, endpoint, body, v)
+	}
+
+	_, _, _, err := cln.send(ctx, method, endpoint, body, v)
+	return err
+}
+
+// send makes the request and decodes the response into v. It returns the raw
+// response when it was buffered, which all but embedding responses are,
+// whether the response was shared with another caller by singleflight, and
+// whether a cache in front of the API served it.
+func (cln *Client) send(ctx context.Context, method string, endpoint string, body D, v any) ([]byte, bool, bool, error) {
+	ctx, c := cln.watch(ctx)
+
+	rm := cln.startMetrics(endpoint, body)
+	rl := cln.startLog(c, method, endpoint, body)
+	ctx, rt := cln.startTrace(ctx, c, method, endpoint, body, false)
+
+	data, shared, err := cln.exchange(ctx, method, endpoint, body, v)
+
+	rm.end(err)
+	rt.end(data, v, err)
+	rl.end(ctx, err)
+
+	return data, shared, c.cached(), err
+}
+
+func (cln *Client) exchange(ctx context.Context, method string, endpoint string, body D, v any) ([]byte, bool, error) {
+	if cln.flight != nil {
+		if key, ok := flightKey(method, endpoint, body); ok {
+			data, status, shared, err := cln.flight.do(ctx, key, func(ctx context.Context) ([]byte, int, error) {
+				resp, err := do(ctx, cln, method, endpoint, body)
+				if err != nil {
+					return nil, 0, err
+				}
+				defer resp.Body.Close()
+
+				data, err := io.ReadAll(resp.Body)
+				if err != nil {
+					return nil, 0, fmt.Errorf("client: copy error: %w", err)
+				}
+
+				return data, resp.StatusCode, nil
+			})
+
+			if err != nil {
+				return nil, shared, err
+			}
+
+			if status == http.StatusNoContent {
+				return nil, shared, nil
+			}
+
+			return data, shared, decode(bytes.NewReader(data), v)
+		}
+	}
+
 	resp, err := do(ctx, cln, method, endpoint, body)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNoContent {
-		return nil
+		return nil, false, nil
 	}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("client: copy error: %w", err)
+	switch v.(type) {
+	case *Embedding, *Embedding32:
+		return nil, false, decode(resp.Body, v)
 	}
 
-	switch d := v.(type) {
-	case *string:
-		*d = string(data)
-
-	default:
-		if err := json.Unmarshal(data, v); err != nil {
-			return fmt.Errorf("client: response: %s, decoding error: %w ", string(data), err)
-		}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("client: copy error: %w", err)
 	}
 
-	return nil
+	return data, false, decode(bytes.NewReader(data), v)
 }
 
 // =============================================================================
@@ -109,15 +184,46 @@ func NewSSE[T any](log Logger, apiKey string, options ...func(cln *Client)) *SSE
 }
 
 func (cln *SSEClient[T]) Do(ctx context.Context, method string, endpoint string, body D, ch chan T) error {
+	ts, err := cln.usage.stream(ctx, cln.Client, endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	ctx, c := cln.watch(ctx)
+
+	rm := cln.startMetrics(endpoint, body)
+	rl := cln.startLog(c, method, endpoint, body)
+	ctx, rt := cln.startTrace(ctx, c, method, endpoint, body, true)
+
 	resp, err := do(ctx, cln.Client, method, endpoint, body)
 	if err != nil {
+		rm.end(err)
+		rt.endStream(err)
+		rl.endStream(ctx, err)
+		if ts != nil {
+			ts.finish(ctx, err)
+		}
 		return err
 	}
 
+	if ts != nil {
+		ts.rec.Cached = c.cached()
+	}
+
 	go func(ctx context.Context) {
+		var streamErr error
+
 		defer func() {
 			resp.Body.Close()
 			close(ch)
+
+			rm.endStream(streamErr)
+			rt.endStream(streamErr)
+			rl.endStream(ctx, streamErr)
+
+			if ts != nil {
+				ts.finish(ctx, streamErr)
+			}
 		}()
 
 		scanner := bufio.NewScanner(resp.Body)
@@ -131,17 +237,29 @@ func (cln *SSEClient[T]) Do(ctx context.Context, method string, endpoint string,
 			var v T
 			if err := json.Unmarshal([]byte(line[6:]), &v); err != nil {
 				cln.log(ctx, "sseclient: rawRequest:", "Unmarshal", err)
+				streamErr = err
 				return
 			}
 
+			rm.chunk()
+			rt.chunk()
+			rl.chunk()
+
+			if ts != nil {
+				ts.chunk(v)
+			}
+
 			select {
 			case ch <- v:
 
 			case <-ctx.Done():
-				cln.log(ctx, "sseclient: rawRequest:", "Context", err.Error())
+				cln.log(ctx, "sseclient: rawRequest:", "Context", ctx.Err().Error())
+				streamErr = ctx.Err()
 				return
 			}
 		}
+
+		streamErr = scanner.Err()
 	}(ctx)
 
 	return nil
@@ -149,6 +267,41 @@ func (cln *SSEClient[T]) Do(ctx context.Context, method string, endpoint string,
 
 // =============================================================================
 
+func decode(r io.Reader, v any) error {
+	// Embedding responses can be large, so they are decoded as they stream
+	// in rather than buffered first.
+	switch d := v.(type) {
+	case *Embedding:
+		if err := DecodeEmbedding(r, d); err != nil {
+			return fmt.Errorf("client: %w", err)
+		}
+		return nil
+
+	case *Embedding32:
+		if err := DecodeEmbedding32(r, d); err != nil {
+			return fmt.Errorf("client: %w", err)
+		}
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("client: copy error: %w", err)
+	}
+
+	switch d := v.(type) {
+	case *string:
+		*d = string(data)
+
+	default:
+		if err := json.Unmarshal(data, v); err != nil {
+			return &bodyError{format: "client: response: %s, decoding error: %v ", body: data, err: err}
+		}
+	}
+
+	return nil
+}
+
 func do(ctx context.Context, cln *Client, method string, endpoint string, body any) (*http.Response, error) {
 	var statusCode int
 
@@ -157,29 +310,22 @@ func do(ctx context.Context, cln *Client, method string, endpoint string, body a
 		cln.log(ctx, "do: rawRequest: completed", "status", statusCode)
 	}()
 
-	var b bytes.Buffer
-	if body != nil {
-		if err := json.NewEncoder(&b).Encode(body); err != nil {
-			return nil, fmt.Errorf("encoding: error: %w", err)
-		}
-	}
-
-	req, err := http.NewRequestWithContext(ctx, method, endpoint, &b)
+	req, err := newRequest(ctx, cln, method, endpoint, body)
 	if err != nil {
-		return nil, fmt.Errorf("create request error: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", fmt.Sprintf("Prediction Guard Go Client: %s", version))
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cln.apiKey))
+	id := cln.debug.request(req)
 
 	resp, err := cln.http.Do(req)
 	if err != nil {
+		cln.debug.fail(id, err)
 		return nil, fmt.Errorf("do: error: %w", err)
 	}
 
+	cln.debug.response(id, resp)
+	recordResponse(ctx, resp)
+
 	// Assign for logging the status code at the end of the function call.
 	statusCode = resp.StatusCode
 
@@ -195,15 +341,198 @@ func do(ctx context.Context, cln *Client, method string, endpoint string, body a
 
 		switch statusCode {
 		case http.StatusForbidden:
-			return nil, ErrUnauthorized
+			return nil, &statusError{status: statusCode, err: ErrUnauthorized}
 
 		default:
 			var err Error
 			if err := json.Unmarshal(data, &err); err != nil {
-				return nil, fmt.Errorf("decoding: response: %s, error: %w ", string(data), err)
+				return nil, &statusError{status: statusCode, err: &bodyError{format: "decoding: response: %s, error: %v ", body: data, err: err}}
 			}
 
-			return nil, fmt.Errorf("error: response: %s", err.Message)
+			return nil, &statusError{status: statusCode, err: fmt.Errorf("error: response: %s", err.Message)}
+		}
+	}
+}
+
+// newRequest constructs the request the client sends for the body.
+func newRequest(ctx context.Context, cln *Client, method string, endpoint string, body any) (*http.Request, error) {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			return nil, fmt.Errorf("encoding: error: %w", err)
 		}
 	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, &b)
+	if err != nil {
+		return nil, fmt.Errorf("create request error: %w", err)
+	}
+
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("Prediction Guard Go Client: %s", version))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cln.apiKey))
+	setTraceHeaders(ctx, req)
+
+	return req, nil
+}
+
+// statusError keeps the status code of a failed response for usage records
+// while reading like the error it wraps.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// bodyError is an error that quotes the response body it was caused by. The
+// body can hold user content, so request logs leave it out.
+type bodyError struct {
+	format string
+	body   []byte
+	err    error
+}
+
+func (e *bodyError) Error() string {
+	return fmt.Sprintf(e.format, e.body, e.err)
+}
+
+func (e *bodyError) Unwrap() error {
+	return e.err
+}
+
+// withoutBody returns err with the response body it quotes, if any,
+// replaced by its size. The returned error still wraps err.
+func withoutBody(err error) error {
+	var be *bodyError
+	if !errors.As(err, &be) || len(be.body) == 0 {
+		return err
+	}
+
+	text := strings.ReplaceAll(err.Error(), string(be.body), fmt.Sprintf("[%d bytes]", len(be.body)))
+
+	return &redactedError{text: text, err: err}
+}
+
+// redactedError replaces the text of the error it wraps.
+type redactedError struct {
+	text string
+	err  error
+}
+
+func (e *redactedError) Error() string {
+	return e.text
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// statusOf returns the status code of the response behind err, 200 when err
+// is nil and 0 when no response was received.
+func statusOf(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status
+	}
+
+	return 0
+}
+
+// callKey holds the call of a request in its context.
+type callKey struct{}
+
+// call collects what the response reveals about a request for its trace,
+// log and usage record. It is filled by the goroutine that sends the
+// request, which for a shared singleflight request isn't the goroutine of
+// the caller.
+type call struct {
+	mu    sync.Mutex
+	id    string
+	cache bool
+}
+
+// watch returns a context that collects the response of the request into
+// the returned call, when the client traces, logs or tracks requests.
+func (cln *Client) watch(ctx context.Context) (context.Context, *call) {
+	if cln.tracer == nil && cln.slog == nil && cln.usage == nil {
+		return ctx, nil
+	}
+
+	c := call{}
+	return context.WithValue(ctx, callKey{}, &c), &c
+}
+
+func (c *call) requestID() string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.id
+}
+
+// cached reports whether a cache in front of the API, which marks the
+// responses it serves with an "X-Cache: HIT" header, served the response.
+func (c *call) cached() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cache
+}
+
+// recordResponse keeps the request ID of resp, and whether it came from a
+// cache, for the call in the context.
+func recordResponse(ctx context.Context, resp *http.Response) {
+	c, ok := ctx.Value(callKey{}).(*call)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.id = resp.Header.Get(RequestIDHeader)
+	c.cache = resp.Header.Get("X-Cache") == "HIT"
+}
+
+// StatusCode returns the status code of the API response that caused err, or
+// 0 when err wasn't caused by a response, such as a network failure.
+func StatusCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	return statusOf(err)
+}
+
+// describe returns the path of the endpoint and the model of the request
+// body, which label the request in usage records, metrics, traces and logs.
+func describe(endpoint string, body D) (string, string) {
+	path := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	model, _ := body["model"].(string)
+
+	return path, model
 }
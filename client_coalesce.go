@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CoalescerConfig defines how a Coalescer groups calls.
+type CoalescerConfig struct {
+	// Window is how long the first call in a batch waits for others to join.
+	Window time.Duration
+
+	// MaxBatch sends a batch as soon as it holds this many inputs.
+	MaxBatch int
+
+	// Options are extra fields sent with every request, such as
+	// "truncate" and "truncate_direction".
+	Options D
+}
+
+// Default values used by a Coalescer when the config is empty.
+const (
+	DefaultCoalesceWindow   = 5 * time.Millisecond
+	DefaultCoalesceMaxBatch = 32
+)
+
+// Coalescer collects concurrent single input embedding calls for the same
+// model and tenant and sends them as one batched request, handing each
+// caller back its own vector. It is safe for concurrent use.
+type Coalescer struct {
+	cln     *Client
+	url     string
+	cfg     CoalescerConfig
+	mu      sync.Mutex
+	pending map[string]*coalesceBatch
+}
+
+// NewCoalescer constructs a coalescer that sends batches to the specified
+// embeddings url.
+func NewCoalescer(cln *Client, url string, cfg CoalescerConfig) *Coalescer {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultCoalesceWindow
+	}
+
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = DefaultCoalesceMaxBatch
+	}
+
+	c := Coalescer{
+		cln:     cln,
+		url:     url,
+		cfg:     cfg,
+		pending: make(map[string]*coalesceBatch),
+	}
+
+	return &c
+}
+
+// Embed returns the embedding for a single input such as {"text": ...}. The
+// call waits for the batch it joined to complete or for its context to be
+// canceled, whichever happens first. A canceled call doesn't affect the
+// others in its batch.
+func (c *Coalescer) Embed(ctx context.Context, model string, input D) ([]float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	w := coalesceWaiter{
+		input:  input,
+		result: make(chan coalesceResult, 1),
+	}
+
+	b := c.join(ctx, model, &w)
+
+	select {
+	case r := <-w.result:
+		return r.vector, r.err
+
+	case <-ctx.Done():
+		c.abandon(b, &w)
+		return nil, ctx.Err()
+	}
+}
+
+// =============================================================================
+
+type coalesceResult struct {
+	vector []float64
+	err    error
+}
+
+type coalesceWaiter struct {
+	input     D
+	result    chan coalesceResult
+	abandoned bool
+}
+
+type coalesceBatch struct {
+	key     string
+	model   string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	waiters []*coalesceWaiter
+	live    int
+	timer   *time.Timer
+}
+
+// abandon marks the waiter as no longer interested. When every waiter has
+// left, the request for the batch is canceled and the batch stops taking
+// waiters, so the next call starts a new one.
+func (c *Coalescer) abandon(b *coalesceBatch, w *coalesceWaiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if w.abandoned {
+		return
+	}
+
+	w.abandoned = true
+	b.live--
+
+	if b.live == 0 {
+		b.cancel()
+		b.timer.Stop()
+
+		if c.pending[b.key] == b {
+			delete(c.pending, b.key)
+		}
+	}
+}
+
+// join adds the waiter to the pending batch for the model and tenant,
+// starting a new batch if needed, and sends the batch when it is full.
+func (c *Coalescer) join(ctx context.Context, model string, w *coalesceWaiter) *coalesceBatch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tenant := Tenant(ctx)
+	key := model + "\x00" + tenant
+
+	b, exists := c.pending[key]
+	if !exists {
+		// The request is made for every caller in the batch, so it carries
+		// only the tenant they share and none of the first caller's other
+		// values, such as its trace, or its cancellation.
+		bctx := context.Background()
+		if tenant != "" {
+			bctx = WithTenant(bctx, tenant)
+		}
+		bctx, cancel := context.WithCancel(bctx)
+
+		b = &coalesceBatch{
+			key:    key,
+			model:  model,
+			ctx:    bctx,
+			cancel: cancel,
+		}
+		b.timer = time.AfterFunc(c.cfg.Window, func() { c.flush(b) })
+
+		c.pending[key] = b
+	}
+
+	b.mu.Lock()
+	b.waiters = append(b.waiters, w)
+	b.live++
+	full := len(b.waiters) >= c.cfg.MaxBatch
+	b.mu.Unlock()
+
+	if full {
+		b.timer.Stop()
+		delete(c.pending, key)
+		go c.send(b)
+	}
+
+	return b
+}
+
+// flush sends the batch when its window expires, unless it was already sent
+// for being full.
+func (c *Coalescer) flush(b *coalesceBatch) {
+	c.mu.Lock()
+	if c.pending[b.key] != b {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pending, b.key)
+	c.mu.Unlock()
+
+	c.send(b)
+}
+
+func (c *Coalescer) send(b *coalesceBatch) {
+	defer b.cancel()
+
+	b.mu.Lock()
+	var waiters []*coalesceWaiter
+	for _, w := range b.waiters {
+		if !w.abandoned {
+			waiters = append(waiters, w)
+		}
+	}
+	b.mu.Unlock()
+
+	if len(waiters) == 0 {
+		return
+	}
+
+	inputs := make([]D, len(waiters))
+	for i, w := range waiters {
+		inputs[i] = w.input
+	}
+
+	d := D{
+		"model": b.model,
+		"input": inputs,
+	}
+
+	for k, v := range c.cfg.Options {
+		d[k] = v
+	}
+
+	var resp Embedding
+	err := c.cln.Do(b.ctx, http.MethodPost, c.url, d, &resp)
+
+	var vectors [][]float64
+	if err == nil {
+		vectors, err = orderVectors(resp, len(inputs))
+	}
+
+	if err != nil {
+		err = fmt.Errorf("coalesce: %w", err)
+	}
+
+	for i, w := range waiters {
+		r := coalesceResult{err: err}
+		if err == nil {
+			r.vector = vectors[i]
+		}
+		w.result <- r
+	}
+}
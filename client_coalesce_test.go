@@ -0,0 +1,135 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_Coalescer(t *testing.T) {
+	var calls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		var body struct {
+			Input []struct {
+				Text string `json:"text"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		var resp client.Embedding
+		for i := len(body.Input) - 1; i >= 0; i-- {
+			n, _ := strconv.Atoi(body.Input[i].Text)
+			resp.Data = append(resp.Data, client.EmbeddingData{Index: i, Embedding: []float64{float64(n)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "some-key")
+
+	c := client.NewCoalescer(cln, srv.URL+"/embeddings", client.CoalescerConfig{
+		Window:   50 * time.Millisecond,
+		MaxBatch: 10,
+	})
+
+	const callers = 25
+
+	var wg sync.WaitGroup
+	wg.Add(callers)
+
+	for i := range callers {
+		go func() {
+			defer wg.Done()
+
+			v, err := c.Embed(context.Background(), "multilingual-e5-large-instruct", client.D{"text": strconv.Itoa(i)})
+			if err != nil {
+				t.Errorf("Should be able to embed: %s", err)
+				return
+			}
+
+			if v[0] != float64(i) {
+				t.Errorf("Should get the vector for input %d, got %v", i, v)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("Should coalesce %d calls into 3 requests, got %d", callers, n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Embed(ctx, "multilingual-e5-large-instruct", client.D{"text": "1"}); err != context.DeadlineExceeded {
+		t.Fatalf("Should get the caller's context error, got %v", err)
+	}
+
+	// A batch every caller left must not take new callers, since its request
+	// is canceled.
+	c = client.NewCoalescer(cln, srv.URL+"/embeddings", client.CoalescerConfig{
+		Window:   200 * time.Millisecond,
+		MaxBatch: 10,
+	})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Embed(ctx, "multilingual-e5-large-instruct", client.D{"text": "1"}); err != context.DeadlineExceeded {
+		t.Fatalf("Should get the caller's context error, got %v", err)
+	}
+
+	if v, err := c.Embed(context.Background(), "multilingual-e5-large-instruct", client.D{"text": "2"}); err != nil || v[0] != 2 {
+		t.Fatalf("Should start a new batch after the last caller left, got %v, %v", v, err)
+	}
+
+	// Calls of different tenants are billed to their own tenant.
+	var mu sync.Mutex
+	tenants := map[string]int{}
+
+	tracker := client.NewUsageTracker(client.UsageConfig{
+		OnRecord: func(ctx context.Context, rec client.UsageRecord) {
+			mu.Lock()
+			defer mu.Unlock()
+			tenants[rec.Tenant]++
+		},
+	})
+
+	c = client.NewCoalescer(client.New(logger, "some-key", client.WithUsageTracker(tracker)), srv.URL+"/embeddings", client.CoalescerConfig{
+		Window:   50 * time.Millisecond,
+		MaxBatch: 10,
+	})
+
+	wg.Add(4)
+	for i, tenant := range []string{"a", "b", "a", "b"} {
+		go func() {
+			defer wg.Done()
+
+			ctx := client.WithTenant(context.Background(), tenant)
+			if _, err := c.Embed(ctx, "multilingual-e5-large-instruct", client.D{"text": strconv.Itoa(i)}); err != nil {
+				t.Errorf("Should be able to embed: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(tenants) != 2 || tenants["a"] != 1 || tenants["b"] != 1 {
+		t.Fatalf("Should send one batch per tenant, got %v", tenants)
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Set of content part types.
+const (
+	PartText     = "text"
+	PartImageURL = "image_url"
+)
+
+// ImageURL represents the image of a content part. The URL is either a
+// network location or a data URL holding the encoded image.
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// ContentPart represents one part of a multimodal message.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// NewTextPart constructs a text part.
+func NewTextPart(text string) ContentPart {
+	return ContentPart{
+		Type: PartText,
+		Text: text,
+	}
+}
+
+// NewImageURLPart constructs an image part from a network or data URL.
+func NewImageURLPart(url string) ContentPart {
+	return ContentPart{
+		Type:     PartImageURL,
+		ImageURL: &ImageURL{URL: url},
+	}
+}
+
+// NewImagePart constructs an image part holding the image as a data URL.
+func NewImagePart(ctx context.Context, img Image) (ContentPart, error) {
+	url, err := img.DataURL(ctx)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("encode image: %w", err)
+	}
+
+	return NewImageURLPart(url), nil
+}
+
+// =============================================================================
+
+// MarshalJSON implements json.Marshaler. The parts of a message are sent
+// as its content when it has any.
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	if m.Parts == nil {
+		type message ChatMessage
+		return json.Marshal(message(m))
+	}
+
+	msg := struct {
+		Role    string        `json:"role"`
+		Content []ContentPart `json:"content"`
+	}{
+		Role:    m.Role,
+		Content: m.Parts,
+	}
+
+	return json.Marshal(msg)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Content holding parts sets
+// Parts, and Content to the text of the text parts joined by newlines.
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	*m = ChatMessage{Role: msg.Role}
+
+	switch content := bytes.TrimSpace(msg.Content); {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+
+	case content[0] == '"':
+		return json.Unmarshal(content, &m.Content)
+
+	case content[0] == '[':
+		m.Parts = []ContentPart{}
+		if err := json.Unmarshal(content, &m.Parts); err != nil {
+			return err
+		}
+
+		var texts []string
+		for _, p := range m.Parts {
+			if p.Type == PartText {
+				texts = append(texts, p.Text)
+			}
+		}
+		m.Content = strings.Join(texts, "\n")
+
+		return nil
+	}
+
+	return errors.New("content must be a string or an array of parts")
+}
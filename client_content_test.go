@@ -0,0 +1,91 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_Content(t *testing.T) {
+	image, err := client.NewImagePart(context.Background(), client.NewImageBase64("data:image/png;base64,aGVsbG8="))
+	if err != nil {
+		t.Fatalf("Should be able to construct the image part: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		msg  client.ChatMessage
+		json string
+		exp  client.ChatMessage
+	}{
+		{
+			name: "text",
+			msg:  client.ChatMessage{Role: "user", Content: "hello"},
+			json: `{"role":"user","content":"hello"}`,
+			exp:  client.ChatMessage{Role: "user", Content: "hello"},
+		},
+		{
+			name: "parts",
+			msg: client.ChatMessage{Role: "user", Parts: []client.ContentPart{
+				client.NewTextPart("Is this a rose?"),
+				image,
+				client.NewImageURLPart("https://example.com/rose.png"),
+			}},
+			json: `{"role":"user","content":[{"type":"text","text":"Is this a rose?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,aGVsbG8="}},{"type":"image_url","image_url":{"url":"https://example.com/rose.png"}}]}`,
+			exp: client.ChatMessage{Role: "user", Content: "Is this a rose?", Parts: []client.ContentPart{
+				client.NewTextPart("Is this a rose?"),
+				image,
+				client.NewImageURLPart("https://example.com/rose.png"),
+			}},
+		},
+		{
+			name: "empty-parts",
+			msg:  client.ChatMessage{Role: "user", Parts: []client.ContentPart{}},
+			json: `{"role":"user","content":[]}`,
+			exp:  client.ChatMessage{Role: "user", Parts: []client.ContentPart{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Should be able to marshal: %s", err)
+			}
+
+			if string(data) != tt.json {
+				t.Fatalf("Should get the expected json\ngot: %s\nexp: %s", data, tt.json)
+			}
+
+			var got client.ChatMessage
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Should be able to unmarshal: %s", err)
+			}
+
+			if diff := cmp.Diff(got, tt.exp); diff != "" {
+				t.Fatalf("Should get the expected message back, diff:\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("null", func(t *testing.T) {
+		var got client.ChatMessage
+		if err := json.Unmarshal([]byte(`{"role":"assistant","content":null}`), &got); err != nil {
+			t.Fatalf("Should be able to unmarshal null content: %s", err)
+		}
+
+		if diff := cmp.Diff(got, client.ChatMessage{Role: "assistant"}); diff != "" {
+			t.Fatalf("Should get an empty message, diff:\n%s", diff)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var got client.ChatMessage
+		if err := json.Unmarshal([]byte(`{"role":"user","content":42}`), &got); err == nil {
+			t.Fatalf("Should fail to unmarshal numeric content")
+		}
+	})
+}
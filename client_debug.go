@@ -0,0 +1,293 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// APIKeyEnv is the environment variable ToCurl references in place of the
+// API key.
+const APIKeyEnv = "PREDICTIONGUARD_API_KEY"
+
+// redacted replaces the value of headers holding credentials in debug
+// output.
+const redacted = "[REDACTED]"
+
+// WithDebug makes the client write every request it sends and response it
+// receives to w, in the style of curl -v. Lines of a request are prefixed
+// with its number and >, and lines of its response with <. Response bodies
+// are written line by line as they are read, so the chunks of a stream
+// appear as they arrive. Credentials in headers are redacted, but bodies
+// are written as they are, prompts included, so the output belongs in a
+// terminal rather than a log.
+func WithDebug(w io.Writer) func(cln *Client) {
+	return func(cln *Client) {
+		if w == nil {
+			cln.debug = nil
+			return
+		}
+
+		cln.debug = &debug{w: w}
+	}
+}
+
+// ToCurl renders req as an equivalent curl command. The bearer token of
+// the Authorization header is replaced with a reference to the
+// PREDICTIONGUARD_API_KEY environment variable, so the command can be
+// shared without the key, and any other credentials are redacted. The body
+// of req is restored after it is read.
+func ToCurl(req *http.Request) (string, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "curl -X %s %s", req.Method, shellQuote(req.URL.String()))
+
+	for _, key := range sortedKeys(req.Header) {
+		for _, v := range req.Header.Values(key) {
+			if key == "Authorization" {
+				if token, ok := strings.CutPrefix(v, "Bearer "); ok && token != "" {
+					fmt.Fprintf(&b, " \\\n  -H \"Authorization: Bearer ${%s}\"", APIKeyEnv)
+					continue
+				}
+			}
+
+			fmt.Fprintf(&b, " \\\n  -H %s", shellQuote(key+": "+redact(key, v)))
+		}
+	}
+
+	if len(body) > 0 {
+		fmt.Fprintf(&b, " \\\n  --data-raw %s", shellQuote(string(bytes.TrimRight(body, "\n"))))
+	}
+
+	return b.String(), nil
+}
+
+// Curl renders the request the client would send for the body as an
+// equivalent curl command. See ToCurl.
+func (cln *Client) Curl(ctx context.Context, method string, endpoint string, body D) (string, error) {
+	req, err := newRequest(ctx, cln, method, endpoint, body)
+	if err != nil {
+		return "", err
+	}
+
+	return ToCurl(req)
+}
+
+// =============================================================================
+
+// debug writes requests and responses to a writer. Its methods do nothing
+// when the client isn't in debug mode.
+type debug struct {
+	mu sync.Mutex
+	w  io.Writer
+	n  int
+}
+
+// request writes req and returns its number.
+func (d *debug) request(req *http.Request) int {
+	if d == nil {
+		return 0
+	}
+
+	body, err := readBody(req)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.n++
+	prefix := fmt.Sprintf("%d> ", d.n)
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "%s%s %s\n", prefix, req.Method, req.URL)
+	writeHeader(&b, prefix, req.Header)
+	fmt.Fprintf(&b, "%s\n", strings.TrimSpace(prefix))
+
+	if err != nil {
+		fmt.Fprintf(&b, "%sbody: %s\n", prefix, err)
+	}
+	writeLines(&b, prefix, body)
+
+	d.w.Write(b.Bytes())
+
+	return d.n
+}
+
+// response writes the status and header of resp and replaces its body with
+// one that writes the body as it is read.
+func (d *debug) response(id int, resp *http.Response) {
+	if d == nil {
+		return
+	}
+
+	prefix := fmt.Sprintf("%d< ", id)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s%s %s\n", prefix, resp.Proto, resp.Status)
+	writeHeader(&b, prefix, resp.Header)
+	fmt.Fprintf(&b, "%s\n", strings.TrimSpace(prefix))
+
+	d.write(b.Bytes())
+
+	resp.Body = &debugBody{ReadCloser: resp.Body, d: d, prefix: prefix}
+}
+
+// fail writes the error of a request that got no response.
+func (d *debug) fail(id int, err error) {
+	if d == nil {
+		return
+	}
+
+	d.write([]byte(fmt.Sprintf("%d! %s\n", id, err)))
+}
+
+func (d *debug) write(p []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.w.Write(p)
+}
+
+// debugBody writes the complete lines of a response body as they are read,
+// and what remains of the last line when the body ends.
+type debugBody struct {
+	io.ReadCloser
+	d      *debug
+	prefix string
+	line   []byte
+	done   bool
+}
+
+func (db *debugBody) Read(p []byte) (int, error) {
+	n, err := db.ReadCloser.Read(p)
+	db.line = append(db.line, p[:n]...)
+
+	if i := bytes.LastIndexByte(db.line, '\n'); i >= 0 {
+		var b bytes.Buffer
+		writeLines(&b, db.prefix, db.line[:i+1])
+		db.d.write(b.Bytes())
+
+		db.line = slices.Delete(db.line, 0, i+1)
+	}
+
+	if err != nil {
+		db.flush()
+	}
+
+	return n, err
+}
+
+func (db *debugBody) Close() error {
+	db.flush()
+	return db.ReadCloser.Close()
+}
+
+func (db *debugBody) flush() {
+	if db.done {
+		return
+	}
+	db.done = true
+
+	if len(db.line) > 0 {
+		var b bytes.Buffer
+		writeLines(&b, db.prefix, db.line)
+		db.d.write(b.Bytes())
+		db.line = nil
+	}
+}
+
+// =============================================================================
+
+// readBody returns the body of req and gives req a fresh copy of it.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("get body: %w", err)
+		}
+		defer rc.Close()
+
+		return io.ReadAll(rc)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	return data, nil
+}
+
+// writeHeader writes the header sorted by key, with credentials redacted.
+func writeHeader(b *bytes.Buffer, prefix string, h http.Header) {
+	for _, key := range sortedKeys(h) {
+		for _, v := range h.Values(key) {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, key, redact(key, v))
+		}
+	}
+}
+
+// redact returns the value of the header with the credentials it holds, if
+// any, redacted. The authentication scheme of an authorization header is
+// kept, while cookies and API key headers are redacted whole.
+func redact(key string, v string) string {
+	switch http.CanonicalHeaderKey(key) {
+	case "Authorization", "Proxy-Authorization":
+		if scheme, _, ok := strings.Cut(v, " "); ok {
+			return scheme + " " + redacted
+		}
+		return redacted
+
+	case "Cookie", "Set-Cookie", "X-Api-Key":
+		return redacted
+	}
+
+	return v
+}
+
+// writeLines writes each line of data with the prefix, leaving out the
+// trailing newline of data.
+func writeLines(b *bytes.Buffer, prefix string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line == "" {
+			fmt.Fprintf(b, "%s\n", strings.TrimSpace(prefix))
+			continue
+		}
+
+		fmt.Fprintf(b, "%s%s\n", prefix, line)
+	}
+}
+
+func sortedKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,172 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_Debug(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret-session")
+		fmt.Fprint(w, `{"id":"chat-1","choices":[]}`)
+	})
+	mux.HandleFunc("POST /stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"one", "two"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var buf syncBuffer
+
+	cln := client.New(nil, "secret-key", client.WithDebug(&buf))
+	sse := client.NewSSE[client.ChatSSE](nil, "secret-key", client.WithDebug(&buf))
+
+	ctx := context.Background()
+
+	var resp client.Chat
+	if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", client.D{"model": "hermes"}, &resp); err != nil {
+		t.Fatalf("Should be able to chat: %s", err)
+	}
+
+	if resp.ID != "chat-1" {
+		t.Fatalf("Should still decode the response, got %+v", resp)
+	}
+
+	out := buf.String()
+
+	lines := []string{
+		"1> POST " + srv.URL + "/chat/completions",
+		"1> Authorization: Bearer [REDACTED]",
+		"1> Content-Type: application/json",
+		`1> {"model":"hermes"}`,
+		"1< HTTP/1.1 200 OK",
+		"1< Set-Cookie: [REDACTED]",
+		`1< {"id":"chat-1","choices":[]}`,
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("Should dump %s, got:\n%s", line, out)
+		}
+	}
+
+	if strings.Contains(out, "secret-key") || strings.Contains(out, "secret-session") {
+		t.Fatalf("Should redact the API key and cookies, got:\n%s", out)
+	}
+
+	ch := make(chan client.ChatSSE)
+	if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", client.D{"model": "hermes"}, ch); err != nil {
+		t.Fatalf("Should be able to stream: %s", err)
+	}
+	for range ch {
+	}
+
+	out = buf.String()
+
+	lines = []string{
+		"1> POST " + srv.URL + "/stream",
+		"1< Content-Type: text/event-stream",
+		`1< data: {"choices":[{"index":0,"delta":{"content":"one"}}]}`,
+		`1< data: {"choices":[{"index":0,"delta":{"content":"two"}}]}`,
+		"1< data: [DONE]",
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("Should dump the stream line %s, got:\n%s", line, out)
+		}
+	}
+}
+
+func Test_ToCurl(t *testing.T) {
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "secret-key")
+
+	ctx := client.WithTraceParent(context.Background(), parent, "")
+
+	cmd, err := cln.Curl(ctx, http.MethodPost, "https://api.predictionguard.com/chat/completions", client.D{"model": "hermes", "messages": "it's grand"})
+	if err != nil {
+		t.Fatalf("Should be able to render the request: %s", err)
+	}
+
+	exp := `curl -X POST 'https://api.predictionguard.com/chat/completions' \
+  -H 'Accept: application/json' \
+  -H "Authorization: Bearer ${PREDICTIONGUARD_API_KEY}" \
+  -H 'Cache-Control: no-cache' \
+  -H 'Content-Type: application/json' \
+  -H 'Traceparent: ` + parent + `' \
+  -H 'User-Agent: Prediction Guard Go Client: v2.1.0' \
+  --data-raw '{"messages":"it'\''s grand","model":"hermes"}'`
+
+	if cmd != exp {
+		t.Fatalf("Should render the curl command\ngot:\n%s\nexp:\n%s", cmd, exp)
+	}
+
+	// A request the caller made keeps its body after rendering.
+	req, _ := http.NewRequest(http.MethodPut, "http://localhost/items", io.NopCloser(strings.NewReader("hello")))
+
+	cmd, err = client.ToCurl(req)
+	if err != nil {
+		t.Fatalf("Should be able to render the request: %s", err)
+	}
+
+	if cmd != "curl -X PUT 'http://localhost/items' \\\n  --data-raw 'hello'" {
+		t.Fatalf("Should render the body, got:\n%s", cmd)
+	}
+
+	data, _ := io.ReadAll(req.Body)
+	if !bytes.Equal(data, []byte("hello")) {
+		t.Fatalf("Should restore the body, got %q", data)
+	}
+
+	// A body starting with @ is sent as it is rather than read from a file.
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost/items", strings.NewReader("@/etc/passwd"))
+
+	if cmd, _ = client.ToCurl(req); !strings.HasSuffix(cmd, "--data-raw '@/etc/passwd'") {
+		t.Fatalf("Should send the body raw, got:\n%s", cmd)
+	}
+
+	// Credentials other than a bearer token are redacted.
+	for _, auth := range []string{"Basic dXNlcjpzZWNyZXQ=", "Bearer ", "secret-token"} {
+		req, _ = http.NewRequest(http.MethodGet, "http://localhost/items", nil)
+		req.Header.Set("Authorization", auth)
+		req.Header.Set("Proxy-Authorization", "Basic cHJveHk6c2VjcmV0")
+
+		cmd, _ = client.ToCurl(req)
+		if strings.Contains(cmd, "dXNlcjpzZWNyZXQ=") || strings.Contains(cmd, "secret-token") || strings.Contains(cmd, "cHJveHk6c2VjcmV0") {
+			t.Fatalf("Should redact the credentials of %q, got:\n%s", auth, cmd)
+		}
+
+		if !strings.Contains(cmd, "[REDACTED]") {
+			t.Fatalf("Should mark the redacted credentials of %q, got:\n%s", auth, cmd)
+		}
+	}
+
+	// Cookies and API key headers are redacted whole.
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/items", nil)
+	req.Header.Set("Cookie", "session=secret-session")
+	req.Header.Set("X-Api-Key", "secret-key")
+
+	cmd, _ = client.ToCurl(req)
+	for _, line := range []string{"-H 'Cookie: [REDACTED]'", "-H 'X-Api-Key: [REDACTED]'"} {
+		if !strings.Contains(cmd, line) {
+			t.Fatalf("Should redact the header as %s, got:\n%s", line, cmd)
+		}
+	}
+}
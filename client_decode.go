@@ -0,0 +1,690 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DecodeEmbedding decodes an embeddings response read from r. Unlike
+// json.Unmarshal it parses the body as it streams in, so the raw response
+// is never held in memory, and the vectors are decoded without reflection.
+// Any vectors already held by resp.Data are reused when large enough.
+func DecodeEmbedding(r io.Reader, resp *Embedding) error {
+	var reuse [][]float64
+	for _, d := range resp.Data {
+		reuse = append(reuse, d.Embedding)
+	}
+
+	var doc embeddingDoc[float64]
+	if err := decodeEmbedding(newScanner(r), &doc, reuse); err != nil {
+		return err
+	}
+
+	resp.ID = doc.id
+	resp.Object = doc.object
+	resp.Created = doc.created
+	resp.Model = doc.model
+	resp.Usage = doc.usage
+	resp.Data = resp.Data[:0]
+
+	for _, d := range doc.data {
+		resp.Data = append(resp.Data, EmbeddingData{
+			Index:     d.index,
+			Object:    d.object,
+			Embedding: d.vector,
+		})
+	}
+
+	return nil
+}
+
+// DecodeEmbedding32 is DecodeEmbedding for float32 vectors.
+func DecodeEmbedding32(r io.Reader, resp *Embedding32) error {
+	var reuse [][]float32
+	for _, d := range resp.Data {
+		reuse = append(reuse, d.Embedding)
+	}
+
+	var doc embeddingDoc[float32]
+	if err := decodeEmbedding(newScanner(r), &doc, reuse); err != nil {
+		return err
+	}
+
+	resp.ID = doc.id
+	resp.Object = doc.object
+	resp.Created = doc.created
+	resp.Model = doc.model
+	resp.Usage = doc.usage
+	resp.Data = resp.Data[:0]
+
+	for _, d := range doc.data {
+		resp.Data = append(resp.Data, EmbeddingData32{
+			Index:     d.index,
+			Object:    d.object,
+			Embedding: d.vector,
+		})
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+type float interface {
+	float32 | float64
+}
+
+type embeddingItem[F float] struct {
+	index  int
+	object string
+	vector []F
+}
+
+type embeddingDoc[F float] struct {
+	id      string
+	object  string
+	created Time
+	model   string
+	usage   *Usage
+	data    []embeddingItem[F]
+}
+
+func decodeEmbedding[F float](s *scanner, doc *embeddingDoc[F], reuse [][]F) error {
+	err := s.object(func(key []byte) error {
+		var err error
+
+		switch string(key) {
+		case "id":
+			doc.id, err = s.stringValue()
+
+		case "object":
+			doc.object, err = s.stringValue()
+
+		case "model":
+			doc.model, err = s.stringValue()
+
+		case "created":
+			var raw []byte
+			if raw, err = s.rawValue(); err == nil && string(raw) != "null" {
+				err = doc.created.UnmarshalJSON(raw)
+			}
+
+		case "usage":
+			doc.usage, err = decodeUsage(s)
+
+		case "data":
+			err = decodeData(s, doc, reuse)
+
+		default:
+			err = s.skip()
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if s.skipSpace(); s.pos < s.end {
+		return s.syntax("unexpected data after response")
+	}
+
+	if s.err != nil && !errors.Is(s.err, io.EOF) {
+		return s.err
+	}
+
+	return nil
+}
+
+func decodeUsage(s *scanner) (*Usage, error) {
+	s.skipSpace()
+	if s.peek() == 'n' {
+		return nil, s.literal("null")
+	}
+
+	var u Usage
+	err := s.object(func(key []byte) error {
+		var field *int
+
+		switch string(key) {
+		case "prompt_tokens":
+			field = &u.PromptTokens
+		case "completion_tokens":
+			field = &u.CompletionTokens
+		case "total_tokens":
+			field = &u.TotalTokens
+		default:
+			return s.skip()
+		}
+
+		s.skipSpace()
+		if s.peek() == 'n' {
+			return s.literal("null")
+		}
+
+		f, err := s.number()
+		if err != nil {
+			return err
+		}
+
+		if f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+			return s.syntax("token count isn't an integer")
+		}
+
+		*field = int(f)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func decodeData[F float](s *scanner, doc *embeddingDoc[F], reuse [][]F) error {
+	// The dimension of the first vector is used to size the rest, so each
+	// vector is allocated once at its exact size.
+	var dim int
+
+	return s.array(func() error {
+		var item embeddingItem[F]
+
+		if n := len(doc.data); n < len(reuse) {
+			item.vector = reuse[n][:0]
+		}
+
+		if item.vector == nil && dim > 0 {
+			item.vector = make([]F, 0, dim)
+		}
+
+		err := s.object(func(key []byte) error {
+			var err error
+
+			switch string(key) {
+			case "index":
+				var f float64
+				f, err = s.number()
+				item.index = int(f)
+
+			case "object":
+				item.object, err = s.stringValue()
+
+			case "embedding":
+				item.vector, err = decodeVector(s, item.vector)
+
+			default:
+				err = s.skip()
+			}
+
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		dim = max(dim, len(item.vector))
+		doc.data = append(doc.data, item)
+
+		return nil
+	})
+}
+
+func decodeVector[F float](s *scanner, dst []F) ([]F, error) {
+	if s.skipSpace(); s.peek() == 'n' {
+		return nil, s.literal("null")
+	}
+
+	if dst == nil {
+		dst = make([]F, 0, 64)
+	}
+
+	err := s.array(func() error {
+		f, err := s.number()
+		if err != nil {
+			return err
+		}
+
+		// Float32 values are rounded from the float64 result, which can
+		// differ from direct float32 parsing by one ulp in rare halfway
+		// cases.
+		dst = append(dst, F(f))
+		return nil
+	})
+
+	return dst, err
+}
+
+// =============================================================================
+
+// scanner is a minimal pull parser for JSON over an io.Reader that works on
+// a fixed size buffer.
+type scanner struct {
+	r       io.Reader
+	buf     []byte
+	pos     int
+	end     int
+	err     error
+	offset  int
+	scratch []byte
+}
+
+func newScanner(r io.Reader) *scanner {
+	return &scanner{
+		r:   r,
+		buf: make([]byte, 32<<10),
+	}
+}
+
+func (s *scanner) fill() bool {
+	if s.err != nil {
+		return false
+	}
+
+	s.offset += s.end
+	s.pos, s.end = 0, 0
+
+	for s.end == 0 {
+		n, err := s.r.Read(s.buf)
+		s.end = n
+
+		if err != nil {
+			s.err = err
+			return n > 0
+		}
+	}
+
+	return true
+}
+
+// peek returns the next byte without consuming it, or zero at the end of
+// the input.
+func (s *scanner) peek() byte {
+	if s.pos == s.end && !s.fill() {
+		return 0
+	}
+	return s.buf[s.pos]
+}
+
+func (s *scanner) next() byte {
+	c := s.peek()
+	if s.pos < s.end {
+		s.pos++
+	}
+	return c
+}
+
+func (s *scanner) skipSpace() {
+	for {
+		switch s.peek() {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) syntax(msg string) error {
+	if s.err != nil && !errors.Is(s.err, io.EOF) {
+		return s.err
+	}
+	return fmt.Errorf("decoding: offset %d: %s", s.offset+s.pos, msg)
+}
+
+func (s *scanner) expect(c byte) error {
+	s.skipSpace()
+	if s.next() != c {
+		return s.syntax(fmt.Sprintf("expected %q", c))
+	}
+	return nil
+}
+
+func (s *scanner) literal(lit string) error {
+	for i := 0; i < len(lit); i++ {
+		if s.next() != lit[i] {
+			return s.syntax("invalid literal")
+		}
+	}
+	return nil
+}
+
+// object calls fn for every key of an object. The key is only valid until
+// fn returns and fn must consume the value.
+func (s *scanner) object(fn func(key []byte) error) error {
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+
+	if s.skipSpace(); s.peek() == '}' {
+		s.pos++
+		return nil
+	}
+
+	for {
+		s.skipSpace()
+		if s.peek() != '"' {
+			return s.syntax("expected object key")
+		}
+
+		key, err := s.str()
+		if err != nil {
+			return err
+		}
+
+		if err := s.expect(':'); err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		if err := fn(key); err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		switch s.next() {
+		case ',':
+		case '}':
+			return nil
+		default:
+			return s.syntax("expected ',' or '}'")
+		}
+	}
+}
+
+// array calls fn for every element of an array. fn must consume the element.
+func (s *scanner) array(fn func() error) error {
+	if err := s.expect('['); err != nil {
+		return err
+	}
+
+	if s.skipSpace(); s.peek() == ']' {
+		s.pos++
+		return nil
+	}
+
+	for {
+		s.skipSpace()
+		if err := fn(); err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		switch s.next() {
+		case ',':
+		case ']':
+			return nil
+		default:
+			return s.syntax("expected ',' or ']'")
+		}
+	}
+}
+
+// str reads a string into the scratch buffer, resolving escapes. The result
+// is only valid until the next call.
+func (s *scanner) str() ([]byte, error) {
+	if s.next() != '"' {
+		return nil, s.syntax("expected string")
+	}
+
+	s.scratch = s.scratch[:0]
+
+	for {
+		// Copy runs of plain bytes straight from the buffer.
+		start := s.pos
+		for s.pos < s.end && s.buf[s.pos] != '"' && s.buf[s.pos] != '\\' && s.buf[s.pos] >= 0x20 {
+			s.pos++
+		}
+		s.scratch = append(s.scratch, s.buf[start:s.pos]...)
+
+		switch c := s.next(); c {
+		case '"':
+			return s.scratch, nil
+
+		case '\\':
+			if err := s.escape(); err != nil {
+				return nil, err
+			}
+
+		case 0:
+			if s.pos == s.end && s.err != nil {
+				return nil, s.syntax("unterminated string")
+			}
+			return nil, s.syntax("invalid character in string")
+
+		default:
+			if c < 0x20 {
+				return nil, s.syntax("invalid character in string")
+			}
+
+			// A plain byte that was split across buffer fills.
+			s.scratch = append(s.scratch, c)
+		}
+	}
+}
+
+func (s *scanner) escape() error {
+	c := s.next()
+
+	switch c {
+	case '"', '\\', '/':
+		s.scratch = append(s.scratch, c)
+	case 'b':
+		s.scratch = append(s.scratch, '\b')
+	case 'f':
+		s.scratch = append(s.scratch, '\f')
+	case 'n':
+		s.scratch = append(s.scratch, '\n')
+	case 'r':
+		s.scratch = append(s.scratch, '\r')
+	case 't':
+		s.scratch = append(s.scratch, '\t')
+
+	case 'u':
+		r, ok := s.hex4()
+		if !ok {
+			return s.syntax("invalid unicode escape")
+		}
+
+		if utf16.IsSurrogate(r) {
+			r2 := utf8.RuneError
+			if s.peek() == '\\' {
+				s.pos++
+				if s.next() == 'u' {
+					r2, _ = s.hex4()
+				}
+			}
+			r = utf16.DecodeRune(r, r2)
+		}
+
+		s.scratch = utf8.AppendRune(s.scratch, r)
+
+	default:
+		return s.syntax("invalid escape")
+	}
+
+	return nil
+}
+
+func (s *scanner) hex4() (rune, bool) {
+	var r rune
+	for range 4 {
+		c := s.next()
+		switch {
+		case c >= '0' && c <= '9':
+			r = r<<4 | rune(c-'0')
+		case c >= 'a' && c <= 'f':
+			r = r<<4 | rune(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			r = r<<4 | rune(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return r, true
+}
+
+// stringValue reads a string or null value.
+func (s *scanner) stringValue() (string, error) {
+	if s.peek() == 'n' {
+		return "", s.literal("null")
+	}
+
+	b, err := s.str()
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// pow10 holds the powers of ten that are exact in a float64.
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// number reads a JSON number. Numbers whose digits fit in 53 bits with a
+// small exponent are converted exactly with a single multiply or divide,
+// everything else goes through strconv.
+func (s *scanner) number() (float64, error) {
+	s.scratch = s.scratch[:0]
+
+	var mant uint64
+	var digits, exp10 int
+	var neg, dot, slow bool
+
+	if s.peek() == '-' {
+		neg = true
+		s.scratch = append(s.scratch, s.next())
+	}
+
+loop:
+	for {
+		c := s.peek()
+
+		switch {
+		case c >= '0' && c <= '9':
+			s.pos++
+			s.scratch = append(s.scratch, c)
+
+			if mant == 0 && c == '0' {
+				if dot {
+					exp10--
+				}
+				continue
+			}
+
+			if digits < 19 {
+				mant = mant*10 + uint64(c-'0')
+				digits++
+				if dot {
+					exp10--
+				}
+				continue
+			}
+
+			slow = true
+
+		case c == '.':
+			if dot {
+				return 0, s.syntax("invalid number")
+			}
+			s.pos++
+			dot = true
+			s.scratch = append(s.scratch, c)
+
+		case c == 'e' || c == 'E' || c == '+' || (c == '-' && len(s.scratch) > 0):
+			s.pos++
+			slow = true
+			s.scratch = append(s.scratch, c)
+
+		default:
+			break loop
+		}
+	}
+
+	if len(s.scratch) == 0 || (neg && len(s.scratch) == 1) {
+		return 0, s.syntax("invalid number")
+	}
+
+	if !slow && mant < 1<<53 && -exp10 < len(pow10) {
+		f := float64(mant) / pow10[-exp10]
+		if neg {
+			f = -f
+		}
+		return f, nil
+	}
+
+	f, err := strconv.ParseFloat(string(s.scratch), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, s.syntax("invalid number")
+	}
+
+	if math.IsInf(f, 0) {
+		return 0, s.syntax("number out of range")
+	}
+
+	return f, nil
+}
+
+// rawValue returns the bytes of a scalar value. The result is only valid
+// until the next call.
+func (s *scanner) rawValue() ([]byte, error) {
+	switch s.peek() {
+	case '"':
+		b, err := s.str()
+		if err != nil {
+			return nil, err
+		}
+
+		raw := make([]byte, 0, len(b)+2)
+		raw = append(raw, '"')
+		raw = append(raw, b...)
+		raw = append(raw, '"')
+		return raw, nil
+
+	case 'n':
+		return []byte("null"), s.literal("null")
+	}
+
+	if _, err := s.number(); err != nil {
+		return nil, err
+	}
+
+	return s.scratch, nil
+}
+
+// skip consumes a value of any type.
+func (s *scanner) skip() error {
+	s.skipSpace()
+
+	switch c := s.peek(); {
+	case c == '{':
+		return s.object(func([]byte) error { return s.skip() })
+
+	case c == '[':
+		return s.array(s.skip)
+
+	case c == '"':
+		_, err := s.str()
+		return err
+
+	case c == 't':
+		return s.literal("true")
+
+	case c == 'f':
+		return s.literal("false")
+
+	case c == 'n':
+		return s.literal("null")
+
+	default:
+		_, err := s.number()
+		return err
+	}
+}
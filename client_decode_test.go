@@ -0,0 +1,236 @@
+package client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_DecodeEmbedding(t *testing.T) {
+	t.Run("random", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(7))
+
+		for i := range 20 {
+			body := embeddingBody(rng, 1+rng.Intn(16), 1+rng.Intn(300))
+
+			var exp client.Embedding
+			if err := json.Unmarshal(body, &exp); err != nil {
+				t.Fatalf("Should be able to unmarshal payload %d: %s", i, err)
+			}
+
+			// One byte reads make every token straddle a buffer fill.
+			readers := map[string]io.Reader{
+				"full":     bytes.NewReader(body),
+				"one-byte": iotest.OneByteReader(bytes.NewReader(body)),
+			}
+
+			for name, r := range readers {
+				var got client.Embedding
+				if err := client.DecodeEmbedding(r, &got); err != nil {
+					t.Fatalf("Should be able to decode payload %d (%s): %s", i, name, err)
+				}
+
+				if diff := cmp.Diff(got, exp); diff != "" {
+					t.Fatalf("Should get the json.Unmarshal result for payload %d (%s), diff:\n%s", i, name, diff)
+				}
+			}
+		}
+	})
+
+	t.Run("float32", func(t *testing.T) {
+		body := embeddingBody(rand.New(rand.NewSource(11)), 8, 256)
+
+		var exp client.Embedding32
+		if err := json.Unmarshal(body, &exp); err != nil {
+			t.Fatalf("Should be able to unmarshal the payload: %s", err)
+		}
+
+		var got client.Embedding32
+		if err := client.DecodeEmbedding32(bytes.NewReader(body), &got); err != nil {
+			t.Fatalf("Should be able to decode the payload: %s", err)
+		}
+
+		if len(got.Data) != len(exp.Data) {
+			t.Fatalf("Should get %d vectors, got %d", len(exp.Data), len(got.Data))
+		}
+
+		for i := range exp.Data {
+			for j, want := range exp.Data[i].Embedding {
+				have := got.Data[i].Embedding[j]
+				if have != want && have != math.Nextafter32(want, have) {
+					t.Fatalf("Should get %v within one ulp at [%d][%d], got %v", want, i, j, have)
+				}
+			}
+		}
+	})
+
+	t.Run("shapes", func(t *testing.T) {
+		body := `{
+			"id": "emb-é😀\n",
+			"object": "list",
+			"created": "1717439154",
+			"model": null,
+			"usage": {"prompt_tokens": 3, "nested": [true, false, null, {"a": [1.5e3]}]},
+			"data": [
+				{"status": "success", "index": 1, "object": "embedding", "embedding": [1E2, -0.0, 2.5e-3, 123456789012345678901234]},
+				{"index": 0, "object": "embedding", "embedding": null}
+			]
+		}`
+
+		var exp client.Embedding
+		if err := json.Unmarshal([]byte(body), &exp); err != nil {
+			t.Fatalf("Should be able to unmarshal the payload: %s", err)
+		}
+
+		var got client.Embedding
+		if err := client.DecodeEmbedding(strings.NewReader(body), &got); err != nil {
+			t.Fatalf("Should be able to decode the payload: %s", err)
+		}
+
+		if diff := cmp.Diff(got, exp); diff != "" {
+			t.Fatalf("Should get the json.Unmarshal result, diff:\n%s", diff)
+		}
+
+		if math.Signbit(got.Data[0].Embedding[1]) != math.Signbit(exp.Data[0].Embedding[1]) {
+			t.Fatalf("Should keep the sign of negative zero")
+		}
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		body := embeddingBody(rand.New(rand.NewSource(3)), 4, 32)
+
+		var resp client.Embedding
+		if err := client.DecodeEmbedding(bytes.NewReader(body), &resp); err != nil {
+			t.Fatalf("Should be able to decode the payload: %s", err)
+		}
+		first := &resp.Data[0].Embedding[0]
+
+		if err := client.DecodeEmbedding(bytes.NewReader(body), &resp); err != nil {
+			t.Fatalf("Should be able to decode the payload again: %s", err)
+		}
+
+		if &resp.Data[0].Embedding[0] != first {
+			t.Fatalf("Should reuse the existing vectors")
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		tests := []string{
+			``,
+			`[]`,
+			`{"data": [`,
+			`{"data": [{"embedding": [1, 2,]}]}`,
+			`{"data": [{"embedding": [1 2]}]}`,
+			`{"data": [{"embedding": ["1"]}]}`,
+			`{"data": [{"embedding": [-]}]}`,
+			`{"data": [{"embedding": [1e999]}]}`,
+			`{"id": "abc`,
+			`{"id": "\x"}`,
+			`{"id": "a` + "\n" + `"}`,
+			`{"id" "a"}`,
+			`{"object": "list"} {}`,
+			`{"usage": tru}`,
+		}
+
+		for _, body := range tests {
+			var resp client.Embedding
+			if err := client.DecodeEmbedding(strings.NewReader(body), &resp); err == nil {
+				t.Errorf("Should fail to decode %q", body)
+			}
+		}
+	})
+}
+
+// =============================================================================
+
+func Benchmark_DecodeEmbedding(b *testing.B) {
+	sizes := []struct {
+		n   int
+		dim int
+	}{
+		{64, 1024},
+		{256, 1024},
+	}
+
+	for _, size := range sizes {
+		body := embeddingBody(rand.New(rand.NewSource(1)), size.n, size.dim)
+		name := fmt.Sprintf("%dx%d", size.n, size.dim)
+
+		b.Run(name+"/unmarshal", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+
+			for range b.N {
+				data, err := io.ReadAll(bytes.NewReader(body))
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var resp client.Embedding
+				if err := json.Unmarshal(data, &resp); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(name+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+
+			for range b.N {
+				var resp client.Embedding
+				if err := client.DecodeEmbedding(bytes.NewReader(body), &resp); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// embeddingBody renders a response the way the service does, with vectors
+// of n normally distributed values printed at full precision.
+func embeddingBody(rng *rand.Rand, n int, dim int) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(`{"id":"emb-0d9d7a6b-8b0e-4e2c-9b0a-3f1c6a2f7e11","object":"list","created":1717439154,"model":"multilingual-e5-large-instruct","data":[`)
+
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		fmt.Fprintf(&b, `{"status":"success","index":%d,"object":"embedding","embedding":[`, i)
+
+		for j := range dim {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+
+			f := rng.NormFloat64() / 30
+			switch rng.Intn(20) {
+			case 0:
+				f *= 1e-6
+			case 1:
+				f = float64(rng.Intn(5))
+			}
+
+			data, _ := json.Marshal(f)
+			b.Write(data)
+		}
+
+		b.WriteString(`]}`)
+	}
+
+	b.WriteString(`]}`)
+
+	return b.Bytes()
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// EmbedConfig defines how EmbedAll and EmbedStream split and send inputs.
+type EmbedConfig struct {
+	// BatchSize is the maximum number of inputs per request.
+	BatchSize int
+
+	// BatchBytes is the maximum encoded size of the inputs per request. An
+	// input larger than this is sent in a batch of its own.
+	BatchBytes int
+
+	// Concurrency is the number of requests in flight at once.
+	Concurrency int
+
+	// Retries is the number of times a batch that failed with a network
+	// error, a rate limit or a server error is retried. A negative value
+	// disables retries.
+	Retries int
+
+	// Backoff is the wait before the first retry. It doubles each retry.
+	Backoff time.Duration
+
+	// Options are extra fields sent with every request, such as
+	// "truncate" and "truncate_direction".
+	Options D
+
+	// Progress is called after each batch completes with the number of
+	// inputs embedded so far and the total. Calls are serialized.
+	Progress func(done int, total int)
+}
+
+// Default values used by EmbedAll and EmbedStream when the config is empty.
+const (
+	DefaultEmbedBatchSize   = 64
+	DefaultEmbedBatchBytes  = 1 << 20
+	DefaultEmbedConcurrency = 4
+	DefaultEmbedRetries     = 2
+	DefaultEmbedBackoff     = 500 * time.Millisecond
+)
+
+// EmbedBatch represents the vectors for a contiguous run of inputs starting
+// at Offset, or the error that stopped the batch.
+type EmbedBatch struct {
+	Offset  int
+	Vectors [][]float64
+	Err     error
+}
+
+// EmbedAll embeds any number of inputs by splitting them into batches and
+// sending them concurrently. Each input is a D such as {"text": ...} or
+// {"text": ..., "image": ...}. The vectors are returned in input order.
+func (cln *Client) EmbedAll(ctx context.Context, endpoint string, model string, inputs []D, cfg EmbedConfig) ([][]float64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	vectors := make([][]float64, len(inputs))
+
+	for batch := range cln.EmbedStream(ctx, endpoint, model, inputs, cfg) {
+		if batch.Err != nil {
+			return nil, batch.Err
+		}
+
+		copy(vectors[batch.Offset:], batch.Vectors)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return vectors, nil
+}
+
+// EmbedStream embeds the inputs like EmbedAll but delivers each batch as it
+// completes, so very large corpora can be processed without holding every
+// vector in memory. Batches arrive in completion order, use Offset to place
+// them. A batch with an error is the last one sent. The channel is closed
+// when all batches are done or the context is canceled. A caller that stops
+// reading before the channel is closed must cancel the context, otherwise
+// the goroutines sending the batches block forever.
+func (cln *Client) EmbedStream(ctx context.Context, endpoint string, model string, inputs []D, cfg EmbedConfig) <-chan EmbedBatch {
+	cfg = embedDefaults(cfg)
+
+	ch := make(chan EmbedBatch, cfg.Concurrency)
+
+	batches, err := planBatches(inputs, cfg)
+	if err != nil {
+		ch <- EmbedBatch{Err: err}
+		close(ch)
+		return ch
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	jobs := make(chan [2]int)
+	go func() {
+		defer close(jobs)
+		for _, b := range batches {
+			select {
+			case jobs <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var done int
+
+	var wg sync.WaitGroup
+	wg.Add(cfg.Concurrency)
+
+	for range cfg.Concurrency {
+		go func() {
+			defer wg.Done()
+
+			for b := range jobs {
+				batch := EmbedBatch{Offset: b[0]}
+				batch.Vectors, batch.Err = cln.embedBatch(ctx, endpoint, model, inputs[b[0]:b[1]], cfg)
+
+				if batch.Err != nil {
+					batch.Err = fmt.Errorf("embed inputs %d-%d: %w", b[0], b[1]-1, batch.Err)
+				}
+
+				if batch.Err == nil && cfg.Progress != nil {
+					mu.Lock()
+					done += b[1] - b[0]
+					cfg.Progress(done, len(inputs))
+					mu.Unlock()
+				}
+
+				select {
+				case ch <- batch:
+				case <-ctx.Done():
+					return
+				}
+
+				if batch.Err != nil {
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// =============================================================================
+
+func (cln *Client) embedBatch(ctx context.Context, endpoint string, model string, inputs []D, cfg EmbedConfig) ([][]float64, error) {
+	d := D{
+		"model": model,
+		"input": inputs,
+	}
+
+	for k, v := range cfg.Options {
+		d[k] = v
+	}
+
+	backoff := cfg.Backoff
+
+	for attempt := 0; ; attempt++ {
+		var resp Embedding
+		err := cln.Do(ctx, http.MethodPost, endpoint, d, &resp)
+		if err == nil {
+			return orderVectors(resp, len(inputs))
+		}
+
+		if attempt >= cfg.Retries || !retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		cln.log(ctx, "embedbatch: retry", "attempt", attempt+1, "ERROR", err)
+		cln.retry(ctx, http.MethodPost, endpoint, d, attempt+1, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a failed request may succeed when sent again,
+// which is the case for network failures, rate limits and server errors.
+func retryable(err error) bool {
+	status := statusOf(err)
+	if status == 0 {
+		var ue *url.Error
+		return errors.As(err, &ue)
+	}
+
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// orderVectors places the vectors of the response in input order using
+// EmbeddingData.Index.
+func orderVectors(resp Embedding, n int) ([][]float64, error) {
+	vectors := make([][]float64, n)
+
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= n {
+			return nil, fmt.Errorf("unexpected embedding index %d", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("missing embedding index %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+// planBatches splits the inputs into [start, end) ranges that respect the
+// batch size and byte limits.
+func planBatches(inputs []D, cfg EmbedConfig) ([][2]int, error) {
+	var batches [][2]int
+
+	start, size := 0, 0
+	for i, input := range inputs {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return nil, fmt.Errorf("encoding input %d: %w", i, err)
+		}
+
+		if i > start && (i-start >= cfg.BatchSize || size+len(data) > cfg.BatchBytes) {
+			batches = append(batches, [2]int{start, i})
+			start, size = i, 0
+		}
+
+		size += len(data)
+	}
+
+	if start < len(inputs) {
+		batches = append(batches, [2]int{start, len(inputs)})
+	}
+
+	return batches, nil
+}
+
+func embedDefaults(cfg EmbedConfig) EmbedConfig {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultEmbedBatchSize
+	}
+
+	if cfg.BatchBytes <= 0 {
+		cfg.BatchBytes = DefaultEmbedBatchBytes
+	}
+
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultEmbedConcurrency
+	}
+
+	switch {
+	case cfg.Retries == 0:
+		cfg.Retries = DefaultEmbedRetries
+	case cfg.Retries < 0:
+		cfg.Retries = 0
+	}
+
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultEmbedBackoff
+	}
+
+	return cfg
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Set of errors returned when building an embedding request.
+var (
+	ErrModelNotFound   = errors.New("model not found")
+	ErrModelCapability = errors.New("model lacks the capability")
+)
+
+// EmbeddingInput represents one input to embed: text, an image, text and an
+// image together, or a pre-tokenized array of token ids. Use the New*Input
+// functions to construct one.
+type EmbeddingInput struct {
+	Text   string
+	Image  Image
+	Tokens []int
+}
+
+// NewTextInput constructs an input that embeds the text.
+func NewTextInput(text string) EmbeddingInput {
+	return EmbeddingInput{Text: text}
+}
+
+// NewImageInput constructs an input that embeds the image.
+func NewImageInput(img Image) EmbeddingInput {
+	return EmbeddingInput{Image: img}
+}
+
+// NewTextImageInput constructs an input that embeds the text and image as a
+// pair.
+func NewTextImageInput(text string, img Image) EmbeddingInput {
+	return EmbeddingInput{Text: text, Image: img}
+}
+
+// NewTokensInput constructs an input that embeds the token ids, such as those
+// returned by the tokenize endpoint.
+func NewTokensInput(tokens []int) EmbeddingInput {
+	return EmbeddingInput{Tokens: tokens}
+}
+
+func (in EmbeddingInput) isTokens() bool {
+	return in.Tokens != nil
+}
+
+// =============================================================================
+
+// EmbeddingRequest represents a typed request to the embeddings endpoint.
+// Token inputs can't be mixed with text or image inputs in one request.
+type EmbeddingRequest struct {
+	Model string
+	Input []EmbeddingInput
+
+	// Truncate asks the server to cut inputs longer than the model's
+	// context instead of failing.
+	Truncate bool
+
+	// Direction is the side inputs are cut from when truncating. The
+	// server default is used when it is unset.
+	Direction Direction
+}
+
+// Validate checks the request is well formed and that a model with the
+// specified capabilities can serve it. Inputs with an image need
+// EmbeddingWithImage, all other inputs need Embedding or EmbeddingWithImage.
+func (req EmbeddingRequest) Validate(caps ModelCapabilities) error {
+	if req.Model == "" {
+		return errors.New("model is required")
+	}
+
+	if len(req.Input) == 0 {
+		return errors.New("at least one input is required")
+	}
+
+	var images bool
+	tokens := req.Input[0].isTokens()
+
+	for i, in := range req.Input {
+		if in.isTokens() != tokens {
+			return fmt.Errorf("input %d: token inputs can't be mixed with text or image inputs", i)
+		}
+
+		switch {
+		case in.isTokens():
+			if len(in.Tokens) == 0 || in.Text != "" || in.Image != nil {
+				return fmt.Errorf("input %d: token inputs need tokens and nothing else", i)
+			}
+
+		case in.Text == "" && in.Image == nil:
+			return fmt.Errorf("input %d: input is empty", i)
+		}
+
+		if in.Image != nil {
+			images = true
+		}
+	}
+
+	switch {
+	case images && !caps.EmbeddingWithImage:
+		return fmt.Errorf("model %q, capability %q: %w", req.Model, Capabilities.EmbeddingWithImage, ErrModelCapability)
+
+	case !caps.Embedding && !caps.EmbeddingWithImage:
+		return fmt.Errorf("model %q, capability %q: %w", req.Model, Capabilities.Embedding, ErrModelCapability)
+	}
+
+	return nil
+}
+
+// Body returns the request as the document sent to the embeddings endpoint.
+// Images are encoded as base64.
+func (req EmbeddingRequest) Body(ctx context.Context) (D, error) {
+	d := D{
+		"model": req.Model,
+	}
+
+	if req.Truncate {
+		d["truncate"] = true
+	}
+
+	if req.Direction.String() != "" {
+		d["truncate_direction"] = req.Direction
+	}
+
+	if len(req.Input) > 0 && req.Input[0].isTokens() {
+		input := make([][]int, len(req.Input))
+		for i, in := range req.Input {
+			input[i] = in.Tokens
+		}
+
+		d["input"] = input
+		return d, nil
+	}
+
+	input := make([]D, len(req.Input))
+	for i, in := range req.Input {
+		item := D{}
+
+		if in.Text != "" {
+			item["text"] = in.Text
+		}
+
+		if in.Image != nil {
+			base64, err := in.Image.EncodeBase64(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("input %d: encode image: %w", i, err)
+			}
+			item["image"] = base64
+		}
+
+		input[i] = item
+	}
+
+	d["input"] = input
+
+	return d, nil
+}
+
+// =============================================================================
+
+// DefaultModelTTL is how long the models listed by a host are cached when
+// the client isn't constructed with WithModelTTL.
+const DefaultModelTTL = 10 * time.Minute
+
+// WithModelTTL sets how long ModelCapabilities caches the models listed by a
+// host, and the absence of a model. A ttl of zero or less looks the models up
+// on every call.
+func WithModelTTL(ttl time.Duration) func(cln *Client) {
+	return func(cln *Client) {
+		cln.modelTTL = ttl
+	}
+}
+
+// modelEntry is the cached lookup of a model, which expires so models added
+// to or removed from the host are picked up.
+type modelEntry struct {
+	caps    ModelCapabilities
+	found   bool
+	expires time.Time
+}
+
+// ModelCapabilities returns the capabilities of the model as listed by the
+// models endpoint of the host. Results, including a missing model, are cached
+// for the model ttl of the client.
+func (cln *Client) ModelCapabilities(ctx context.Context, host string, model string) (ModelCapabilities, error) {
+	key := host + "\x00" + model
+
+	if v, ok := cln.models.Load(key); ok {
+		if e := v.(modelEntry); time.Now().Before(e.expires) {
+			if !e.found {
+				return ModelCapabilities{}, fmt.Errorf("model %q: %w", model, ErrModelNotFound)
+			}
+			return e.caps, nil
+		}
+	}
+
+	var resp ModelResponse
+	if err := cln.Do(ctx, http.MethodGet, host+"/models", nil, &resp); err != nil {
+		return ModelCapabilities{}, fmt.Errorf("models: %w", err)
+	}
+
+	expires := time.Now().Add(cln.modelTTL)
+
+	var found *ModelCapabilities
+	for _, m := range resp.Data {
+		cln.models.Store(host+"\x00"+m.ID, modelEntry{caps: m.Capabilities, found: true, expires: expires})
+		if m.ID == model {
+			found = &m.Capabilities
+		}
+	}
+
+	if found == nil {
+		cln.models.Store(key, modelEntry{expires: expires})
+		return ModelCapabilities{}, fmt.Errorf("model %q: %w", model, ErrModelNotFound)
+	}
+
+	return *found, nil
+}
+
+// Embed validates the request against the capabilities of the model and
+// sends it to the embeddings endpoint of the host.
+func (cln *Client) Embed(ctx context.Context, host string, req EmbeddingRequest) (Embedding, error) {
+	caps, err := cln.ModelCapabilities(ctx, host, req.Model)
+	if err != nil {
+		return Embedding{}, err
+	}
+
+	if err := req.Validate(caps); err != nil {
+		return Embedding{}, err
+	}
+
+	d, err := req.Body(ctx)
+	if err != nil {
+		return Embedding{}, err
+	}
+
+	var resp Embedding
+	if err := cln.Do(ctx, http.MethodPost, host+"/embeddings", d, &resp); err != nil {
+		return Embedding{}, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,186 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_EmbeddingRequest(t *testing.T) {
+	ctx := context.Background()
+
+	var modelCalls atomic.Int32
+	bodies := make(chan string, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /models", func(w http.ResponseWriter, r *http.Request) {
+		modelCalls.Add(1)
+		fmt.Fprint(w, `{"object":"list","data":[
+			{"id":"bridgetower","capabilities":{"embedding":true,"embedding_with_image":true}},
+			{"id":"multilingual","capabilities":{"embedding":true}},
+			{"id":"hermes","capabilities":{"chat_completion":true}}
+		]}`)
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies <- string(data)
+		fmt.Fprint(w, `{"id":"emb-1","object":"embedding_batch","created":1717439154,"model":"bridgetower","data":[{"index":0,"object":"embedding","embedding":[0.5,0.25]}]}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key")
+
+	img := client.NewImageBase64("data:image/png;base64,aGVsbG8=")
+
+	t.Run("body", func(t *testing.T) {
+		tests := []struct {
+			name string
+			req  client.EmbeddingRequest
+			json string
+		}{
+			{
+				name: "text-image",
+				req: client.EmbeddingRequest{
+					Model:     "bridgetower",
+					Input:     []client.EmbeddingInput{client.NewTextImageInput("A rose", img), client.NewTextInput("A tulip"), client.NewImageInput(img)},
+					Truncate:  true,
+					Direction: client.Directions.Right,
+				},
+				json: `{"input":[{"image":"aGVsbG8=","text":"A rose"},{"text":"A tulip"},{"image":"aGVsbG8="}],"model":"bridgetower","truncate":true,"truncate_direction":"Right"}`,
+			},
+			{
+				name: "tokens",
+				req: client.EmbeddingRequest{
+					Model: "multilingual",
+					Input: []client.EmbeddingInput{client.NewTokensInput([]int{0, 3293, 2}), client.NewTokensInput([]int{0, 2})},
+				},
+				json: `{"input":[[0,3293,2],[0,2]],"model":"multilingual"}`,
+			},
+		}
+
+		for _, tt := range tests {
+			d, err := tt.req.Body(ctx)
+			if err != nil {
+				t.Fatalf("%s: Should be able to build the body: %s", tt.name, err)
+			}
+
+			data, _ := json.Marshal(d)
+			if string(data) != tt.json {
+				t.Fatalf("%s: Should get the expected json\ngot: %s\nexp: %s", tt.name, data, tt.json)
+			}
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		text := client.ModelCapabilities{Embedding: true}
+		image := client.ModelCapabilities{EmbeddingWithImage: true}
+		chat := client.ModelCapabilities{ChatCompletion: true}
+
+		tests := []struct {
+			name  string
+			input []client.EmbeddingInput
+			caps  client.ModelCapabilities
+			err   error
+			valid bool
+		}{
+			{"text", []client.EmbeddingInput{client.NewTextInput("a")}, text, nil, true},
+			{"text-on-image-model", []client.EmbeddingInput{client.NewTextInput("a")}, image, nil, true},
+			{"image", []client.EmbeddingInput{client.NewImageInput(img)}, image, nil, true},
+			{"image-on-text-model", []client.EmbeddingInput{client.NewTextImageInput("a", img)}, text, client.ErrModelCapability, false},
+			{"chat-model", []client.EmbeddingInput{client.NewTokensInput([]int{1})}, chat, client.ErrModelCapability, false},
+			{"mixed", []client.EmbeddingInput{client.NewTextInput("a"), client.NewTokensInput([]int{1})}, text, nil, false},
+			{"empty-input", []client.EmbeddingInput{{}}, text, nil, false},
+			{"empty-tokens", []client.EmbeddingInput{client.NewTokensInput([]int{})}, text, nil, false},
+			{"no-input", nil, text, nil, false},
+		}
+
+		for _, tt := range tests {
+			err := client.EmbeddingRequest{Model: "m", Input: tt.input}.Validate(tt.caps)
+
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("%s: Should be valid: %s", tt.name, err)
+				}
+				continue
+			}
+
+			if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("%s: Should fail with %v, got %v", tt.name, tt.err, err)
+			}
+		}
+	})
+
+	t.Run("embed", func(t *testing.T) {
+		modelCalls.Store(0)
+
+		req := client.EmbeddingRequest{
+			Model: "bridgetower",
+			Input: []client.EmbeddingInput{client.NewTextImageInput("A rose", img)},
+		}
+
+		for range 2 {
+			resp, err := cln.Embed(ctx, srv.URL, req)
+			if err != nil {
+				t.Fatalf("Should be able to embed: %s", err)
+			}
+
+			if len(resp.Data) != 1 || len(resp.Data[0].Embedding) != 2 {
+				t.Fatalf("Should get one vector, got %+v", resp.Data)
+			}
+
+			<-bodies
+		}
+
+		if modelCalls.Load() != 1 {
+			t.Fatalf("Should look up the models once, got %d", modelCalls.Load())
+		}
+
+		// The other models were cached by the first lookup.
+		req.Model = "multilingual"
+		if _, err := cln.Embed(ctx, srv.URL, req); !errors.Is(err, client.ErrModelCapability) {
+			t.Fatalf("Should reject images for a text model, got %v", err)
+		}
+
+		req.Model = "missing"
+		for range 2 {
+			if _, err := cln.Embed(ctx, srv.URL, req); !errors.Is(err, client.ErrModelNotFound) {
+				t.Fatalf("Should fail for an unknown model, got %v", err)
+			}
+		}
+
+		if modelCalls.Load() != 2 {
+			t.Fatalf("Should cache the unknown model, got %d lookups", modelCalls.Load())
+		}
+
+		if len(bodies) != 0 {
+			t.Fatalf("Should not send rejected requests")
+		}
+	})
+
+	t.Run("models-expire", func(t *testing.T) {
+		modelCalls.Store(0)
+
+		cln := client.New(logger, "key", client.WithModelTTL(0))
+
+		for range 2 {
+			if _, err := cln.ModelCapabilities(ctx, srv.URL, "bridgetower"); err != nil {
+				t.Fatalf("Should be able to look up the model: %s", err)
+			}
+		}
+
+		if modelCalls.Load() != 2 {
+			t.Fatalf("Should look up the models again once they expire, got %d", modelCalls.Load())
+		}
+	})
+}
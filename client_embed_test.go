@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_EmbedAll(t *testing.T) {
+	var calls, failures atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		var body struct {
+			Input []struct {
+				Text string `json:"text"`
+			} `json:"input"`
+			Truncate bool `json:"truncate"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if len(body.Input) > 8 || !body.Truncate {
+			http.Error(w, `{"error":"bad batch"}`, http.StatusBadRequest)
+			return
+		}
+
+		// Fail the first attempt of the batch holding input 20 to force
+		// a retry.
+		var has20 bool
+		for _, in := range body.Input {
+			has20 = has20 || in.Text == "20"
+		}
+
+		if has20 && failures.Add(1) == 1 {
+			http.Error(w, `{"error":"try again"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		// Return the data in reverse to check the vectors are reordered.
+		var resp client.Embedding
+		for i := len(body.Input) - 1; i >= 0; i-- {
+			n, _ := strconv.Atoi(body.Input[i].Text)
+			resp.Data = append(resp.Data, client.EmbeddingData{Index: i, Embedding: []float64{float64(n)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "some-key")
+
+	inputs := make([]client.D, 100)
+	for i := range inputs {
+		inputs[i] = client.D{"text": strconv.Itoa(i)}
+	}
+
+	var lastDone int
+	cfg := client.EmbedConfig{
+		BatchSize:   10,
+		BatchBytes:  100,
+		Concurrency: 3,
+		Backoff:     time.Millisecond,
+		Options:     client.D{"truncate": true},
+		Progress: func(done int, total int) {
+			if done < lastDone || total != 100 {
+				t.Errorf("Should get increasing progress, got %d/%d", done, total)
+			}
+			lastDone = done
+		},
+	}
+
+	vectors, err := cln.EmbedAll(context.Background(), srv.URL+"/embeddings", "multilingual-e5-large-instruct", inputs, cfg)
+	if err != nil {
+		t.Fatalf("Should be able to embed all: %s", err)
+	}
+
+	for i, v := range vectors {
+		if len(v) != 1 || v[0] != float64(i) {
+			t.Fatalf("Should get vectors in input order, got %v at %d", v, i)
+		}
+	}
+
+	if lastDone != 100 {
+		t.Fatalf("Should report full progress, got %d", lastDone)
+	}
+
+	if failures.Load() != 2 {
+		t.Fatalf("Should retry the failed batch once, got %d attempts", failures.Load())
+	}
+
+	// Inputs encode to 12 or 13 bytes, so 100 bytes makes 15 batches plus
+	// the one retry.
+	if calls.Load() != 16 {
+		t.Fatalf("Should make 16 calls, got %d", calls.Load())
+	}
+
+	cfg.Options = nil
+	cfg.Concurrency = 1
+	calls.Store(0)
+
+	if _, err := cln.EmbedAll(context.Background(), srv.URL+"/embeddings", "multilingual-e5-large-instruct", inputs, cfg); client.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("Should get the bad request error for a failed batch, got %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("Should not retry a bad request, got %d calls", calls.Load())
+	}
+
+	cfg.Retries = -1
+
+	if _, err := cln.EmbedAll(context.Background(), srv.URL+"/embeddings", "multilingual-e5-large-instruct", inputs, cfg); err == nil {
+		t.Fatalf("Should get an error for a failed batch")
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// WithSingleflight makes the client share one network call among identical
+// requests that are in flight at the same time. Requests are identical when
+// they have the same method, endpoint and body, ignoring the order of keys.
+// Every waiter gets its own copy of the decoded response, and a waiter that
+// is canceled returns right away without affecting the others; the call is
+// only canceled once every waiter has left.
+//
+// Waiters also share the answer of endpoints that aren't deterministic, such
+// as chat with a temperature above zero.
+func WithSingleflight() func(cln *Client) {
+	return func(cln *Client) {
+		cln.flight = &flight{
+			calls: make(map[string]*flightCall),
+		}
+	}
+}
+
+// =============================================================================
+
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	data    []byte
+	status  int
+	err     error
+}
+
+// flightKey identifies a request. Maps are encoded with sorted keys, so
+// bodies that only differ in key order share a key.
+func flightKey(method string, endpoint string, body D) (string, bool) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", false
+	}
+
+	return method + " " + endpoint + "\n" + string(data), true
+}
+
+// do runs fn once for all concurrent callers with the same key. It reports
+// whether the caller joined a call started by another caller.
+func (f *flight) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, int, error)) ([]byte, int, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, false, err
+	}
+
+	f.mu.Lock()
+
+	c, exists := f.calls[key]
+	if !exists {
+		// The call outlives the first caller, so it keeps the caller's
+		// values but not its cancellation.
+		cctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+		c = &flightCall{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		f.calls[key] = c
+
+		go func() {
+			c.data, c.status, c.err = fn(cctx)
+
+			f.mu.Lock()
+			if f.calls[key] == c {
+				delete(f.calls, key)
+			}
+			f.mu.Unlock()
+
+			cancel()
+			close(c.done)
+		}()
+	}
+
+	c.waiters++
+	f.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.data, c.status, exists, c.err
+
+	case <-ctx.Done():
+		f.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Later callers start a fresh call rather than joining one
+			// that is being canceled.
+			if f.calls[key] == c {
+				delete(f.calls, key)
+			}
+			c.cancel()
+		}
+		f.mu.Unlock()
+
+		return nil, 0, exists, ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_Singleflight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	canceled := make(chan struct{}, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tokenize", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		var body struct {
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		// The "never" input only returns when the call is canceled.
+		wait := release
+		if body.Input == "never" {
+			wait = nil
+		}
+
+		select {
+		case <-wait:
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+			return
+		}
+
+		fmt.Fprint(w, `{"id":"token-1","object":"tokens","created":1729871708,"model":"neural-chat-7b-v3-3","data":[{"id":1,"start":0,"stop":0,"text":"<s>"}]}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key", client.WithSingleflight())
+
+	tokenize := func(ctx context.Context, d client.D) (client.Tokenize, error) {
+		var resp client.Tokenize
+		err := cln.Do(ctx, http.MethodPost, srv.URL+"/tokenize", d, &resp)
+		return resp, err
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		calls.Store(0)
+
+		const waiters = 10
+
+		var wg sync.WaitGroup
+		errs := make(chan error, waiters)
+
+		cancelCtx, cancel := context.WithCancel(context.Background())
+
+		for i := range waiters {
+			ctx := context.Background()
+			if i == 0 {
+				ctx = cancelCtx
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				// Alternate the key order, which must not matter.
+				d := client.D{"model": "neural-chat-7b-v3-3", "input": "hi"}
+				if i%2 == 1 {
+					d = client.D{"input": "hi", "model": "neural-chat-7b-v3-3"}
+				}
+
+				resp, err := tokenize(ctx, d)
+				if err == nil && (len(resp.Data) != 1 || resp.Data[0].Text != "<s>") {
+					err = fmt.Errorf("unexpected response %#v", resp)
+				}
+
+				if i == 0 {
+					if !errors.Is(err, context.Canceled) {
+						err = fmt.Errorf("canceled waiter got %v", err)
+					} else {
+						err = nil
+					}
+				}
+
+				errs <- err
+			}()
+		}
+
+		// Cancel the first waiter before the call returns; the others
+		// must still get the response.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Should get the shared response: %s", err)
+			}
+		}
+
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("Should make a single call, got %d", n)
+		}
+	})
+
+	t.Run("all-canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := tokenize(ctx, client.D{"model": "neural-chat-7b-v3-3", "input": "never"})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Should get the deadline error, got %v", err)
+		}
+
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatalf("Should cancel the call once every waiter left")
+		}
+	})
+}
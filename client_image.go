@@ -1,18 +1,49 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	b64 "encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 )
 
+// ErrImageType is returned when the data of an image isn't a supported
+// image format.
+var ErrImageType = errors.New("unsupported image type")
+
+// Image represents an image that can be sent to the API. The encoded image
+// is loaded once and reused, including by copies of the value.
+type Image interface {
+	// EncodeBase64 returns the image encoded as standard base64.
+	EncodeBase64(ctx context.Context) (string, error)
+
+	// MIMEType returns the media type detected from the image data.
+	MIMEType(ctx context.Context) (string, error)
+
+	// DataURL returns the image as a data URL for chat image parts.
+	DataURL(ctx context.Context) (string, error)
+}
+
+// Compile time checks that the images implement Image.
+var (
+	_ Image = ImageFile{}
+	_ Image = ImageNetwork{}
+	_ Image = ImageBase64{}
+)
+
+// =============================================================================
+
 type ImageFile struct {
-	path   string
-	base64 string
+	path  string
+	cache *imageCache
 }
 
 func NewImageFile(imagePath string) (ImageFile, error) {
@@ -21,91 +52,345 @@ func NewImageFile(imagePath string) (ImageFile, error) {
 	}
 
 	img := ImageFile{
-		path: imagePath,
+		path:  imagePath,
+		cache: &imageCache{},
 	}
 
 	return img, nil
 }
 
 func (img ImageFile) EncodeBase64(ctx context.Context) (string, error) {
-	if img.base64 != "" {
-		return img.base64, nil
+	base64, _, err := img.cache.load(ctx, img.read)
+	return base64, err
+}
+
+func (img ImageFile) MIMEType(ctx context.Context) (string, error) {
+	_, mime, err := img.cache.load(ctx, img.read)
+	if err == nil && mime == "" {
+		err = ErrImageType
 	}
+	return mime, err
+}
 
+func (img ImageFile) DataURL(ctx context.Context) (string, error) {
+	return dataURL(img.cache.load(ctx, img.read))
+}
+
+func (img ImageFile) read(ctx context.Context) ([]byte, error) {
 	data, err := os.ReadFile(img.path)
 	if err != nil {
-		return "", fmt.Errorf("readfile: %w", err)
+		return nil, fmt.Errorf("readfile: %w", err)
 	}
 
-	img.base64 = b64.StdEncoding.EncodeToString(data)
-
-	return img.base64, nil
+	return data, nil
 }
 
 // =============================================================================
 
 type ImageNetwork struct {
-	url    url.URL
-	base64 string
+	url     url.URL
+	fetcher *ImageFetcher
+	cache   *imageCache
 }
 
-func NewImageNetwork(imageURL string) (ImageNetwork, error) {
+// NewImageNetwork constructs an image downloaded from the URL when it is
+// first encoded. The download is made by a default ImageFetcher unless
+// WithImageFetcher is used.
+func NewImageNetwork(imageURL string, options ...func(img *ImageNetwork)) (ImageNetwork, error) {
 	url, err := url.Parse(imageURL)
 	if err != nil {
 		return ImageNetwork{}, fmt.Errorf("url doesn't parse: %w", err)
 	}
 
 	img := ImageNetwork{
-		url: *url,
+		url:     *url,
+		fetcher: defaultImageFetcher,
+		cache:   &imageCache{},
+	}
+
+	for _, option := range options {
+		option(&img)
 	}
 
 	return img, nil
 }
 
+// WithImageFetcher sets the fetcher used to download the image.
+func WithImageFetcher(f *ImageFetcher) func(img *ImageNetwork) {
+	return func(img *ImageNetwork) {
+		img.fetcher = f
+	}
+}
+
 func (img ImageNetwork) EncodeBase64(ctx context.Context) (string, error) {
-	if img.base64 != "" {
-		return img.base64, nil
+	base64, _, err := img.cache.load(ctx, img.read)
+	return base64, err
+}
+
+func (img ImageNetwork) MIMEType(ctx context.Context) (string, error) {
+	_, mime, err := img.cache.load(ctx, img.read)
+	if err == nil && mime == "" {
+		err = ErrImageType
 	}
+	return mime, err
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, img.url.String(), nil)
+func (img ImageNetwork) DataURL(ctx context.Context) (string, error) {
+	return dataURL(img.cache.load(ctx, img.read))
+}
+
+func (img ImageNetwork) read(ctx context.Context) ([]byte, error) {
+	fetcher := img.fetcher
+	if fetcher == nil {
+		fetcher = defaultImageFetcher
+	}
+
+	return fetcher.Fetch(ctx, img.url.String())
+}
+
+// =============================================================================
+
+type ImageBase64 struct {
+	base64 string
+	cache  *imageCache
+}
+
+// NewImageBase64 constructs an image from standard base64. A data URL is
+// also accepted, in which case its media type is kept.
+func NewImageBase64(base64 string) ImageBase64 {
+	cache := imageCache{}
+
+	if rest, ok := strings.CutPrefix(base64, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok && strings.HasSuffix(meta, ";base64") {
+			base64 = data
+			cache.mime = strings.TrimSuffix(meta, ";base64")
+		}
+	}
+
+	img := ImageBase64{
+		base64: base64,
+		cache:  &cache,
+	}
+
+	return img
+}
+
+// NewImageBytes constructs an image from its raw data.
+func NewImageBytes(data []byte) ImageBase64 {
+	return NewImageBase64(b64.StdEncoding.EncodeToString(data))
+}
+
+// NewImageReader constructs an image from the data read from r.
+func NewImageReader(r io.Reader) (ImageBase64, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return "", fmt.Errorf("create request error: %w", err)
+		return ImageBase64{}, fmt.Errorf("readall: %w", err)
 	}
 
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Accept", "image/*")
+	return NewImageBytes(data), nil
+}
 
-	resp, err := defaultClient.Do(req)
+// NewImageFS constructs an image from a file in fsys, such as an embed.FS.
+func NewImageFS(fsys fs.FS, name string) (ImageBase64, error) {
+	data, err := fs.ReadFile(fsys, name)
 	if err != nil {
-		return "", fmt.Errorf("do: %w", err)
+		return ImageBase64{}, fmt.Errorf("readfile: %w", err)
+	}
+
+	return NewImageBytes(data), nil
+}
+
+func (img ImageBase64) EncodeBase64(ctx context.Context) (string, error) {
+	return img.base64, nil
+}
+
+// MIMEType detects the media type from the start of the decoded data, unless
+// the image was constructed from a data URL.
+func (img ImageBase64) MIMEType(ctx context.Context) (string, error) {
+	if img.cache != nil {
+		img.cache.mu.Lock()
+		mime := img.cache.mime
+		img.cache.mu.Unlock()
+
+		if mime != "" {
+			return mime, nil
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("status: %d", resp.StatusCode)
+	// 24 base64 characters decode to the 18 bytes the signatures need.
+	head := img.base64[:min(len(img.base64), 24)]
+	head = head[:len(head)/4*4]
+
+	data, err := b64.StdEncoding.DecodeString(head)
+	if err != nil {
+		return "", fmt.Errorf("decode: %w", err)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	mime, err := detectImageType(data)
 	if err != nil {
-		return "", fmt.Errorf("readall: %w", err)
+		return "", err
 	}
 
-	img.base64 = b64.StdEncoding.EncodeToString(data)
+	if img.cache != nil {
+		img.cache.mu.Lock()
+		img.cache.mime = mime
+		img.cache.mu.Unlock()
+	}
 
-	return img.base64, nil
+	return mime, nil
+}
+
+func (img ImageBase64) DataURL(ctx context.Context) (string, error) {
+	mime, err := img.MIMEType(ctx)
+	return dataURL(img.base64, mime, err)
 }
 
 // =============================================================================
 
-type ImageBase64 struct {
-	base64 string
+// imageCache holds the encoded image behind a pointer, so copies of an image
+// share it. A nil cache loads the image on every call.
+type imageCache struct {
+	mu      sync.Mutex
+	loaded  bool
+	base64  string
+	mime    string
+	loading *imageLoad
 }
 
-func NewImageBase64(base64 string) ImageBase64 {
-	return ImageBase64{
-		base64: base64,
+// imageLoad is a read of the image shared by the callers waiting for it.
+type imageLoad struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	base64  string
+	mime    string
+	err     error
+}
+
+// load returns the cached encoding, calling read to fill the cache when
+// empty. Concurrent callers share a single read, which each of them stops
+// waiting for when its context ends and which is canceled when none are
+// left. Failures aren't cached.
+func (c *imageCache) load(ctx context.Context, read func(ctx context.Context) ([]byte, error)) (string, string, error) {
+	if c == nil {
+		return encodeImage(ctx, read)
+	}
+
+	c.mu.Lock()
+
+	if c.loaded {
+		defer c.mu.Unlock()
+		return c.base64, c.mime, nil
+	}
+
+	l := c.loading
+	if l == nil {
+		// The read outlives the first caller, so it keeps the caller's
+		// values but not its cancellation.
+		lctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+		l = &imageLoad{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		c.loading = l
+
+		go func() {
+			l.base64, l.mime, l.err = encodeImage(lctx, read)
+
+			c.mu.Lock()
+			if l.err == nil {
+				c.loaded = true
+				c.base64 = l.base64
+				c.mime = l.mime
+			}
+			if c.loading == l {
+				c.loading = nil
+			}
+			c.mu.Unlock()
+
+			cancel()
+			close(l.done)
+		}()
+	}
+
+	l.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.base64, l.mime, l.err
+
+	case <-ctx.Done():
+		c.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			// Later callers start a fresh read rather than joining one
+			// that is being canceled.
+			if c.loading == l {
+				c.loading = nil
+			}
+			l.cancel()
+		}
+		c.mu.Unlock()
+
+		return "", "", ctx.Err()
 	}
 }
 
-func (img ImageBase64) EncodeBase64(ctx context.Context) (string, error) {
-	return img.base64, nil
+// encodeImage reads the image and returns its base64 encoding and media
+// type.
+func encodeImage(ctx context.Context, read func(ctx context.Context) ([]byte, error)) (string, string, error) {
+	data, err := read(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	// An unknown format only fails the calls that need the media type.
+	mime, _ := detectImageType(data)
+
+	return b64.StdEncoding.EncodeToString(data), mime, nil
+}
+
+var imageSignatures = []struct {
+	offset int
+	sig    []byte
+	mime   string
+}{
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{8, []byte("WEBP"), "image/webp"},
+}
+
+// detectImageType sniffs the media type from the start of the data. Formats
+// other than PNG, JPEG, GIF and WebP are left to http.DetectContentType.
+func detectImageType(data []byte) (string, error) {
+	for _, s := range imageSignatures {
+		if bytes.HasPrefix(data[min(s.offset, len(data)):], s.sig) {
+			if s.mime == "image/webp" && !bytes.HasPrefix(data, []byte("RIFF")) {
+				continue
+			}
+			return s.mime, nil
+		}
+	}
+
+	if mime := http.DetectContentType(data); strings.HasPrefix(mime, "image/") {
+		return mime, nil
+	}
+
+	return "", ErrImageType
+}
+
+func dataURL(base64 string, mime string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	if mime == "" {
+		return "", ErrImageType
+	}
+
+	return "data:" + mime + ";base64," + base64, nil
 }
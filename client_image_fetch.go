@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// Set of errors returned when fetching an image.
+var (
+	ErrImageAddress   = errors.New("image address not allowed")
+	ErrImageTooLarge  = errors.New("image too large")
+	ErrImageTransport = errors.New("image transport can't check addresses")
+)
+
+// Default values used by an ImageFetcher.
+const (
+	DefaultImageMaxBytes  = 20 << 20
+	DefaultImageTimeout   = 30 * time.Second
+	DefaultImageRedirects = 5
+)
+
+// ImageFetcher downloads images for ImageNetwork. By default it only follows
+// http and https URLs, refuses to connect to private, loopback, link-local
+// and other non-public addresses, caps the download at DefaultImageMaxBytes
+// and only accepts PNG, JPEG, GIF and WebP images. The address check runs
+// when each connection is dialed, so it also covers redirects and host names
+// that resolve to internal addresses. It is safe for concurrent use.
+type ImageFetcher struct {
+	http         *http.Client
+	timeout      time.Duration
+	maxBytes     int64
+	schemes      []string
+	types        []string
+	allowPrivate bool
+	err          error
+}
+
+// NewImageFetcher constructs a fetcher with the specified options.
+func NewImageFetcher(options ...func(f *ImageFetcher)) *ImageFetcher {
+	f := ImageFetcher{
+		timeout:  DefaultImageTimeout,
+		maxBytes: DefaultImageMaxBytes,
+		schemes:  []string{"https", "http"},
+		types:    []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+	}
+
+	for _, option := range options {
+		option(&f)
+	}
+
+	f.http, f.err = f.client(f.http)
+
+	return &f
+}
+
+// WithFetchClient sets the HTTP client used to download images. Its
+// transport must be an *http.Transport, of which a copy is made with the
+// address check installed on the dialer and the proxy disabled, since a
+// proxy would hide the final address. Other transports can't be checked, so
+// Fetch fails with ErrImageTransport unless WithPrivateNetworks is used.
+func WithFetchClient(cln *http.Client) func(f *ImageFetcher) {
+	return func(f *ImageFetcher) {
+		f.http = cln
+	}
+}
+
+// WithFetchTimeout sets the time allowed for a whole download, including
+// redirects.
+func WithFetchTimeout(timeout time.Duration) func(f *ImageFetcher) {
+	return func(f *ImageFetcher) {
+		f.timeout = timeout
+	}
+}
+
+// WithMaxImageBytes sets the largest image that is downloaded.
+func WithMaxImageBytes(n int64) func(f *ImageFetcher) {
+	return func(f *ImageFetcher) {
+		f.maxBytes = n
+	}
+}
+
+// WithAllowedSchemes sets the URL schemes that can be fetched, including
+// when following redirects.
+func WithAllowedSchemes(schemes ...string) func(f *ImageFetcher) {
+	return func(f *ImageFetcher) {
+		f.schemes = schemes
+	}
+}
+
+// WithAllowedImageTypes sets the media types that are accepted. The type
+// sniffed from the data must be in the list, and so must the Content-Type
+// of the response unless it is application/octet-stream.
+func WithAllowedImageTypes(types ...string) func(f *ImageFetcher) {
+	return func(f *ImageFetcher) {
+		f.types = types
+	}
+}
+
+// WithPrivateNetworks disables the address check. Only use it when the image
+// URLs are trusted.
+func WithPrivateNetworks() func(f *ImageFetcher) {
+	return func(f *ImageFetcher) {
+		f.allowPrivate = true
+	}
+}
+
+// Fetch downloads the image at the URL.
+func (f *ImageFetcher) Fetch(ctx context.Context, imageURL string) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("url doesn't parse: %w", err)
+	}
+
+	if !slices.Contains(f.schemes, u.Scheme) {
+		return nil, fmt.Errorf("scheme %q: %w", u.Scheme, ErrImageAddress)
+	}
+
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request error: %w", err)
+	}
+
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status: %d", resp.StatusCode)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "application/octet-stream" && !slices.Contains(f.types, mediaType)) {
+			return nil, fmt.Errorf("content type %q: %w", ct, ErrImageType)
+		}
+	}
+
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("content length %d: %w", resp.ContentLength, ErrImageTooLarge)
+	}
+
+	// Read one byte past the limit to know whether the body fits.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("readall: %w", err)
+	}
+
+	if int64(len(data)) > f.maxBytes {
+		return nil, fmt.Errorf("more than %d bytes: %w", f.maxBytes, ErrImageTooLarge)
+	}
+
+	mediaType, err := detectImageType(data)
+	if err != nil || !slices.Contains(f.types, mediaType) {
+		return nil, fmt.Errorf("content %q: %w", mediaType, ErrImageType)
+	}
+
+	return data, nil
+}
+
+// =============================================================================
+
+var defaultImageFetcher = NewImageFetcher()
+
+// client returns a copy of the HTTP client with the redirect and address
+// checks installed.
+func (f *ImageFetcher) client(base *http.Client) (*http.Client, error) {
+	var cln http.Client
+	if base != nil {
+		cln = *base
+	}
+
+	checkRedirect := cln.CheckRedirect
+	cln.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= DefaultImageRedirects {
+			return fmt.Errorf("stopped after %d redirects", len(via))
+		}
+
+		if !slices.Contains(f.schemes, req.URL.Scheme) {
+			return fmt.Errorf("redirect scheme %q: %w", req.URL.Scheme, ErrImageAddress)
+		}
+
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+
+		return nil
+	}
+
+	if f.allowPrivate {
+		return &cln, nil
+	}
+
+	var tr *http.Transport
+	switch t := cln.Transport.(type) {
+	case nil:
+		tr = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		tr = t.Clone()
+	default:
+		return nil, fmt.Errorf("%T: %w", t, ErrImageTransport)
+	}
+
+	dialer := net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 15 * time.Second,
+		Control:   checkAddress,
+	}
+
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	tr.DialTLSContext = nil
+	tr.Dial = nil
+	tr.DialTLS = nil
+	cln.Transport = tr
+
+	return &cln, nil
+}
+
+// checkAddress runs after the host name is resolved and before connecting,
+// so it sees the address that is actually dialed.
+func checkAddress(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !publicAddress(addr) {
+		return fmt.Errorf("%s: %w", addr, ErrImageAddress)
+	}
+
+	return nil
+}
+
+// Prefixes of IPv6 addresses that embed an IPv4 address, which is checked in
+// their place.
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixTo4      = netip.MustParsePrefix("2002::/16")
+)
+
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+
+	// A NAT64 address carries the IPv4 address in its last four bytes and
+	// a 6to4 address in the four bytes after the prefix.
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return publicAddress(netip.AddrFrom4([4]byte(b[12:16])))
+	case sixTo4.Contains(addr):
+		return publicAddress(netip.AddrFrom4([4]byte(b[2:6])))
+	}
+
+	return true
+}
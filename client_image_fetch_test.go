@@ -0,0 +1,112 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_ImageFetcher(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 64, 64)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rose.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngData.Bytes())
+	})
+	mux.HandleFunc("GET /stream.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngData.Bytes()[:10])
+		w.(http.Flusher).Flush()
+		w.Write(pngData.Bytes()[10:])
+	})
+	mux.HandleFunc("GET /page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(pngData.Bytes())
+	})
+	mux.HandleFunc("GET /lying.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<html>not an image</html>"))
+	})
+	mux.HandleFunc("GET /redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	mux.HandleFunc("GET /slow.png", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	trusted := client.NewImageFetcher(client.WithPrivateNetworks())
+	small := client.NewImageFetcher(client.WithPrivateNetworks(), client.WithMaxImageBytes(int64(pngData.Len()-1)))
+	quick := client.NewImageFetcher(client.WithPrivateNetworks(), client.WithFetchTimeout(50*time.Millisecond))
+	safe := client.NewImageFetcher()
+
+	// A transport the fetcher can't install the address check on is only
+	// usable with trusted URLs.
+	wrapped := &http.Client{Transport: roundTripper(http.DefaultTransport.RoundTrip)}
+	unchecked := client.NewImageFetcher(client.WithFetchClient(wrapped))
+	uncheckedTrusted := client.NewImageFetcher(client.WithFetchClient(wrapped), client.WithPrivateNetworks())
+
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name    string
+		fetcher *client.ImageFetcher
+		url     string
+		err     error
+	}{
+		{"ok", trusted, srv.URL + "/rose.png", nil},
+		{"loopback", safe, srv.URL + "/rose.png", client.ErrImageAddress},
+		{"loopback-name", safe, localhost + "/rose.png", client.ErrImageAddress},
+		{"loopback-nat64", safe, "http://[64:ff9b::7f00:1]/rose.png", client.ErrImageAddress},
+		{"private-6to4", safe, "http://[2002:c0a8:101::1]/rose.png", client.ErrImageAddress},
+		{"unchecked-transport", unchecked, srv.URL + "/rose.png", client.ErrImageTransport},
+		{"unchecked-transport-trusted", uncheckedTrusted, srv.URL + "/rose.png", nil},
+		{"scheme", trusted, "file:///etc/passwd", client.ErrImageAddress},
+		{"redirect-scheme", trusted, srv.URL + "/redirect?to=ftp://example.com/rose.png", client.ErrImageAddress},
+		{"redirect-ok", trusted, srv.URL + "/redirect?to=/rose.png", nil},
+		{"too-large", small, srv.URL + "/rose.png", client.ErrImageTooLarge},
+		{"too-large-chunked", small, srv.URL + "/stream.png", client.ErrImageTooLarge},
+		{"content-type", trusted, srv.URL + "/page.html", client.ErrImageType},
+		{"sniffed-type", trusted, srv.URL + "/lying.png", client.ErrImageType},
+		{"timeout", quick, srv.URL + "/slow.png", context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.fetcher.Fetch(ctx, tt.url)
+
+		if tt.err == nil {
+			if err != nil || !bytes.Equal(data, pngData.Bytes()) {
+				t.Fatalf("%s: Should fetch the image, got %v", tt.name, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%s: Should get error %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt(req)
+}
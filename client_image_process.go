@@ -0,0 +1,380 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Default values used by PreprocessImage.
+const (
+	DefaultImageMaxDimension = 1024
+	DefaultImageQuality      = 85
+)
+
+// maxImagePixels bounds the memory used to decode an image.
+const maxImagePixels = 1 << 26
+
+// Set of formats PreprocessImage can produce.
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+)
+
+// ImagePreprocessConfig defines how PreprocessImage prepares an image.
+type ImagePreprocessConfig struct {
+	// MaxDimension is the largest width or height of the result. Larger
+	// images are scaled down keeping their aspect ratio. A negative value
+	// disables resizing.
+	MaxDimension int
+
+	// Quality is the JPEG quality from 1 to 100.
+	Quality int
+
+	// Format is ImageFormatJPEG or ImageFormatPNG. When empty, JPEG images
+	// stay JPEG and everything else becomes PNG.
+	Format string
+}
+
+// ImagePreprocessReport describes what PreprocessImage did.
+type ImagePreprocessReport struct {
+	Format       string
+	BeforeBytes  int
+	AfterBytes   int
+	BeforeWidth  int
+	BeforeHeight int
+	AfterWidth   int
+	AfterHeight  int
+}
+
+// PreprocessImage decodes a PNG, JPEG or GIF image, scales it down to fit
+// the configured dimension and encodes it again. Re-encoding drops all
+// metadata, such as EXIF camera details and location; the EXIF orientation
+// of a JPEG is applied to the pixels first so the image isn't left rotated.
+// Only the first frame of an animated GIF is kept.
+func PreprocessImage(ctx context.Context, img Image, cfg ImagePreprocessConfig) (ImageBase64, ImagePreprocessReport, error) {
+	if cfg.MaxDimension == 0 {
+		cfg.MaxDimension = DefaultImageMaxDimension
+	}
+
+	if cfg.Quality <= 0 || cfg.Quality > 100 {
+		cfg.Quality = DefaultImageQuality
+	}
+
+	base64, err := img.EncodeBase64(ctx)
+	if err != nil {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("encode: %w", err)
+	}
+
+	data, err := b64.StdEncoding.DecodeString(base64)
+	if err != nil {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("decode base64: %w", err)
+	}
+
+	// Check the size before decoding, since a small file can declare a
+	// huge image.
+	dim, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("decode image: %w", err)
+	}
+
+	if dim.Width*dim.Height > maxImagePixels {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("%dx%d pixels: %w", dim.Width, dim.Height, ErrImageTooLarge)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("decode image: %w", err)
+	}
+
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("format %q: %w", format, ErrImageType)
+	}
+
+	report := ImagePreprocessReport{
+		Format:       cfg.Format,
+		BeforeBytes:  len(data),
+		BeforeWidth:  src.Bounds().Dx(),
+		BeforeHeight: src.Bounds().Dy(),
+	}
+
+	if report.Format == "" {
+		report.Format = ImageFormatPNG
+		if format == "jpeg" {
+			report.Format = ImageFormatJPEG
+		}
+	}
+
+	rgba := toRGBA(src)
+
+	if format == "jpeg" {
+		rgba = orient(rgba, jpegOrientation(data))
+	}
+
+	if cfg.MaxDimension > 0 {
+		w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+		if w > cfg.MaxDimension || h > cfg.MaxDimension {
+			nw, nh := cfg.MaxDimension, cfg.MaxDimension
+			if w > h {
+				nh = max(1, (h*cfg.MaxDimension+w/2)/w)
+			} else {
+				nw = max(1, (w*cfg.MaxDimension+h/2)/h)
+			}
+			rgba = resizeArea(rgba, nw, nh)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	switch report.Format {
+	case ImageFormatJPEG:
+		// JPEG has no alpha channel, so transparent areas are flattened
+		// onto white rather than black.
+		flat := image.NewRGBA(rgba.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), rgba, rgba.Bounds().Min, draw.Over)
+
+		err = jpeg.Encode(&buf, flat, &jpeg.Options{Quality: cfg.Quality})
+
+	case ImageFormatPNG:
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, rgba)
+
+	default:
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("format %q: %w", report.Format, ErrImageType)
+	}
+
+	if err != nil {
+		return ImageBase64{}, ImagePreprocessReport{}, fmt.Errorf("encode image: %w", err)
+	}
+
+	report.AfterBytes = buf.Len()
+	report.AfterWidth = rgba.Bounds().Dx()
+	report.AfterHeight = rgba.Bounds().Dy()
+
+	return NewImageBytes(buf.Bytes()), report, nil
+}
+
+// =============================================================================
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// resizeArea scales the image down by averaging the source pixels each
+// destination pixel covers, weighting partly covered pixels by the covered
+// fraction. It works on premultiplied values, so transparent pixels don't
+// darken their neighbors.
+func resizeArea(src *image.RGBA, w int, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	xw := areaWeights(sw, w)
+	yw := areaWeights(sh, h)
+
+	// Horizontal pass into a float buffer of w x sh.
+	tmp := make([]float32, w*sh*4)
+	for y := range sh {
+		row := src.Pix[y*src.Stride:]
+		for x, ws := range xw {
+			var r, g, b, a float32
+			for _, wt := range ws.weights {
+				p := row[(ws.start+wt.offset)*4:]
+				r += float32(p[0]) * wt.weight
+				g += float32(p[1]) * wt.weight
+				b += float32(p[2]) * wt.weight
+				a += float32(p[3]) * wt.weight
+			}
+			i := (y*w + x) * 4
+			tmp[i], tmp[i+1], tmp[i+2], tmp[i+3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass into the destination.
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y, ws := range yw {
+		for x := range w {
+			var r, g, b, a float32
+			for _, wt := range ws.weights {
+				i := ((ws.start+wt.offset)*w + x) * 4
+				r += tmp[i] * wt.weight
+				g += tmp[i+1] * wt.weight
+				b += tmp[i+2] * wt.weight
+				a += tmp[i+3] * wt.weight
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			p[0], p[1], p[2], p[3] = clamp8(r), clamp8(g), clamp8(b), clamp8(a)
+		}
+	}
+
+	return dst
+}
+
+type areaWeight struct {
+	offset int
+	weight float32
+}
+
+type areaSpan struct {
+	start   int
+	weights []areaWeight
+}
+
+// areaWeights returns for every destination coordinate the source pixels it
+// covers and how much of each, normalized to sum to one.
+func areaWeights(src int, dst int) []areaSpan {
+	scale := float64(src) / float64(dst)
+	spans := make([]areaSpan, dst)
+
+	for i := range spans {
+		lo := float64(i) * scale
+		hi := min(float64(i+1)*scale, float64(src))
+
+		start := int(lo)
+		span := areaSpan{start: start}
+
+		for j := start; float64(j) < hi; j++ {
+			cover := min(float64(j+1), hi) - max(float64(j), lo)
+			if cover <= 0 {
+				continue
+			}
+			span.weights = append(span.weights, areaWeight{
+				offset: j - start,
+				weight: float32(cover / (hi - lo)),
+			})
+		}
+
+		spans[i] = span
+	}
+
+	return spans
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// orient applies an EXIF orientation so the pixels are upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			copy(dst.Pix[dy*dst.Stride+dx*4:][:4], src.Pix[y*src.Stride+x*4:][:4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation tag of a JPEG, or 1 when it
+// has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return 1
+		}
+
+		marker := data[pos+1]
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+
+		// Start of scan, the metadata segments are all before it.
+		if marker == 0xda || size < 2 || pos+2+size > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+
+		pos += 2 + size
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,166 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_PreprocessImage(t *testing.T) {
+	ctx := context.Background()
+
+	// A 400x200 photo that is red on the left half and blue on the right.
+	photo := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := range 200 {
+		for x := range 400 {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 200 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			photo.Set(x, y, c)
+		}
+	}
+
+	var jpegData bytes.Buffer
+	jpeg.Encode(&jpegData, photo, &jpeg.Options{Quality: 100})
+
+	t.Run("jpeg-exif", func(t *testing.T) {
+		// Orientation 6 means the camera was turned, so the upright image
+		// is 200x400 with red on top.
+		data := withExif(jpegData.Bytes(), 6, "GPS 37.7749 N 122.4194 W")
+
+		got, report, err := client.PreprocessImage(ctx, client.NewImageBytes(data), client.ImagePreprocessConfig{
+			MaxDimension: 100,
+			Quality:      80,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to preprocess: %s", err)
+		}
+
+		if report.Format != client.ImageFormatJPEG || report.BeforeWidth != 400 || report.AfterWidth != 50 || report.AfterHeight != 100 {
+			t.Fatalf("Should rotate and scale to 50x100, got %+v", report)
+		}
+
+		if report.BeforeBytes != len(data) || report.AfterBytes >= report.BeforeBytes {
+			t.Fatalf("Should report the sizes, got %+v", report)
+		}
+
+		out := decodeImage(t, got)
+
+		if bytes.Contains(out.raw, []byte("Exif")) || bytes.Contains(out.raw, []byte("GPS")) {
+			t.Fatalf("Should strip the metadata")
+		}
+
+		if r, _, b, _ := out.img.At(25, 10).RGBA(); r>>8 < 200 || b>>8 > 50 {
+			t.Fatalf("Should have red at the top after rotating, got r %d b %d", r>>8, b>>8)
+		}
+
+		if r, _, b, _ := out.img.At(25, 90).RGBA(); b>>8 < 200 || r>>8 > 50 {
+			t.Fatalf("Should have blue at the bottom after rotating, got r %d b %d", r>>8, b>>8)
+		}
+	})
+
+	t.Run("png-small", func(t *testing.T) {
+		small := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+		small.Set(0, 0, color.NRGBA{G: 255, A: 128})
+
+		var data bytes.Buffer
+		png.Encode(&data, small)
+
+		got, report, err := client.PreprocessImage(ctx, client.NewImageBytes(data.Bytes()), client.ImagePreprocessConfig{})
+		if err != nil {
+			t.Fatalf("Should be able to preprocess: %s", err)
+		}
+
+		if report.Format != client.ImageFormatPNG || report.AfterWidth != 30 || report.AfterHeight != 20 {
+			t.Fatalf("Should keep a small png as is, got %+v", report)
+		}
+
+		out := decodeImage(t, got)
+		if _, _, _, a := out.img.At(0, 0).RGBA(); a>>8 < 120 || a>>8 > 136 {
+			t.Fatalf("Should keep the alpha channel, got %d", a>>8)
+		}
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		got, report, err := client.PreprocessImage(ctx, client.NewImageBytes(jpegData.Bytes()), client.ImagePreprocessConfig{
+			MaxDimension: -1,
+			Format:       client.ImageFormatPNG,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to preprocess: %s", err)
+		}
+
+		if mime, _ := got.MIMEType(ctx); mime != "image/png" || report.AfterWidth != 400 {
+			t.Fatalf("Should convert to png without resizing, got %s %+v", mime, report)
+		}
+	})
+
+	t.Run("not-image", func(t *testing.T) {
+		if _, _, err := client.PreprocessImage(ctx, client.NewImageBytes([]byte("hello")), client.ImagePreprocessConfig{}); err == nil {
+			t.Fatalf("Should fail for data that isn't an image")
+		}
+	})
+}
+
+type decoded struct {
+	raw []byte
+	img image.Image
+}
+
+func decodeImage(t *testing.T, img client.Image) decoded {
+	t.Helper()
+
+	base64, err := img.EncodeBase64(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to encode: %s", err)
+	}
+
+	raw, _ := b64.StdEncoding.DecodeString(base64)
+
+	out, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Should be able to decode the result: %s", err)
+	}
+
+	return decoded{raw: raw, img: out}
+}
+
+// withExif inserts an APP1 segment after the start of image marker holding
+// a little endian TIFF header with the orientation and a description tag.
+func withExif(data []byte, orientation uint16, description string) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+
+	// Two entries: orientation and the description stored after the IFD.
+	binary.Write(&tiff, binary.LittleEndian, uint16(2))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x010e, 2})
+	binary.Write(&tiff, binary.LittleEndian, uint32(len(description)+1))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8+2+2*12+4))
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	tiff.WriteString(description + "\x00")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xff, 0xe1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+
+	return out.Bytes()
+}
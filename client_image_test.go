@@ -0,0 +1,233 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func Test_Image(t *testing.T) {
+	ctx := context.Background()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var pngData, jpegData, gifData bytes.Buffer
+	png.Encode(&pngData, img)
+	jpeg.Encode(&jpegData, img, nil)
+	gif.Encode(&gifData, img, nil)
+
+	// A WebP header is enough for sniffing.
+	webpData := []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00")
+
+	t.Run("sniff", func(t *testing.T) {
+		tests := []struct {
+			name string
+			data []byte
+			mime string
+		}{
+			{"png", pngData.Bytes(), "image/png"},
+			{"jpeg", jpegData.Bytes(), "image/jpeg"},
+			{"gif", gifData.Bytes(), "image/gif"},
+			{"webp", webpData, "image/webp"},
+		}
+
+		for _, tt := range tests {
+			mime, err := client.NewImageBytes(tt.data).MIMEType(ctx)
+			if err != nil || mime != tt.mime {
+				t.Fatalf("%s: Should detect %s, got %q %v", tt.name, tt.mime, mime, err)
+			}
+
+			url, err := client.NewImageBytes(tt.data).DataURL(ctx)
+			exp := "data:" + tt.mime + ";base64," + b64.StdEncoding.EncodeToString(tt.data)
+			if err != nil || url != exp {
+				t.Fatalf("%s: Should get the data url, got %.40q %v", tt.name, url, err)
+			}
+		}
+
+		if _, err := client.NewImageBytes([]byte("plain text")).MIMEType(ctx); !errors.Is(err, client.ErrImageType) {
+			t.Fatalf("Should reject data that isn't an image, got %v", err)
+		}
+	})
+
+	t.Run("data-url", func(t *testing.T) {
+		img := client.NewImageBase64("data:image/jpeg;base64,aGVsbG8=")
+
+		base64, _ := img.EncodeBase64(ctx)
+		mime, _ := img.MIMEType(ctx)
+
+		if base64 != "aGVsbG8=" || mime != "image/jpeg" {
+			t.Fatalf("Should split the data url, got %q %q", base64, mime)
+		}
+	})
+
+	t.Run("constructors", func(t *testing.T) {
+		fsys := fstest.MapFS{"rose.gif": {Data: gifData.Bytes()}}
+
+		fromFS, err := client.NewImageFS(fsys, "rose.gif")
+		if err != nil {
+			t.Fatalf("Should be able to read from the fs: %s", err)
+		}
+
+		fromReader, err := client.NewImageReader(bytes.NewReader(gifData.Bytes()))
+		if err != nil {
+			t.Fatalf("Should be able to read from the reader: %s", err)
+		}
+
+		for _, img := range []client.Image{fromFS, fromReader} {
+			if mime, _ := img.MIMEType(ctx); mime != "image/gif" {
+				t.Fatalf("Should detect the gif, got %q", mime)
+			}
+		}
+
+		if _, err := client.NewImageFS(fsys, "missing.gif"); err == nil {
+			t.Fatalf("Should fail for a missing file")
+		}
+	})
+
+	t.Run("file-memo", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rose.png")
+		os.WriteFile(path, pngData.Bytes(), 0o644)
+
+		img, err := client.NewImageFile(path)
+		if err != nil {
+			t.Fatalf("Should be able to construct the image: %s", err)
+		}
+
+		first, err := img.EncodeBase64(ctx)
+		if err != nil {
+			t.Fatalf("Should be able to encode: %s", err)
+		}
+
+		// A copy shares the cached encoding, so the file isn't read again.
+		os.Remove(path)
+		cp := img
+
+		second, err := cp.EncodeBase64(ctx)
+		if err != nil || second != first {
+			t.Fatalf("Should reuse the cached encoding, got %v", err)
+		}
+
+		if mime, _ := cp.MIMEType(ctx); mime != "image/png" {
+			t.Fatalf("Should detect the png, got %q", mime)
+		}
+	})
+
+	t.Run("network-memo", func(t *testing.T) {
+		var calls atomic.Int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Write(jpegData.Bytes())
+		}))
+		defer srv.Close()
+
+		fetcher := client.NewImageFetcher(client.WithPrivateNetworks())
+
+		img, err := client.NewImageNetwork(srv.URL+"/rose.jpg", client.WithImageFetcher(fetcher))
+		if err != nil {
+			t.Fatalf("Should be able to construct the image: %s", err)
+		}
+
+		for range 3 {
+			url, err := img.DataURL(ctx)
+			if err != nil || !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+				t.Fatalf("Should get a jpeg data url, got %.40q %v", url, err)
+			}
+		}
+
+		if calls.Load() != 1 {
+			t.Fatalf("Should fetch the image once, got %d", calls.Load())
+		}
+	})
+
+	t.Run("file-memo-empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "empty.png")
+		os.WriteFile(path, nil, 0o644)
+
+		img, err := client.NewImageFile(path)
+		if err != nil {
+			t.Fatalf("Should be able to construct the image: %s", err)
+		}
+
+		if b64, err := img.EncodeBase64(ctx); err != nil || b64 != "" {
+			t.Fatalf("Should get an empty encoding, got %q %v", b64, err)
+		}
+
+		os.Remove(path)
+
+		if b64, err := img.EncodeBase64(ctx); err != nil || b64 != "" {
+			t.Fatalf("Should reuse the cached empty encoding, got %q %v", b64, err)
+		}
+	})
+
+	t.Run("network-cancel", func(t *testing.T) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			<-release
+			w.Write(jpegData.Bytes())
+		}))
+		defer srv.Close()
+
+		fetcher := client.NewImageFetcher(client.WithPrivateNetworks())
+
+		img, err := client.NewImageNetwork(srv.URL+"/rose.jpg", client.WithImageFetcher(fetcher))
+		if err != nil {
+			t.Fatalf("Should be able to construct the image: %s", err)
+		}
+
+		result := make(chan error, 1)
+		go func() {
+			_, err := img.DataURL(ctx)
+			result <- err
+		}()
+
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// A caller joining the slow download stops waiting when its own
+		// context ends.
+		quick, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := img.DataURL(quick); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Should stop waiting with the context, got %v", err)
+		}
+
+		if time.Since(start) > time.Second {
+			t.Fatalf("Should not wait for the download, took %s", time.Since(start))
+		}
+
+		close(release)
+
+		if err := <-result; err != nil {
+			t.Fatalf("Should still download the image for the first caller: %s", err)
+		}
+
+		if calls.Load() != 1 {
+			t.Fatalf("Should share a single download, got %d", calls.Load())
+		}
+	})
+}
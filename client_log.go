@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// LogConfig controls the records a client writes with WithSlog.
+type LogConfig struct {
+	// Level is the level of the record of a completed request. It defaults
+	// to slog.LevelInfo.
+	Level slog.Leveler
+
+	// ErrorLevel is the level of the record of a failed request. It
+	// defaults to slog.LevelError.
+	ErrorLevel slog.Leveler
+
+	// DebugLevel is the level of the messages the client writes while a
+	// request is in progress, such as retries. It defaults to
+	// slog.LevelDebug.
+	DebugLevel slog.Leveler
+
+	// LogBodies adds the request body to the records, and keeps the
+	// response bodies quoted by errors. Bodies hold prompts and other user
+	// content, so they are left out unless this is set.
+	LogBodies bool
+}
+
+// WithSlog makes the client write a structured record with l for each
+// request it completes, with the attributes method, endpoint, model, status,
+// duration and request_id, and tokens for a stream. The endpoint is the path
+// of the URL. The API key is never logged, and the request body only when
+// LogBodies is set. The messages of the client are written with l as well,
+// replacing the Logger passed to New.
+func WithSlog(l *slog.Logger, cfg LogConfig) func(cln *Client) {
+	return func(cln *Client) {
+		if l == nil {
+			return
+		}
+
+		if cfg.Level == nil {
+			cfg.Level = slog.LevelInfo
+		}
+
+		if cfg.ErrorLevel == nil {
+			cfg.ErrorLevel = slog.LevelError
+		}
+
+		if cfg.DebugLevel == nil {
+			cfg.DebugLevel = slog.LevelDebug
+		}
+
+		cln.slog = l
+		cln.logCfg = cfg
+		cln.log = SlogLogger(l, cfg.DebugLevel)
+	}
+}
+
+// SlogLogger adapts l to a Logger that writes each message at the level,
+// treating the values as key value pairs.
+func SlogLogger(l *slog.Logger, level slog.Leveler) Logger {
+	return func(ctx context.Context, msg string, v ...any) {
+		l.Log(ctx, level.Level(), msg, v...)
+	}
+}
+
+// =============================================================================
+
+// requestLog writes the record of a single request. Its methods do nothing
+// when the client has no slog logger.
+type requestLog struct {
+	l      *slog.Logger
+	cfg    LogConfig
+	call   *call
+	attrs  []slog.Attr
+	start  time.Time
+	tokens int
+}
+
+func (cln *Client) startLog(c *call, method string, endpoint string, body D) *requestLog {
+	if cln.slog == nil {
+		return nil
+	}
+
+	path, model := describe(endpoint, body)
+
+	rl := requestLog{
+		l:    cln.slog,
+		cfg:  cln.logCfg,
+		call: c,
+		attrs: []slog.Attr{
+			slog.String("method", method),
+			slog.String("endpoint", path),
+			slog.String("model", model),
+		},
+		start: time.Now(),
+	}
+
+	if cln.logCfg.LogBodies && body != nil {
+		if data, err := json.Marshal(body); err == nil {
+			rl.attrs = append(rl.attrs, slog.String("body", string(data)))
+		}
+	}
+
+	return &rl
+}
+
+func (rl *requestLog) end(ctx context.Context, err error) {
+	if rl == nil {
+		return
+	}
+
+	rl.write(ctx, "client: request", err)
+}
+
+// chunk counts a chunk of a stream.
+func (rl *requestLog) chunk() {
+	if rl == nil {
+		return
+	}
+
+	rl.tokens++
+}
+
+func (rl *requestLog) endStream(ctx context.Context, err error) {
+	if rl == nil {
+		return
+	}
+
+	rl.attrs = append(rl.attrs, slog.Int("tokens", rl.tokens))
+	rl.write(ctx, "client: stream", err)
+}
+
+func (rl *requestLog) write(ctx context.Context, msg string, err error) {
+	attrs := append(rl.attrs,
+		slog.Int("status", statusOf(err)),
+		slog.Duration("duration", time.Since(rl.start)),
+	)
+
+	if id := rl.call.requestID(); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+
+	level := rl.cfg.Level
+	if err != nil {
+		level = rl.cfg.ErrorLevel
+		attrs = append(attrs, slog.String("error", rl.errorText(err)))
+	}
+
+	rl.l.LogAttrs(ctx, level.Level(), msg, attrs...)
+}
+
+// errorText returns the text of err with the response body it quotes, if
+// any, replaced by its size unless bodies are logged.
+func (rl *requestLog) errorText(err error) string {
+	if rl.cfg.LogBodies {
+		return err.Error()
+	}
+
+	return withoutBody(err).Error()
+}
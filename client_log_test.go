@@ -0,0 +1,207 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// syncBuffer is a buffer that is safe to write from the stream goroutine.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	return sb.b.Write(p)
+}
+
+// Records decodes the JSON records written to the buffer.
+func (sb *syncBuffer) Records(t *testing.T) []map[string]any {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(sb.b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Should be able to decode the record %s: %s", line, err)
+		}
+		recs = append(recs, rec)
+	}
+
+	return recs
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	return sb.b.String()
+}
+
+func Test_Slog(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(client.RequestIDHeader, "req-1")
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1717439154,"model":"hermes","choices":[]}`)
+	})
+	mux.HandleFunc("POST /broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{"error":"boom"}`)
+	})
+	mux.HandleFunc("POST /garbled", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `upstream echoed my secret prompt`)
+	})
+	mux.HandleFunc("POST /stream", func(w http.ResponseWriter, r *http.Request) {
+		for _, word := range []string{"one", "two"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	body := client.D{"model": "hermes", "messages": "my secret prompt"}
+
+	t.Run("records", func(t *testing.T) {
+		var buf syncBuffer
+		l := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+		cln := client.New(nil, "secret-key", client.WithSlog(l, client.LogConfig{}))
+		sse := client.NewSSE[client.ChatSSE](nil, "secret-key", client.WithSlog(l, client.LogConfig{}))
+
+		var resp client.Chat
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", body, &resp); err != nil {
+			t.Fatalf("Should be able to chat: %s", err)
+		}
+
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/broken", body, nil); err == nil {
+			t.Fatalf("Should fail for the broken endpoint")
+		}
+
+		err := cln.Do(ctx, http.MethodPost, srv.URL+"/garbled", body, nil)
+		if err == nil || !strings.Contains(err.Error(), "my secret prompt") {
+			t.Fatalf("Should return the response body in the error, got %v", err)
+		}
+
+		ch := make(chan client.ChatSSE)
+		if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", body, ch); err != nil {
+			t.Fatalf("Should be able to stream: %s", err)
+		}
+		for range ch {
+		}
+
+		// The stream is logged after its channel is closed.
+		var recs []map[string]any
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if recs = buf.Records(t); len(recs) == 4 {
+				break
+			}
+		}
+
+		exp := []map[string]any{
+			{"level": "INFO", "msg": "client: request", "method": "POST", "endpoint": "/chat/completions", "model": "hermes", "status": 200.0, "request_id": "req-1"},
+			{"level": "ERROR", "msg": "client: request", "endpoint": "/broken", "status": 502.0},
+			{"level": "ERROR", "msg": "client: request", "endpoint": "/garbled", "status": 500.0},
+			{"level": "INFO", "msg": "client: stream", "endpoint": "/stream", "status": 200.0, "tokens": 2.0},
+		}
+
+		if len(recs) != len(exp) {
+			t.Fatalf("Should only write the request records at info, got:\n%s", buf.String())
+		}
+
+		for i, e := range exp {
+			for k, v := range e {
+				if recs[i][k] != v {
+					t.Fatalf("Should set %s to %v in record %d, got %v", k, v, i, recs[i][k])
+				}
+			}
+
+			if _, exists := recs[i]["duration"]; !exists {
+				t.Fatalf("Should set the duration in record %d", i)
+			}
+		}
+
+		if _, exists := recs[1]["error"]; !exists {
+			t.Fatalf("Should set the error of the failed request")
+		}
+
+		if e := fmt.Sprint(recs[2]["error"]); !strings.Contains(e, "[32 bytes]") {
+			t.Fatalf("Should replace the response body in the error with its size, got %s", e)
+		}
+
+		if s := buf.String(); strings.Contains(s, "secret-key") || strings.Contains(s, "secret prompt") {
+			t.Fatalf("Should not log the API key or the prompt, got:\n%s", s)
+		}
+	})
+
+	t.Run("levels", func(t *testing.T) {
+		var buf syncBuffer
+		l := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		cfg := client.LogConfig{
+			Level:     slog.LevelDebug,
+			LogBodies: true,
+		}
+		cln := client.New(nil, "secret-key", client.WithSlog(l, cfg))
+
+		var resp client.Chat
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", body, &resp); err != nil {
+			t.Fatalf("Should be able to chat: %s", err)
+		}
+
+		recs := buf.Records(t)
+		last := recs[len(recs)-1]
+
+		if len(recs) < 2 || recs[0]["msg"] != "do: rawRequest: started" {
+			t.Fatalf("Should write the client messages at debug, got:\n%s", buf.String())
+		}
+
+		if last["level"] != "DEBUG" || !strings.Contains(fmt.Sprint(last["body"]), "my secret prompt") {
+			t.Fatalf("Should write the record at debug with the body, got %v", last)
+		}
+
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/garbled", body, nil); err == nil {
+			t.Fatalf("Should fail for the garbled endpoint")
+		}
+
+		recs = buf.Records(t)
+		if last := recs[len(recs)-1]; !strings.Contains(fmt.Sprint(last["error"]), "upstream echoed my secret prompt") {
+			t.Fatalf("Should keep the response body in the error, got %v", last)
+		}
+
+		if strings.Contains(buf.String(), "secret-key") {
+			t.Fatalf("Should never log the API key, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		cln := client.New(nil, "key")
+
+		var resp client.Chat
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", body, &resp); err != nil {
+			t.Fatalf("Should be able to chat without a logger: %s", err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Metrics receives measurements of the requests made by a client. Requests
+// are labeled with the path of the endpoint and the model in the body. The
+// metrics package provides an implementation that serves them in the
+// Prometheus text format. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// RequestStart is called when a request is sent.
+	RequestStart(endpoint string, model string)
+
+	// RequestEnd is called when a request completes, with the status code
+	// of the response or 0 when no response was received. For a stream it
+	// is called when the stream ends.
+	RequestEnd(endpoint string, model string, status int, latency time.Duration)
+
+	// Retry is called before a failed request is sent again.
+	Retry(endpoint string, model string)
+
+	// StreamFirstToken is called when the first chunk of a stream arrives,
+	// with the time since the request was sent.
+	StreamFirstToken(endpoint string, model string, ttft time.Duration)
+
+	// StreamEnd is called when a stream ends with the number of tokens
+	// received and the time from the first token to the last. Each chunk
+	// counts as a token, since the API streams one token per chunk.
+	StreamEnd(endpoint string, model string, tokens int, duration time.Duration)
+}
+
+// WithMetrics makes the client report its requests to m.
+func WithMetrics(m Metrics) func(cln *Client) {
+	return func(cln *Client) {
+		cln.metrics = m
+	}
+}
+
+// =============================================================================
+
+// requestMetrics reports a single request. Its methods do nothing when the
+// client has no metrics.
+type requestMetrics struct {
+	m        Metrics
+	endpoint string
+	model    string
+	start    time.Time
+	first    time.Time
+	tokens   int
+}
+
+func (cln *Client) startMetrics(endpoint string, body D) *requestMetrics {
+	if cln.metrics == nil {
+		return nil
+	}
+
+	rm := requestMetrics{
+		m:     cln.metrics,
+		start: time.Now(),
+	}
+
+	rm.endpoint, rm.model = describe(endpoint, body)
+	rm.m.RequestStart(rm.endpoint, rm.model)
+
+	return &rm
+}
+
+func (rm *requestMetrics) end(err error) {
+	if rm == nil {
+		return
+	}
+
+	rm.m.RequestEnd(rm.endpoint, rm.model, statusOf(err), time.Since(rm.start))
+}
+
+// chunk counts a chunk of a stream.
+func (rm *requestMetrics) chunk() {
+	if rm == nil {
+		return
+	}
+
+	if rm.first.IsZero() {
+		rm.first = time.Now()
+		rm.m.StreamFirstToken(rm.endpoint, rm.model, rm.first.Sub(rm.start))
+	}
+
+	rm.tokens++
+}
+
+func (rm *requestMetrics) endStream(err error) {
+	if rm == nil {
+		return
+	}
+
+	if !rm.first.IsZero() {
+		rm.m.StreamEnd(rm.endpoint, rm.model, rm.tokens, time.Since(rm.first))
+	}
+
+	rm.end(err)
+}
+
+// retry reports that the request in body failed with err on the attempt and
+// is sent again.
+func (cln *Client) retry(ctx context.Context, method string, endpoint string, body D, attempt int, err error) {
+	path, model := describe(endpoint, body)
+
+	if cln.metrics != nil {
+		cln.metrics.Retry(path, model)
+	}
+
+	if cln.tracer != nil {
+		cln.tracer.Retry(ctx, TraceRequest{Method: method, Endpoint: path, Model: model}, attempt, withoutBody(err))
+	}
+}
@@ -567,6 +567,49 @@ func embeddingTests(srv *service) []table {
 				return cmp.Diff(got, exp)
 			},
 		},
+		{
+			Name: "float32",
+			ExpResp: client.Embedding32{
+				ID:      "emb-0qU4sYEutZvkHskxXwzYDgZVOhtLw",
+				Object:  "list",
+				Created: client.ToTime(1717439154),
+				Model:   "bridgetower-large-itm-mlm-itc",
+				Data: []client.EmbeddingData32{
+					{
+						Index:  0,
+						Object: "embedding",
+						Embedding: []float32{
+							0.04457271471619606,
+						},
+					},
+				},
+			},
+			ExcFunc: func(ctx context.Context) any {
+				ctx, cancel := context.WithTimeout(ctx, time.Second)
+				defer cancel()
+
+				d := client.D{
+					"model": "bridgetower-large-itm-mlm-itc",
+					"input": []client.D{
+						{
+							"text": "This is Bill Kennedy, a decent Go developer.",
+						},
+					},
+				}
+
+				url := srv.server.URL + "/embeddings"
+
+				var resp client.Embedding32
+				if err := srv.Client.Do(ctx, http.MethodPost, url, d, &resp); err != nil {
+					return err
+				}
+
+				return resp
+			},
+			CmpFunc: func(got any, exp any) string {
+				return cmp.Diff(got, exp)
+			},
+		},
 	}
 
 	return table
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+// Tracer starts a span for each request made by a client, so calls to the
+// API can be correlated with distributed traces. The otel module provides an
+// implementation built on OpenTelemetry. Errors passed to a tracer have the
+// response bodies they quote replaced by their size, as in request logs.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start is called when a request is sent. The returned context is used
+	// for the request, so a tracer can add a trace parent to it with
+	// WithTraceParent to propagate the trace to the API.
+	Start(ctx context.Context, req TraceRequest) (context.Context, Span)
+
+	// Retry is called before a failed request is sent again, with the
+	// number of the attempt that failed, starting at 1.
+	Retry(ctx context.Context, req TraceRequest, attempt int, err error)
+}
+
+// Span traces a single request or stream.
+type Span interface {
+	// FirstByte is called when the first chunk of a stream arrives.
+	FirstByte()
+
+	// Error is called when the request or stream fails.
+	Error(err error)
+
+	// End is called once when the request completes or the stream ends.
+	End(res TraceResult)
+}
+
+// TraceRequest describes a request being traced.
+type TraceRequest struct {
+	Method   string
+	Endpoint string
+	Model    string
+	Stream   bool
+}
+
+// TraceResult describes the outcome of a traced request. The token counts
+// are taken from the usage of the response when it reports one, and a
+// stream counts each chunk as a token.
+type TraceResult struct {
+	Status           int
+	RequestID        string
+	PromptTokens     int
+	CompletionTokens int
+	StreamTokens     int
+}
+
+// RequestIDHeader is the response header holding the ID the API assigned to
+// a request.
+const RequestIDHeader = "X-Request-Id"
+
+// WithTracer makes the client trace its requests with t.
+func WithTracer(t Tracer) func(cln *Client) {
+	return func(cln *Client) {
+		cln.tracer = t
+	}
+}
+
+// =============================================================================
+
+type traceParentKey struct{}
+
+type traceParent struct {
+	parent string
+	state  string
+}
+
+var validTraceParent = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// WithTraceParent returns a context whose requests carry the W3C traceparent
+// and tracestate headers. A malformed trace parent is ignored, as the
+// specification requires, and an empty state is not sent.
+func WithTraceParent(ctx context.Context, parent string, state string) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, traceParent{parent: parent, state: state})
+}
+
+// TraceParent returns the trace parent and state in the context, when it
+// holds a valid trace parent.
+func TraceParent(ctx context.Context) (string, string, bool) {
+	tp, ok := ctx.Value(traceParentKey{}).(traceParent)
+	if !ok || !validTraceParentString(tp.parent) {
+		return "", "", false
+	}
+
+	return tp.parent, tp.state, true
+}
+
+func validTraceParentString(s string) bool {
+	if !validTraceParent.MatchString(s) {
+		return false
+	}
+
+	// The version ff is invalid and so are all zero trace and parent IDs.
+	switch {
+	case s[:2] == "ff":
+		return false
+	case s[3:35] == "00000000000000000000000000000000":
+		return false
+	case s[36:52] == "0000000000000000":
+		return false
+	}
+
+	return true
+}
+
+// setTraceHeaders propagates the trace parent in the context to req.
+func setTraceHeaders(ctx context.Context, req *http.Request) {
+	parent, state, ok := TraceParent(ctx)
+	if !ok {
+		return
+	}
+
+	req.Header.Set("traceparent", parent)
+	if state != "" {
+		req.Header.Set("tracestate", state)
+	}
+}
+
+// =============================================================================
+
+// requestTrace traces a single request. Its methods do nothing when the
+// client has no tracer.
+type requestTrace struct {
+	span   Span
+	call   *call
+	tokens int
+}
+
+func (cln *Client) startTrace(ctx context.Context, c *call, method string, endpoint string, body D, stream bool) (context.Context, *requestTrace) {
+	if cln.tracer == nil {
+		return ctx, nil
+	}
+
+	req := TraceRequest{
+		Method: method,
+		Stream: stream,
+	}
+	req.Endpoint, req.Model = describe(endpoint, body)
+
+	rt := requestTrace{
+		call: c,
+	}
+
+	ctx, rt.span = cln.tracer.Start(ctx, req)
+
+	return ctx, &rt
+}
+
+// end ends the span of a request, taking the token counts from the usage
+// of the response.
+func (rt *requestTrace) end(data []byte, v any, err error) {
+	if rt == nil {
+		return
+	}
+
+	res := rt.result(err)
+
+	if err == nil {
+		if usage, _ := responseUsage(data, v); usage != nil {
+			res.PromptTokens = usage.PromptTokens
+			res.CompletionTokens = usage.CompletionTokens
+		}
+	}
+
+	rt.span.End(res)
+}
+
+// chunk counts a chunk of a stream.
+func (rt *requestTrace) chunk() {
+	if rt == nil {
+		return
+	}
+
+	if rt.tokens == 0 {
+		rt.span.FirstByte()
+	}
+
+	rt.tokens++
+}
+
+func (rt *requestTrace) endStream(err error) {
+	if rt == nil {
+		return
+	}
+
+	res := rt.result(err)
+	res.StreamTokens = rt.tokens
+
+	rt.span.End(res)
+}
+
+func (rt *requestTrace) result(err error) TraceResult {
+	if err != nil {
+		rt.span.Error(withoutBody(err))
+	}
+
+	res := TraceResult{
+		Status:    statusOf(err),
+		RequestID: rt.call.requestID(),
+	}
+
+	return res
+}
@@ -0,0 +1,193 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// recordTracer records the events of its spans as strings.
+type recordTracer struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (rt *recordTracer) add(format string, v ...any) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.events = append(rt.events, fmt.Sprintf(format, v...))
+}
+
+func (rt *recordTracer) Events() []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	return append([]string(nil), rt.events...)
+}
+
+func (rt *recordTracer) Start(ctx context.Context, req client.TraceRequest) (context.Context, client.Span) {
+	rt.add("start %s %s %s stream=%t", req.Method, req.Endpoint, req.Model, req.Stream)
+	return client.WithTraceParent(ctx, parent, "pg=1"), &recordSpan{rt: rt, endpoint: req.Endpoint}
+}
+
+func (rt *recordTracer) Retry(ctx context.Context, req client.TraceRequest, attempt int, err error) {
+	rt.add("retry %s %d", req.Endpoint, attempt)
+	rt.leaked(err)
+}
+
+// leaked records the errors quoting a response body.
+func (rt *recordTracer) leaked(err error) {
+	if strings.Contains(err.Error(), "busy") {
+		rt.add("leaked body %s", err)
+	}
+}
+
+type recordSpan struct {
+	rt       *recordTracer
+	endpoint string
+}
+
+func (s *recordSpan) FirstByte() {
+	s.rt.add("first byte %s", s.endpoint)
+}
+
+func (s *recordSpan) Error(err error) {
+	s.rt.add("error %s", s.endpoint)
+	s.rt.leaked(err)
+}
+
+func (s *recordSpan) End(res client.TraceResult) {
+	s.rt.add("end %s status=%d id=%s prompt=%d completion=%d stream=%d", s.endpoint, res.Status, res.RequestID, res.PromptTokens, res.CompletionTokens, res.StreamTokens)
+}
+
+func Test_Trace(t *testing.T) {
+	var embedCalls atomic.Int32
+	var headers sync.Map
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		headers.Store("traceparent", r.Header.Get("traceparent"))
+		headers.Store("tracestate", r.Header.Get("tracestate"))
+
+		w.Header().Set(client.RequestIDHeader, "req-1")
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1717439154,"model":"hermes","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(client.RequestIDHeader, fmt.Sprintf("req-emb-%d", embedCalls.Add(1)))
+
+		if embedCalls.Load() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `the server is busy`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"emb-1","object":"embedding_batch","created":1717439154,"model":"bridgetower","data":[{"index":0,"object":"embedding","embedding":[0.5]}]}`)
+	})
+	mux.HandleFunc("POST /stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(client.RequestIDHeader, "req-stream")
+
+		for _, word := range []string{"one", "two", "three"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tracer := recordTracer{}
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key", client.WithTracer(&tracer))
+	sse := client.NewSSE[client.ChatSSE](logger, "key", client.WithTracer(&tracer))
+
+	ctx := context.Background()
+
+	var resp client.Chat
+	if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", client.D{"model": "hermes"}, &resp); err != nil {
+		t.Fatalf("Should be able to chat: %s", err)
+	}
+
+	if v, _ := headers.Load("traceparent"); v != parent {
+		t.Fatalf("Should propagate the trace parent, got %q", v)
+	}
+
+	if v, _ := headers.Load("tracestate"); v != "pg=1" {
+		t.Fatalf("Should propagate the trace state, got %q", v)
+	}
+
+	cfg := client.EmbedConfig{Backoff: 1}
+	if _, err := cln.EmbedAll(ctx, srv.URL+"/embeddings", "bridgetower", []client.D{{"text": "a rose"}}, cfg); err != nil {
+		t.Fatalf("Should be able to embed after a retry: %s", err)
+	}
+
+	ch := make(chan client.ChatSSE)
+	if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", client.D{"model": "hermes"}, ch); err != nil {
+		t.Fatalf("Should be able to stream: %s", err)
+	}
+	for range ch {
+	}
+
+	exp := []string{
+		"start POST /chat/completions hermes stream=false",
+		"end /chat/completions status=200 id=req-1 prompt=10 completion=5 stream=0",
+		"start POST /embeddings bridgetower stream=false",
+		"error /embeddings",
+		"end /embeddings status=503 id=req-emb-1 prompt=0 completion=0 stream=0",
+		"retry /embeddings 1",
+		"start POST /embeddings bridgetower stream=false",
+		"end /embeddings status=200 id=req-emb-2 prompt=0 completion=0 stream=0",
+		"start POST /stream hermes stream=true",
+		"first byte /stream",
+		"end /stream status=200 id=req-stream prompt=0 completion=0 stream=3",
+	}
+
+	// The stream span ends after its channel is closed.
+	var events []string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if events = tracer.Events(); len(events) == len(exp) {
+			break
+		}
+	}
+
+	if strings.Join(events, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("Should trace the requests\ngot:\n%s\nexp:\n%s", strings.Join(events, "\n"), strings.Join(exp, "\n"))
+	}
+}
+
+func Test_TraceParent(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		valid  bool
+	}{
+		{"valid", parent, true},
+		{"uppercase", strings.ToUpper(parent), false},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"version-ff", "ff" + parent[2:], false},
+		{"zero-trace", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"zero-parent", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+	}
+
+	for _, tt := range tests {
+		ctx := client.WithTraceParent(context.Background(), tt.parent, "")
+
+		if _, _, ok := client.TraceParent(ctx); ok != tt.valid {
+			t.Fatalf("%s: Should get valid %t, got %t", tt.name, tt.valid, ok)
+		}
+	}
+
+	if _, _, ok := client.TraceParent(context.Background()); ok {
+		t.Fatalf("Should not find a trace parent in an empty context")
+	}
+}
@@ -50,6 +50,15 @@ func (t Time) MarshalJSON() ([]byte, error) {
 
 // =============================================================================
 
+// Usage represents the token counts a response reports for the request.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// =============================================================================
+
 type ModelCapabilities struct {
 	ChatCompletion     bool `json:"chat_completion"`
 	ChatWithImage      bool `json:"chat_with_image"`
@@ -77,14 +86,18 @@ type ModelResponse struct {
 
 // =============================================================================
 
+// ChatMessage represents a chat message. A message mixing text and images
+// sets Parts, which are sent in place of Content.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string        `json:"role"`
+	Content string        `json:"content"`
+	Parts   []ContentPart `json:"-"`
 }
 
 type ChatChoice struct {
-	Index   int         `json:"index"`
-	Message ChatMessage `json:"message"`
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason,omitempty"`
 }
 
 type Chat struct {
@@ -93,6 +106,7 @@ type Chat struct {
 	Created Time         `json:"created"`
 	Model   string       `json:"model"`
 	Choices []ChatChoice `json:"choices"`
+	Usage   *Usage       `json:"usage,omitempty"`
 }
 
 // =============================================================================
@@ -115,36 +129,33 @@ type ChatSSE struct {
 	Created Time            `json:"created"`
 	Model   string          `json:"model"`
 	Choices []ChatSSEChoice `json:"choices"`
+	Usage   *Usage          `json:"usage,omitempty"`
 	Error   string          `json:"error"`
 }
 
 // =============================================================================
 
-type ChatVisionMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
+// ChatVisionMessage represents a message for the vision call.
+//
+// Deprecated: Use ChatMessage, which covers text and vision.
+type ChatVisionMessage = ChatMessage
 
 // ChatVisionChoice represents a choice for the vision call.
-type ChatVisionChoice struct {
-	Index   int               `json:"index"`
-	Message ChatVisionMessage `json:"message"`
-}
+//
+// Deprecated: Use ChatChoice, which covers text and vision.
+type ChatVisionChoice = ChatChoice
 
 // ChatVision represents the result for the vision call.
-type ChatVision struct {
-	ID      string             `json:"id"`
-	Object  string             `json:"object"`
-	Created Time               `json:"created"`
-	Model   string             `json:"model"`
-	Choices []ChatVisionChoice `json:"choices"`
-}
+//
+// Deprecated: Use Chat, which covers text and vision.
+type ChatVision = Chat
 
 // =============================================================================
 
 type CompletionChoice struct {
-	Index int    `json:"index"`
-	Text  string `json:"text"`
+	Index        int    `json:"index"`
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason,omitempty"`
 }
 
 type Completion struct {
@@ -153,6 +164,7 @@ type Completion struct {
 	Created Time               `json:"created"`
 	Model   string             `json:"model"`
 	Choices []CompletionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
 }
 
 // =============================================================================
@@ -169,6 +181,26 @@ type Embedding struct {
 	Created Time            `json:"created"`
 	Model   string          `json:"model"`
 	Data    []EmbeddingData `json:"data"`
+	Usage   *Usage          `json:"usage,omitempty"`
+}
+
+// EmbeddingData32 is EmbeddingData with the vector decoded as float32, which
+// halves the memory used by each vector.
+type EmbeddingData32 struct {
+	Index     int       `json:"index"`
+	Object    string    `json:"object"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// Embedding32 can be passed to Do in place of Embedding to decode the
+// vectors directly as float32.
+type Embedding32 struct {
+	ID      string            `json:"id"`
+	Object  string            `json:"object"`
+	Created Time              `json:"created"`
+	Model   string            `json:"model"`
+	Data    []EmbeddingData32 `json:"data"`
+	Usage   *Usage            `json:"usage,omitempty"`
 }
 
 // =============================================================================
@@ -0,0 +1,636 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when a tenant has used up a budget that
+// rejects requests.
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// Set of outcomes of a tracked request.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeError    = "error"
+	OutcomeCanceled = "canceled"
+	OutcomeRejected = "rejected"
+)
+
+// Set of periods a budget applies to.
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// TokenCounter counts the tokens of an input for a model. A
+// tokenizer.Registry implements it.
+type TokenCounter interface {
+	Count(ctx context.Context, model string, input string) (int, error)
+}
+
+// =============================================================================
+
+type tenantKey struct{}
+
+type untrackedKey struct{}
+
+// WithTenant returns a context that attributes the requests made with it to
+// the tenant, such as a team or customer id.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the tenant set on the context, or an empty string.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// untracked reports if requests made with the context are internal to usage
+// tracking, such as counting tokens, and shouldn't be tracked themselves.
+func untracked(ctx context.Context) bool {
+	return ctx.Value(untrackedKey{}) != nil
+}
+
+// =============================================================================
+
+// UsageRecord represents the usage of a single request.
+type UsageRecord struct {
+	Tenant           string
+	Model            string
+	Endpoint         string
+	PromptTokens     int
+	CompletionTokens int
+
+	// Estimated is true when the response had no usage fields and the
+	// tokens were counted with the TokenCounter.
+	Estimated bool
+
+	// Shared is true when singleflight answered the request with the
+	// response of an identical request, so no tokens were used.
+	Shared bool
+
+	// Cached is true when a cache in front of the API, such as a
+	// cache.Transport, served the response, so no tokens were used.
+	Cached bool
+
+	Latency time.Duration
+	Status  int
+	Outcome string
+	Err     error
+	Time    time.Time
+}
+
+// Budget limits the tokens, prompt and completion combined, a tenant can use
+// per day and per month. A zero limit is unlimited.
+type Budget struct {
+	DailyTokens   int64
+	MonthlyTokens int64
+
+	// Warn reports tenants over the limit through UsageConfig.OnBudget
+	// instead of rejecting their requests.
+	Warn bool
+}
+
+// BudgetAlert describes a tenant reaching a budget limit.
+type BudgetAlert struct {
+	Tenant   string
+	Period   string
+	Limit    int64
+	Used     int64
+	Rejected bool
+}
+
+// UsageConfig defines the behavior of a UsageTracker.
+type UsageConfig struct {
+	// Counter counts tokens for responses that don't report usage. Without
+	// one those requests are recorded with zero tokens.
+	Counter TokenCounter
+
+	// DefaultBudget applies to tenants that aren't in Budgets.
+	DefaultBudget Budget
+
+	// Budgets holds the budget of specific tenants.
+	Budgets map[string]Budget
+
+	// Location sets where days and months start. The default is UTC.
+	Location *time.Location
+
+	// OnRecord is called with the record of every tracked request.
+	OnRecord func(ctx context.Context, rec UsageRecord)
+
+	// OnBudget is called once per period when a tenant reaches a limit and
+	// for every request rejected after that.
+	OnBudget func(ctx context.Context, alert BudgetAlert)
+
+	// Now returns the current time. The default is time.Now.
+	Now func() time.Time
+}
+
+// UsageTotals represents the usage summed over many requests.
+type UsageTotals struct {
+	Requests         int64
+	Errors           int64
+	Rejected         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Latency          time.Duration
+}
+
+// TenantUsage represents the usage of a tenant since the tracker started,
+// in total and by model, along with the tokens counted against the budget
+// of the current day and month.
+type TenantUsage struct {
+	UsageTotals
+	Models      map[string]UsageTotals
+	Day         string
+	DayTokens   int64
+	Month       string
+	MonthTokens int64
+}
+
+// UsageTracker records the usage of every request made by a client and
+// aggregates it per tenant, as set on the context with WithTenant. Budgets
+// are checked before a request is sent against the tokens already used, so
+// the request that crosses a limit still completes, and concurrent requests
+// can overshoot it. It is safe for concurrent use.
+type UsageTracker struct {
+	cfg     UsageConfig
+	mu      sync.Mutex
+	tenants map[string]*TenantUsage
+}
+
+// NewUsageTracker constructs a tracker with the specified config.
+func NewUsageTracker(cfg UsageConfig) *UsageTracker {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	budgets := make(map[string]Budget, len(cfg.Budgets))
+	for tenant, b := range cfg.Budgets {
+		budgets[tenant] = b
+	}
+	cfg.Budgets = budgets
+
+	t := UsageTracker{
+		cfg:     cfg,
+		tenants: make(map[string]*TenantUsage),
+	}
+
+	return &t
+}
+
+// WithUsageTracker makes the client record the usage of its requests with
+// the tracker and enforce its budgets.
+func WithUsageTracker(t *UsageTracker) func(cln *Client) {
+	return func(cln *Client) {
+		cln.usage = t
+	}
+}
+
+// SetBudget sets the budget of the tenant.
+func (t *UsageTracker) SetBudget(tenant string, b Budget) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cfg.Budgets[tenant] = b
+}
+
+// Usage returns the usage of the tenant.
+func (t *UsageTracker) Usage(tenant string) TenantUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tu, exists := t.tenants[tenant]
+	if !exists {
+		return TenantUsage{}
+	}
+
+	t.roll(tu)
+
+	return tu.clone()
+}
+
+// Snapshot returns the usage of every tenant seen so far.
+func (t *UsageTracker) Snapshot() map[string]TenantUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snap := make(map[string]TenantUsage, len(t.tenants))
+	for tenant, tu := range t.tenants {
+		t.roll(tu)
+		snap[tenant] = tu.clone()
+	}
+
+	return snap
+}
+
+// =============================================================================
+
+func (t *UsageTracker) do(ctx context.Context, cln *Client, method string, endpoint string, body D, v any) error {
+	rec := t.begin(ctx, endpoint, body)
+
+	if err := t.check(ctx, rec.Tenant); err != nil {
+		rec.Outcome = OutcomeRejected
+		rec.Err = err
+		t.record(ctx, rec)
+		return err
+	}
+
+	data, shared, cached, err := cln.send(ctx, method, endpoint, body, v)
+
+	rec.Shared = shared
+	rec.Cached = cached
+	t.end(ctx, &rec, err)
+
+	if err == nil && !shared && !cached {
+		usage, completion := responseUsage(data, v)
+
+		switch {
+		case usage != nil:
+			rec.PromptTokens = usage.PromptTokens
+			rec.CompletionTokens = usage.CompletionTokens
+
+		case t.cfg.Counter != nil && rec.Model != "" && !strings.HasSuffix(rec.Endpoint, "/tokenize"):
+			rec.Estimated = true
+			rec.PromptTokens, rec.CompletionTokens = t.estimate(ctx, cln, rec.Model, body, completion)
+		}
+	}
+
+	t.record(ctx, rec)
+
+	return err
+}
+
+// begin starts the record of a request.
+func (t *UsageTracker) begin(ctx context.Context, endpoint string, body D) UsageRecord {
+	rec := UsageRecord{
+		Tenant: Tenant(ctx),
+		Time:   t.cfg.Now(),
+	}
+
+	rec.Endpoint, rec.Model = describe(endpoint, body)
+
+	return rec
+}
+
+// end fills in the outcome of a request.
+func (t *UsageTracker) end(ctx context.Context, rec *UsageRecord, err error) {
+	rec.Latency = t.cfg.Now().Sub(rec.Time)
+	rec.Status = statusOf(err)
+	rec.Err = err
+
+	switch {
+	case err == nil:
+		rec.Outcome = OutcomeSuccess
+	case ctx.Err() != nil:
+		rec.Outcome = OutcomeCanceled
+	default:
+		rec.Outcome = OutcomeError
+	}
+}
+
+// estimate counts the tokens of the prompt in the request body and of the
+// completion. Failures are logged and counted as zero.
+func (t *UsageTracker) estimate(ctx context.Context, cln *Client, model string, body D, completion string) (int, int) {
+	ctx = context.WithValue(ctx, untrackedKey{}, true)
+
+	count := func(text string) int {
+		if text == "" {
+			return 0
+		}
+
+		n, err := t.cfg.Counter.Count(ctx, model, text)
+		if err != nil {
+			cln.log(ctx, "usage: count tokens", "model", model, "ERROR", err)
+			return 0
+		}
+
+		return n
+	}
+
+	prompt, tokens := promptText(body)
+
+	return tokens + count(prompt), count(completion)
+}
+
+// check rejects the request when the tenant is over a budget that doesn't
+// only warn.
+func (t *UsageTracker) check(ctx context.Context, tenant string) error {
+	t.mu.Lock()
+
+	b := t.budget(tenant)
+	tu := t.tenant(tenant)
+
+	var alert BudgetAlert
+	switch {
+	case b.DailyTokens > 0 && tu.DayTokens >= b.DailyTokens:
+		alert = BudgetAlert{Tenant: tenant, Period: PeriodDaily, Limit: b.DailyTokens, Used: tu.DayTokens}
+	case b.MonthlyTokens > 0 && tu.MonthTokens >= b.MonthlyTokens:
+		alert = BudgetAlert{Tenant: tenant, Period: PeriodMonthly, Limit: b.MonthlyTokens, Used: tu.MonthTokens}
+	}
+
+	t.mu.Unlock()
+
+	if b.Warn || alert.Period == "" {
+		return nil
+	}
+
+	alert.Rejected = true
+	if t.cfg.OnBudget != nil {
+		t.cfg.OnBudget(ctx, alert)
+	}
+
+	return fmt.Errorf("tenant %q, %s limit %d: %w", tenant, alert.Period, alert.Limit, ErrBudgetExceeded)
+}
+
+// record adds the request to the totals of its tenant and reports the
+// limits it crossed.
+func (t *UsageTracker) record(ctx context.Context, rec UsageRecord) {
+	t.mu.Lock()
+
+	tu := t.tenant(rec.Tenant)
+	tokens := int64(rec.PromptTokens + rec.CompletionTokens)
+
+	add := func(totals *UsageTotals) {
+		totals.Requests++
+		totals.PromptTokens += int64(rec.PromptTokens)
+		totals.CompletionTokens += int64(rec.CompletionTokens)
+		totals.Latency += rec.Latency
+
+		switch rec.Outcome {
+		case OutcomeRejected:
+			totals.Rejected++
+		case OutcomeError, OutcomeCanceled:
+			totals.Errors++
+		}
+	}
+
+	add(&tu.UsageTotals)
+
+	model := tu.Models[rec.Model]
+	add(&model)
+	tu.Models[rec.Model] = model
+
+	var alerts []BudgetAlert
+
+	b := t.budget(rec.Tenant)
+	crossed := func(period string, limit int64, used *int64) {
+		before := *used
+		*used += tokens
+
+		if limit > 0 && before < limit && *used >= limit {
+			alerts = append(alerts, BudgetAlert{Tenant: rec.Tenant, Period: period, Limit: limit, Used: *used})
+		}
+	}
+
+	crossed(PeriodDaily, b.DailyTokens, &tu.DayTokens)
+	crossed(PeriodMonthly, b.MonthlyTokens, &tu.MonthTokens)
+
+	t.mu.Unlock()
+
+	if t.cfg.OnBudget != nil {
+		for _, alert := range alerts {
+			t.cfg.OnBudget(ctx, alert)
+		}
+	}
+
+	if t.cfg.OnRecord != nil {
+		t.cfg.OnRecord(ctx, rec)
+	}
+}
+
+// budget returns the budget of the tenant. The lock must be held.
+func (t *UsageTracker) budget(tenant string) Budget {
+	if b, exists := t.cfg.Budgets[tenant]; exists {
+		return b
+	}
+	return t.cfg.DefaultBudget
+}
+
+// tenant returns the usage of the tenant for the current period, creating
+// it when needed. The lock must be held.
+func (t *UsageTracker) tenant(tenant string) *TenantUsage {
+	tu, exists := t.tenants[tenant]
+	if !exists {
+		tu = &TenantUsage{Models: make(map[string]UsageTotals)}
+		t.tenants[tenant] = tu
+	}
+
+	t.roll(tu)
+
+	return tu
+}
+
+// roll starts a new day or month when the current one is over. The lock
+// must be held.
+func (t *UsageTracker) roll(tu *TenantUsage) {
+	now := t.cfg.Now().In(t.cfg.Location)
+
+	if day := now.Format(time.DateOnly); tu.Day != day {
+		tu.Day = day
+		tu.DayTokens = 0
+	}
+
+	if month := now.Format("2006-01"); tu.Month != month {
+		tu.Month = month
+		tu.MonthTokens = 0
+	}
+}
+
+func (tu *TenantUsage) clone() TenantUsage {
+	c := *tu
+	c.Models = make(map[string]UsageTotals, len(tu.Models))
+	for model, totals := range tu.Models {
+		c.Models[model] = totals
+	}
+	return c
+}
+
+// =============================================================================
+
+// responseUsage returns the usage a response reports, if any, and the text
+// it generated.
+func responseUsage(data []byte, v any) (*Usage, string) {
+	switch r := v.(type) {
+	case *Embedding:
+		return r.Usage, ""
+	case *Embedding32:
+		return r.Usage, ""
+	}
+
+	var resp struct {
+		Usage   *Usage `json:"usage"`
+		Choices []struct {
+			Text    string      `json:"text"`
+			Message ChatMessage `json:"message"`
+		} `json:"choices"`
+	}
+
+	if len(data) == 0 || json.Unmarshal(data, &resp) != nil {
+		return nil, ""
+	}
+
+	var b strings.Builder
+	for _, c := range resp.Choices {
+		b.WriteString(c.Text)
+		b.WriteString(c.Message.Content)
+	}
+
+	return resp.Usage, b.String()
+}
+
+// promptText returns the text sent for the model to read, or the number of
+// tokens when the input is already tokenized.
+func promptText(body D) (string, int) {
+	var b strings.Builder
+	var tokens int
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(v)
+		case []string:
+			for _, s := range v {
+				walk(s)
+			}
+		case []int:
+			tokens += len(v)
+		case [][]int:
+			for _, t := range v {
+				tokens += len(t)
+			}
+		case ChatMessage:
+			if v.Parts == nil {
+				walk(v.Content)
+			}
+			walk(v.Parts)
+		case []ChatMessage:
+			for _, m := range v {
+				walk(m)
+			}
+		case []ContentPart:
+			for _, p := range v {
+				if p.Type == PartText {
+					walk(p.Text)
+				}
+			}
+		case D:
+			walk(map[string]any(v))
+		case map[string]any:
+			for _, key := range []string{"content", "text"} {
+				if c, exists := v[key]; exists {
+					walk(c)
+				}
+			}
+		case []D:
+			for _, d := range v {
+				walk(d)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+
+	for _, key := range []string{"messages", "prompt", "input"} {
+		if v, exists := body[key]; exists {
+			walk(v)
+		}
+	}
+
+	return b.String(), tokens
+}
+
+// trackStream records the usage of a streamed response once it ends.
+type trackStream struct {
+	tracker    *UsageTracker
+	cln        *Client
+	body       D
+	rec        UsageRecord
+	usage      *Usage
+	chunks     int
+	completion strings.Builder
+}
+
+// chunk takes the usage and generated text from a streamed chunk.
+func (ts *trackStream) chunk(v any) {
+	ts.chunks++
+
+	c, ok := v.(ChatSSE)
+	if !ok {
+		return
+	}
+
+	if c.Usage != nil {
+		ts.usage = c.Usage
+	}
+
+	for _, choice := range c.Choices {
+		ts.completion.WriteString(choice.Delta.Content)
+	}
+}
+
+// finish records the stream with the error that ended it, if any. A stream
+// that failed or was canceled part way is billed for the chunks that
+// arrived, so their tokens are recorded too.
+func (ts *trackStream) finish(ctx context.Context, err error) {
+	t := ts.tracker
+	t.end(ctx, &ts.rec, err)
+
+	// The tokens are still counted when the stream ended with the context.
+	ctx = context.WithoutCancel(ctx)
+
+	if (err == nil || ts.chunks > 0) && !ts.rec.Cached {
+		switch {
+		case ts.usage != nil:
+			ts.rec.PromptTokens = ts.usage.PromptTokens
+			ts.rec.CompletionTokens = ts.usage.CompletionTokens
+
+		case t.cfg.Counter != nil && ts.rec.Model != "":
+			ts.rec.Estimated = true
+			ts.rec.PromptTokens, ts.rec.CompletionTokens = t.estimate(ctx, ts.cln, ts.rec.Model, ts.body, ts.completion.String())
+		}
+	}
+
+	t.record(ctx, ts.rec)
+}
+
+// stream starts tracking a streamed request. It returns nil when the client
+// doesn't track usage.
+func (t *UsageTracker) stream(ctx context.Context, cln *Client, endpoint string, body D) (*trackStream, error) {
+	if t == nil || untracked(ctx) {
+		return nil, nil
+	}
+
+	ts := trackStream{
+		tracker: t,
+		cln:     cln,
+		body:    body,
+		rec:     t.begin(ctx, endpoint, body),
+	}
+
+	if err := t.check(ctx, ts.rec.Tenant); err != nil {
+		ts.rec.Outcome = OutcomeRejected
+		ts.rec.Err = err
+		t.record(ctx, ts.rec)
+		return nil, err
+	}
+
+	return &ts, nil
+}
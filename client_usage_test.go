@@ -0,0 +1,341 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// wordCounter counts tokens as words, and counts its calls.
+type wordCounter struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (wc *wordCounter) Count(ctx context.Context, model string, input string) (int, error) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	wc.calls++
+	return len(strings.Fields(input)), nil
+}
+
+func Test_Usage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1717439154,"model":"hermes","choices":[{"index":0,"message":{"role":"assistant","content":"I am fine"}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+	})
+	mux.HandleFunc("POST /completions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"cmpl-1","object":"text_completion","created":1717439154,"model":"hermes","choices":[{"index":0,"text":"four words right here"}]}`)
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"emb-1","object":"embedding_batch","created":1717439154,"model":"bridgetower","data":[{"index":0,"object":"embedding","embedding":[0.5]}],"usage":{"prompt_tokens":7,"total_tokens":7}}`)
+	})
+	mux.HandleFunc("POST /stream", func(w http.ResponseWriter, r *http.Request) {
+		for _, word := range []string{"one ", "two ", "three"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	mux.HandleFunc("POST /cached", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache", "HIT")
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1717439154,"model":"hermes","choices":[{"index":0,"message":{"role":"assistant","content":"I am fine"}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+	})
+	mux.HandleFunc("POST /stream-broken", func(w http.ResponseWriter, r *http.Request) {
+		for _, word := range []string{"one ", "two "} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: {broken\n\n")
+	})
+	mux.HandleFunc("POST /broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"error":"boom"}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+
+	newClient := func(cfg client.UsageConfig) (*client.Client, *client.UsageTracker, *[]client.UsageRecord) {
+		var mu sync.Mutex
+		var recs []client.UsageRecord
+
+		cfg.OnRecord = func(ctx context.Context, rec client.UsageRecord) {
+			mu.Lock()
+			defer mu.Unlock()
+			recs = append(recs, rec)
+		}
+
+		tracker := client.NewUsageTracker(cfg)
+		return client.New(logger, "key", client.WithUsageTracker(tracker)), tracker, &recs
+	}
+
+	t.Run("records", func(t *testing.T) {
+		counter := wordCounter{}
+		cln, tracker, recs := newClient(client.UsageConfig{Counter: &counter})
+
+		ctx := client.WithTenant(context.Background(), "search")
+
+		var chat client.Chat
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", client.D{"model": "hermes", "messages": "how are you"}, &chat); err != nil {
+			t.Fatalf("Should be able to chat: %s", err)
+		}
+
+		var completion client.D
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/completions", client.D{"model": "hermes", "prompt": "say four words"}, &completion); err != nil {
+			t.Fatalf("Should be able to complete: %s", err)
+		}
+
+		var embedding client.Embedding
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/embeddings", client.D{"model": "bridgetower", "input": []client.D{{"text": "a rose"}}}, &embedding); err != nil {
+			t.Fatalf("Should be able to embed: %s", err)
+		}
+
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/broken", client.D{"model": "hermes"}, nil); err == nil {
+			t.Fatalf("Should fail for the broken endpoint")
+		}
+
+		exp := []struct {
+			endpoint   string
+			prompt     int
+			completion int
+			estimated  bool
+			status     int
+			outcome    string
+		}{
+			{"/chat/completions", 10, 5, false, http.StatusOK, client.OutcomeSuccess},
+			{"/completions", 3, 4, true, http.StatusOK, client.OutcomeSuccess},
+			{"/embeddings", 7, 0, false, http.StatusOK, client.OutcomeSuccess},
+			{"/broken", 0, 0, false, http.StatusInternalServerError, client.OutcomeError},
+		}
+
+		if len(*recs) != len(exp) {
+			t.Fatalf("Should get %d records, got %d", len(exp), len(*recs))
+		}
+
+		for i, e := range exp {
+			rec := (*recs)[i]
+
+			if rec.Tenant != "search" || rec.Endpoint != e.endpoint || rec.PromptTokens != e.prompt ||
+				rec.CompletionTokens != e.completion || rec.Estimated != e.estimated ||
+				rec.Status != e.status || rec.Outcome != e.outcome {
+				t.Fatalf("Should get the expected record for %s, got %+v", e.endpoint, rec)
+			}
+		}
+
+		if counter.calls != 2 {
+			t.Fatalf("Should only count tokens for the completion, got %d calls", counter.calls)
+		}
+
+		usage := tracker.Usage("search")
+		if usage.Requests != 4 || usage.Errors != 1 || usage.PromptTokens != 20 || usage.CompletionTokens != 9 {
+			t.Fatalf("Should aggregate the records, got %+v", usage.UsageTotals)
+		}
+
+		if hermes := usage.Models["hermes"]; hermes.Requests != 3 || hermes.PromptTokens != 13 {
+			t.Fatalf("Should aggregate by model, got %+v", hermes)
+		}
+
+		if _, exists := tracker.Snapshot()[""]; exists {
+			t.Fatalf("Should not create an empty tenant")
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		counter := wordCounter{}
+
+		tracker := client.NewUsageTracker(client.UsageConfig{Counter: &counter})
+		sse := client.NewSSE[client.ChatSSE](logger, "key", client.WithUsageTracker(tracker))
+
+		ch := make(chan client.ChatSSE)
+		ctx := client.WithTenant(context.Background(), "chat")
+
+		if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", client.D{"model": "hermes", "messages": "count to three"}, ch); err != nil {
+			t.Fatalf("Should be able to stream: %s", err)
+		}
+
+		for range ch {
+		}
+
+		// The usage is recorded after the channel is closed.
+		deadline := time.Now().Add(time.Second)
+		for tracker.Usage("chat").Requests == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		usage := tracker.Usage("chat")
+		if usage.Requests != 1 || usage.PromptTokens != 3 || usage.CompletionTokens != 3 {
+			t.Fatalf("Should estimate the stream usage, got %+v", usage.UsageTotals)
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		counter := wordCounter{}
+		cln, tracker, recs := newClient(client.UsageConfig{Counter: &counter})
+
+		ctx := client.WithTenant(context.Background(), "search")
+
+		var chat client.Chat
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/cached", client.D{"model": "hermes", "messages": "how are you"}, &chat); err != nil {
+			t.Fatalf("Should be able to chat: %s", err)
+		}
+
+		if len(*recs) != 1 || !(*recs)[0].Cached || (*recs)[0].PromptTokens != 0 || (*recs)[0].CompletionTokens != 0 {
+			t.Fatalf("Should record the cache hit without tokens, got %+v", *recs)
+		}
+
+		if usage := tracker.Usage("search"); usage.Requests != 1 || usage.DayTokens != 0 {
+			t.Fatalf("Should not bill the cache hit, got %+v", usage)
+		}
+
+		if counter.calls != 0 {
+			t.Fatalf("Should not count tokens for the cache hit, got %d calls", counter.calls)
+		}
+	})
+
+	t.Run("stream-failed", func(t *testing.T) {
+		counter := wordCounter{}
+
+		tracker := client.NewUsageTracker(client.UsageConfig{Counter: &counter})
+		sse := client.NewSSE[client.ChatSSE](logger, "key", client.WithUsageTracker(tracker))
+
+		ch := make(chan client.ChatSSE)
+		ctx := client.WithTenant(context.Background(), "chat")
+
+		if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream-broken", client.D{"model": "hermes", "messages": "count to three"}, ch); err != nil {
+			t.Fatalf("Should be able to start the stream: %s", err)
+		}
+
+		for range ch {
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for tracker.Usage("chat").Requests == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		usage := tracker.Usage("chat")
+		if usage.Requests != 1 || usage.Errors != 1 || usage.PromptTokens != 3 || usage.CompletionTokens != 2 {
+			t.Fatalf("Should record the tokens of the chunks that arrived, got %+v", usage.UsageTotals)
+		}
+	})
+
+	t.Run("stream-canceled", func(t *testing.T) {
+		counter := wordCounter{}
+
+		tracker := client.NewUsageTracker(client.UsageConfig{Counter: &counter})
+		sse := client.NewSSE[client.ChatSSE](logger, "key", client.WithUsageTracker(tracker))
+
+		ch := make(chan client.ChatSSE)
+		ctx, cancel := context.WithCancel(client.WithTenant(context.Background(), "chat"))
+
+		if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", client.D{"model": "hermes", "messages": "count to three"}, ch); err != nil {
+			t.Fatalf("Should be able to start the stream: %s", err)
+		}
+
+		<-ch
+		cancel()
+
+		for range ch {
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for tracker.Usage("chat").Requests == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		usage := tracker.Usage("chat")
+		if usage.Requests != 1 || usage.PromptTokens != 3 || usage.CompletionTokens == 0 {
+			t.Fatalf("Should record the tokens of the canceled stream, got %+v", usage.UsageTotals)
+		}
+	})
+
+	t.Run("budgets", func(t *testing.T) {
+		now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+
+		var mu sync.Mutex
+		var alerts []client.BudgetAlert
+
+		cln, tracker, _ := newClient(client.UsageConfig{
+			DefaultBudget: client.Budget{DailyTokens: 20},
+			Budgets: map[string]client.Budget{
+				"warn":    {DailyTokens: 20, Warn: true},
+				"monthly": {MonthlyTokens: 30},
+			},
+			OnBudget: func(ctx context.Context, alert client.BudgetAlert) {
+				mu.Lock()
+				defer mu.Unlock()
+				alerts = append(alerts, alert)
+			},
+			Now: func() time.Time {
+				mu.Lock()
+				defer mu.Unlock()
+				return now
+			},
+		})
+
+		chat := func(tenant string) error {
+			ctx := client.WithTenant(context.Background(), tenant)
+
+			var resp client.Chat
+			return cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", client.D{"model": "hermes", "messages": "hi"}, &resp)
+		}
+
+		// Each chat uses 15 tokens, so the second crosses the limit and the
+		// third is rejected.
+		for i, tenant := range []string{"reject", "reject", "reject", "warn", "warn", "warn"} {
+			err := chat(tenant)
+
+			switch {
+			case tenant == "reject" && i == 2:
+				if !errors.Is(err, client.ErrBudgetExceeded) {
+					t.Fatalf("Should reject request %d, got %v", i, err)
+				}
+			case err != nil:
+				t.Fatalf("Should allow request %d: %s", i, err)
+			}
+		}
+
+		if len(alerts) != 3 || alerts[0].Tenant != "reject" || alerts[0].Used != 30 || alerts[1].Rejected != true || alerts[2].Tenant != "warn" {
+			t.Fatalf("Should alert when crossing and rejecting, got %+v", alerts)
+		}
+
+		if usage := tracker.Usage("reject"); usage.Requests != 3 || usage.Rejected != 1 || usage.DayTokens != 30 {
+			t.Fatalf("Should count the rejected request, got %+v", usage)
+		}
+
+		// A new day resets the daily budget but not the monthly one.
+		for range 2 {
+			if err := chat("monthly"); err != nil {
+				t.Fatalf("Should allow the monthly tenant: %s", err)
+			}
+		}
+
+		mu.Lock()
+		now = now.Add(time.Hour * 24)
+		mu.Unlock()
+
+		if err := chat("reject"); err != nil {
+			t.Fatalf("Should allow the tenant on a new day: %s", err)
+		}
+
+		if err := chat("monthly"); err != nil {
+			t.Fatalf("Should allow the monthly tenant in a new month: %s", err)
+		}
+
+		usage := tracker.Usage("monthly")
+		if usage.Month != "2026-02" || usage.MonthTokens != 15 {
+			t.Fatalf("Should start a new month, got %s %d", usage.Month, usage.MonthTokens)
+		}
+
+	})
+}
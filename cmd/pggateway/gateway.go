@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// maxBodyBytes bounds the size of an inbound request body, which leaves room
+// for base64 encoded images in chat messages.
+const maxBodyBytes = 16 << 20
+
+type gateway struct {
+	log    client.Logger
+	host   string
+	apiKey string
+	token  string
+	http   *http.Client
+	guard  guardConfig
+	input  client.D
+	output client.D
+}
+
+func newGateway(log client.Logger, cfg config) (*gateway, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	input, output, err := cfg.guard.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	// Guard settings would otherwise only apply to callers that send none.
+	if cfg.guard.configured() {
+		cfg.guard.enforce = true
+	}
+
+	gw := gateway{
+		log:    log,
+		host:   strings.TrimSuffix(cfg.host, "/"),
+		apiKey: cfg.apiKey,
+		token:  cfg.token,
+		http:   http.DefaultClient,
+		guard:  cfg.guard,
+		input:  input,
+		output: output,
+	}
+
+	return &gw, nil
+}
+
+func (gw *gateway) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/chat/completions", gw.chat)
+	mux.HandleFunc("POST /v1/completions", gw.completion)
+	mux.HandleFunc("POST /v1/embeddings", gw.embeddings)
+	mux.HandleFunc("GET /v1/models", gw.models)
+
+	return mux
+}
+
+// =============================================================================
+
+func (gw *gateway) chat(w http.ResponseWriter, r *http.Request) {
+	key, err := gw.key(r)
+	if err != nil {
+		gw.error(r.Context(), w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var req oaiChatRequest
+	if !gw.decode(w, r, &req) {
+		return
+	}
+
+	d := client.D{
+		"model":    req.Model,
+		"messages": req.Messages,
+	}
+
+	switch {
+	case req.MaxCompletionTokens != nil:
+		d["max_tokens"] = *req.MaxCompletionTokens
+	case req.MaxTokens != nil:
+		d["max_tokens"] = *req.MaxTokens
+	}
+
+	setOptional(d, req.Temperature, req.TopP, req.TopK)
+	gw.applyGuard(d, req.Input, req.Output)
+
+	url := gw.host + "/chat/completions"
+
+	if req.Stream {
+		gw.chatStream(w, r, key, url, d)
+		return
+	}
+
+	cln := client.New(gw.log, key, client.WithClient(gw.http))
+
+	var resp client.Chat
+	if err := cln.Do(r.Context(), http.MethodPost, url, d, &resp); err != nil {
+		gw.upstreamError(r.Context(), w, err)
+		return
+	}
+
+	out := oaiChat{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: resp.Created.Unix(),
+		Model:   resp.Model,
+		Choices: make([]oaiChatChoice, len(resp.Choices)),
+	}
+
+	for i, choice := range resp.Choices {
+		out.Choices[i] = oaiChatChoice{
+			Index: choice.Index,
+			Message: oaiChatMessage{
+				Role:    choice.Message.Role,
+				Content: choice.Message.Content,
+			},
+			FinishReason: finishReason(choice.FinishReason),
+		}
+	}
+
+	gw.respond(r.Context(), w, http.StatusOK, out)
+}
+
+func (gw *gateway) chatStream(w http.ResponseWriter, r *http.Request, key string, url string, d client.D) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		gw.error(r.Context(), w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	d["stream"] = true
+
+	cln := client.NewSSE[client.ChatSSE](gw.log, key, client.WithClient(gw.http))
+
+	ch := make(chan client.ChatSSE, 100)
+	if err := cln.Do(r.Context(), http.MethodPost, url, d, ch); err != nil {
+		gw.upstreamError(r.Context(), w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// The stream is complete once every choice has a finish reason. The
+	// channel also closes when the upstream stream fails, which must not
+	// look like a complete answer to the caller.
+	finished := make(map[int]bool)
+
+	var streamErr error
+
+	first := true
+	for resp := range ch {
+		if resp.Error != "" {
+			streamErr = errors.New(resp.Error)
+			break
+		}
+
+		chunk := oaiChatChunk{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created.Unix(),
+			Model:   resp.Model,
+			Choices: make([]oaiChatChunkChoice, len(resp.Choices)),
+		}
+
+		for i, choice := range resp.Choices {
+			c := oaiChatChunkChoice{
+				Index: choice.Index,
+				Delta: oaiChatDelta{
+					Content: choice.Delta.Content,
+				},
+			}
+
+			if first {
+				c.Delta.Role = client.Roles.Assistant.String()
+			}
+
+			c.FinishReason = finishReason(choice.FinishReason)
+			finished[choice.Index] = finished[choice.Index] || choice.FinishReason != ""
+
+			chunk.Choices[i] = c
+		}
+		first = false
+
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			streamErr = fmt.Errorf("encoding: %w", err)
+			break
+		}
+
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	// Drain the channel so the client goroutine can exit if we broke early.
+	go func() {
+		for range ch {
+		}
+	}()
+
+	if streamErr == nil {
+		for _, done := range finished {
+			if !done {
+				streamErr = errors.New("stream ended before the response was complete")
+				break
+			}
+		}
+
+		if len(finished) == 0 {
+			streamErr = errors.New("stream ended without a response")
+		}
+	}
+
+	// A failed stream ends with an error event and no done marker, so the
+	// caller can tell it from a complete answer.
+	if streamErr != nil {
+		gw.log(r.Context(), "pggateway: chat stream", "ERROR", streamErr)
+
+		data, _ := json.Marshal(oaiError{Error: oaiErrorBody{Message: streamErr.Error(), Type: "upstream_error"}})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+		return
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func (gw *gateway) completion(w http.ResponseWriter, r *http.Request) {
+	key, err := gw.key(r)
+	if err != nil {
+		gw.error(r.Context(), w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var req oaiCompletionRequest
+	if !gw.decode(w, r, &req) {
+		return
+	}
+
+	if req.Stream {
+		gw.error(r.Context(), w, http.StatusBadRequest, errors.New("stream is only supported for chat completions"))
+		return
+	}
+
+	d := client.D{
+		"model":  req.Model,
+		"prompt": req.Prompt,
+	}
+
+	if req.MaxTokens != nil {
+		d["max_tokens"] = *req.MaxTokens
+	}
+
+	setOptional(d, req.Temperature, req.TopP, req.TopK)
+	gw.applyGuard(d, req.Input, req.Output)
+
+	cln := client.New(gw.log, key, client.WithClient(gw.http))
+
+	var resp client.Completion
+	if err := cln.Do(r.Context(), http.MethodPost, gw.host+"/completions", d, &resp); err != nil {
+		gw.upstreamError(r.Context(), w, err)
+		return
+	}
+
+	out := oaiCompletion{
+		ID:      resp.ID,
+		Object:  "text_completion",
+		Created: resp.Created.Unix(),
+		Model:   resp.Model,
+		Choices: make([]oaiCompletionChoice, len(resp.Choices)),
+	}
+
+	if out.Model == "" {
+		out.Model = req.Model
+	}
+
+	for i, choice := range resp.Choices {
+		out.Choices[i] = oaiCompletionChoice{
+			Index:        choice.Index,
+			Text:         choice.Text,
+			FinishReason: finishReason(choice.FinishReason),
+		}
+	}
+
+	gw.respond(r.Context(), w, http.StatusOK, out)
+}
+
+func (gw *gateway) embeddings(w http.ResponseWriter, r *http.Request) {
+	key, err := gw.key(r)
+	if err != nil {
+		gw.error(r.Context(), w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var req oaiEmbeddingRequest
+	if !gw.decode(w, r, &req) {
+		return
+	}
+
+	input, err := embeddingInput(req.Input)
+	if err != nil {
+		gw.error(r.Context(), w, http.StatusBadRequest, err)
+		return
+	}
+
+	d := client.D{
+		"model": req.Model,
+		"input": input,
+	}
+
+	cln := client.New(gw.log, key, client.WithClient(gw.http))
+
+	var resp client.Embedding
+	if err := cln.Do(r.Context(), http.MethodPost, gw.host+"/embeddings", d, &resp); err != nil {
+		gw.upstreamError(r.Context(), w, err)
+		return
+	}
+
+	out := oaiEmbedding{
+		Object: "list",
+		Model:  resp.Model,
+		Data:   make([]oaiEmbeddingData, len(resp.Data)),
+	}
+
+	for i, data := range resp.Data {
+		out.Data[i] = oaiEmbeddingData{
+			Object:    "embedding",
+			Index:     data.Index,
+			Embedding: data.Embedding,
+		}
+	}
+
+	gw.respond(r.Context(), w, http.StatusOK, out)
+}
+
+func (gw *gateway) models(w http.ResponseWriter, r *http.Request) {
+	key, err := gw.key(r)
+	if err != nil {
+		gw.error(r.Context(), w, http.StatusUnauthorized, err)
+		return
+	}
+
+	cln := client.New(gw.log, key, client.WithClient(gw.http))
+
+	var resp client.ModelResponse
+	if err := cln.Do(r.Context(), http.MethodGet, gw.host+"/models", nil, &resp); err != nil {
+		gw.upstreamError(r.Context(), w, err)
+		return
+	}
+
+	out := oaiModelList{
+		Object: "list",
+		Data:   make([]oaiModel, len(resp.Data)),
+	}
+
+	for i, model := range resp.Data {
+		out.Data[i] = oaiModel{
+			ID:      model.ID,
+			Object:  "model",
+			Created: model.Created.Unix(),
+			OwnedBy: model.OwnedBy,
+		}
+	}
+
+	gw.respond(r.Context(), w, http.StatusOK, out)
+}
+
+// =============================================================================
+
+// key authenticates the request and returns the API key to use for it. With
+// a configured key, callers must present the gateway token and the key is
+// used in its place. Otherwise the inbound bearer token is passed through.
+func (gw *gateway) key(r *http.Request) (string, error) {
+	// A configured key without a token is only allowed on a loopback
+	// address, see config.validate.
+	if gw.apiKey != "" && gw.token == "" {
+		return gw.apiKey, nil
+	}
+
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		return "", errors.New("missing bearer token")
+	}
+
+	if gw.apiKey == "" {
+		return key, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key), []byte(gw.token)) != 1 {
+		return "", errors.New("invalid bearer token")
+	}
+
+	return gw.apiKey, nil
+}
+
+// decode decodes the request body into v, writing the error response when it
+// fails. Bodies over maxBodyBytes are rejected.
+func (gw *gateway) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		status := http.StatusBadRequest
+
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		gw.error(r.Context(), w, status, fmt.Errorf("decoding: %w", err))
+		return false
+	}
+
+	return true
+}
+
+// applyGuard sets the input and output guard settings for the request. When
+// the gateway enforces the settings, the caller's values are replaced.
+func (gw *gateway) applyGuard(d client.D, input map[string]any, output map[string]any) {
+	if gw.guard.enforce {
+		d["input"] = gw.input
+		d["output"] = gw.output
+		return
+	}
+
+	if input != nil {
+		d["input"] = input
+	}
+
+	if output != nil {
+		d["output"] = output
+	}
+}
+
+func (gw *gateway) respond(ctx context.Context, w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		gw.log(ctx, "pggateway: respond", "ERROR", err)
+	}
+}
+
+func (gw *gateway) error(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	gw.respond(ctx, w, status, oaiError{
+		Error: oaiErrorBody{
+			Message: err.Error(),
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
+// upstreamError responds with the client error of the API, so callers can
+// tell a bad request from a failing upstream, which is reported as 502.
+func (gw *gateway) upstreamError(ctx context.Context, w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+
+	switch code := client.StatusCode(err); {
+	case errors.Is(err, client.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case code >= 400 && code < 500:
+		status = code
+	}
+
+	gw.respond(ctx, w, status, oaiError{
+		Error: oaiErrorBody{
+			Message: err.Error(),
+			Type:    "upstream_error",
+		},
+	})
+}
+
+// =============================================================================
+
+// finishReason returns the finish reason of the API, or nil for the JSON null
+// when it didn't report one.
+func finishReason(reason string) *string {
+	if reason == "" {
+		return nil
+	}
+
+	return &reason
+}
+
+func setOptional(d client.D, temperature *float64, topP *float64, topK *int) {
+	if temperature != nil {
+		d["temperature"] = *temperature
+	}
+
+	if topP != nil {
+		d["top_p"] = *topP
+	}
+
+	if topK != nil {
+		d["top_k"] = *topK
+	}
+}
+
+// embeddingInput maps the OpenAI embedding input, which can be a string, a
+// list of strings, a list of token ids or a list of token id lists, to the
+// Prediction Guard input format.
+func embeddingInput(raw json.RawMessage) (any, error) {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return []client.D{{"text": str}}, nil
+	}
+
+	var strs []string
+	if err := json.Unmarshal(raw, &strs); err == nil {
+		input := make([]client.D, len(strs))
+		for i, s := range strs {
+			input[i] = client.D{"text": s}
+		}
+		return input, nil
+	}
+
+	var ids []int
+	if err := json.Unmarshal(raw, &ids); err == nil {
+		return [][]int{ids}, nil
+	}
+
+	var idss [][]int
+	if err := json.Unmarshal(raw, &idss); err == nil {
+		return idss, nil
+	}
+
+	return nil, errors.New("input must be a string, list of strings or token ids")
+}
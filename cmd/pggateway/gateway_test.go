@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Gateway(t *testing.T) {
+	var gotBody map[string]any
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer caller-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		if gotBody["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintln(w, `data: {"id":"chat-1","object":"chat.completion.chunk","created":1715734993,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"delta":{"content":" I"},"generated_text":null,"logprobs":0,"finish_reason":null}]}`)
+			if gotBody["model"] == "truncated" {
+				return
+			}
+			fmt.Fprintln(w, `data: {"id":"chat-1","object":"chat.completion.chunk","created":1715734995,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"delta":{},"generated_text":"I","logprobs":0,"finish_reason":"stop"}]}`)
+			fmt.Fprintln(w, `data: [DONE]`)
+			return
+		}
+
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1715628729,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"status":"success"}]}`)
+	})
+	mux.HandleFunc("POST /completions", func(w http.ResponseWriter, r *http.Request) {
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		if gotBody["model"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"model not found"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"id":"cmpl-1","object":"text_completion","created":1715628729,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"text":"hello","finish_reason":"length"},{"index":1,"text":"world"}]}`)
+	})
+	mux.HandleFunc("GET /models", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer caller-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"neural-chat-7b-v3-3","object":"model","created":"2024-06-01T00:00:00Z","owned_by":"Intel"}]}`)
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		fmt.Fprint(w, `{"id":"emb-1","object":"list","created":1717439154,"model":"multilingual-e5-large-instruct","data":[{"status":"success","index":0,"object":"embedding","embedding":[0.5,0.25]}]}`)
+	})
+
+	pg := httptest.NewServer(mux)
+	defer pg.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+
+	cfg := config{
+		host: pg.URL,
+		guard: guardConfig{
+			pii:        "replace",
+			toxicity:   true,
+			factuality: false,
+		},
+	}
+
+	gw, err := newGateway(logger, cfg)
+	if err != nil {
+		t.Fatalf("Should be able to construct the gateway: %s", err)
+	}
+
+	srv := httptest.NewServer(gw.routes())
+	defer srv.Close()
+
+	send := func(srv *httptest.Server, method string, path string, body string, key string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Should be able to call the gateway: %s", err)
+		}
+
+		return resp
+	}
+
+	post := func(path string, body string, key string) *http.Response {
+		return send(srv, http.MethodPost, path, body, key)
+	}
+
+	t.Run("chat", func(t *testing.T) {
+		resp := post("/v1/chat/completions", `{"model":"neural-chat-7b-v3-3","messages":[{"role":"user","content":"hi"}],"input":{"pii":"block"}}`, "caller-key")
+		defer resp.Body.Close()
+
+		var got oaiChat
+		json.NewDecoder(resp.Body).Decode(&got)
+
+		if got.Object != "chat.completion" || len(got.Choices) != 1 || got.Choices[0].Message.Content != "hello" {
+			t.Fatalf("Should get the mapped chat response, got %#v", got)
+		}
+
+		input, _ := gotBody["input"].(map[string]any)
+		if input["pii"] != "replace" {
+			t.Fatalf("Should enforce the input guard settings, got %v", gotBody["input"])
+		}
+	})
+
+	t.Run("chat-stream", func(t *testing.T) {
+		resp := post("/v1/chat/completions", `{"model":"neural-chat-7b-v3-3","messages":[{"role":"user","content":"hi"}],"stream":true}`, "caller-key")
+		defer resp.Body.Close()
+
+		var chunks []oaiChatChunk
+		var done bool
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+
+			if line == "data: [DONE]" {
+				done = true
+				continue
+			}
+
+			var chunk oaiChatChunk
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+				t.Fatalf("Should be able to decode the chunk: %s", err)
+			}
+			chunks = append(chunks, chunk)
+		}
+
+		if !done || len(chunks) != 2 {
+			t.Fatalf("Should get 2 chunks and a done marker, got %d chunks, done %v", len(chunks), done)
+		}
+
+		if chunks[0].Choices[0].Delta.Role != "assistant" || chunks[0].Choices[0].Delta.Content != " I" {
+			t.Fatalf("Should get the mapped first chunk, got %#v", chunks[0].Choices[0])
+		}
+
+		if fr := chunks[1].Choices[0].FinishReason; fr == nil || *fr != "stop" {
+			t.Fatalf("Should get a finish reason on the last chunk")
+		}
+	})
+
+	t.Run("chat-stream-truncated", func(t *testing.T) {
+		resp := post("/v1/chat/completions", `{"model":"truncated","messages":[{"role":"user","content":"hi"}],"stream":true}`, "caller-key")
+		defer resp.Body.Close()
+
+		var lines []string
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		if len(lines) != 2 {
+			t.Fatalf("Should get a chunk and an error event, got %q", lines)
+		}
+
+		var event oaiError
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil || event.Error.Type != "upstream_error" {
+			t.Fatalf("Should end the stream with an error event instead of a done marker, got %q", lines[1])
+		}
+	})
+
+	t.Run("chat-unauthorized", func(t *testing.T) {
+		resp := post("/v1/chat/completions", `{"model":"neural-chat-7b-v3-3","messages":"hi"}`, "bad-key")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Should get status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+	})
+
+	t.Run("embeddings", func(t *testing.T) {
+		resp := post("/v1/embeddings", `{"model":"multilingual-e5-large-instruct","input":["a"]}`, "caller-key")
+		defer resp.Body.Close()
+
+		var got oaiEmbedding
+		json.NewDecoder(resp.Body).Decode(&got)
+
+		if len(got.Data) != 1 || len(got.Data[0].Embedding) != 2 {
+			t.Fatalf("Should get the mapped embedding response, got %#v", got)
+		}
+
+		input, _ := gotBody["input"].([]any)
+		if len(input) != 1 || input[0].(map[string]any)["text"] != "a" {
+			t.Fatalf("Should map the input to text objects, got %v", gotBody["input"])
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		resp := post("/v1/completions", `{"model":"neural-chat-7b-v3-3","prompt":"say hello"}`, "caller-key")
+		defer resp.Body.Close()
+
+		var got oaiCompletion
+		json.NewDecoder(resp.Body).Decode(&got)
+
+		if got.Object != "text_completion" || len(got.Choices) != 2 || got.Choices[0].Text != "hello" {
+			t.Fatalf("Should get the mapped completion response, got %#v", got)
+		}
+
+		if fr := got.Choices[0].FinishReason; fr == nil || *fr != "length" {
+			t.Fatalf("Should pass through the finish reason, got %v", fr)
+		}
+
+		if fr := got.Choices[1].FinishReason; fr != nil {
+			t.Fatalf("Should not invent a finish reason, got %s", *fr)
+		}
+
+		if gotBody["prompt"] != "say hello" || gotBody["input"] == nil {
+			t.Fatalf("Should send the prompt with the guard settings, got %v", gotBody)
+		}
+	})
+
+	t.Run("completion-upstream-4xx", func(t *testing.T) {
+		resp := post("/v1/completions", `{"model":"missing","prompt":"say hello"}`, "caller-key")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("Should get status %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("models", func(t *testing.T) {
+		resp := send(srv, http.MethodGet, "/v1/models", "", "caller-key")
+		defer resp.Body.Close()
+
+		var got oaiModelList
+		json.NewDecoder(resp.Body).Decode(&got)
+
+		if got.Object != "list" || len(got.Data) != 1 || got.Data[0].ID != "neural-chat-7b-v3-3" || got.Data[0].OwnedBy != "Intel" || got.Data[0].Object != "model" {
+			t.Fatalf("Should get the mapped model list, got %#v", got)
+		}
+	})
+
+	t.Run("body-too-large", func(t *testing.T) {
+		body := `{"model":"neural-chat-7b-v3-3","prompt":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+
+		resp := post("/v1/completions", body, "caller-key")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Should get status %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		cfg := config{
+			addr:   "0.0.0.0:8080",
+			host:   pg.URL,
+			apiKey: "caller-key",
+			token:  "gateway-token",
+		}
+
+		gw, err := newGateway(logger, cfg)
+		if err != nil {
+			t.Fatalf("Should be able to construct the gateway: %s", err)
+		}
+
+		srv := httptest.NewServer(gw.routes())
+		defer srv.Close()
+
+		for _, key := range []string{"", "caller-key", "wrong-token"} {
+			resp := send(srv, http.MethodGet, "/v1/models", "", key)
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("Should reject the token %q, got %d", key, resp.StatusCode)
+			}
+		}
+
+		resp := send(srv, http.MethodGet, "/v1/models", "", "gateway-token")
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Should spend the configured key for the gateway token, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func Test_Config(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config
+		valid bool
+	}{
+		{"passthrough", config{addr: "0.0.0.0:8080"}, true},
+		{"key-on-loopback", config{addr: "127.0.0.1:8080", apiKey: "key"}, true},
+		{"key-on-localhost", config{addr: "localhost:8080", apiKey: "key"}, true},
+		{"key-with-token", config{addr: "0.0.0.0:8080", apiKey: "key", token: "token"}, true},
+		{"key-on-all-interfaces", config{addr: ":8080", apiKey: "key"}, false},
+		{"key-on-public-address", config{addr: "0.0.0.0:8080", apiKey: "key"}, false},
+		{"token-without-key", config{addr: "127.0.0.1:8080", token: "token"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err == nil) != tt.valid {
+			t.Fatalf("%s: Should get valid %t, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
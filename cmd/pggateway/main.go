@@ -0,0 +1,182 @@
+// This program provides an OpenAI compatible gateway in front of the
+// Prediction Guard API so tools that only speak the OpenAI wire format can
+// use Prediction Guard models.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run() error {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", envOr("PGGATEWAY_ADDR", "127.0.0.1:8080"), "address the gateway listens on")
+	flag.StringVar(&cfg.host, "host", envOr("PGGATEWAY_HOST", client.DefaultHost), "Prediction Guard API host")
+	flag.StringVar(&cfg.apiKey, "api-key", os.Getenv("PREDICTIONGUARD_API_KEY"), "key used for every request, if empty the inbound Authorization header is passed through")
+	flag.StringVar(&cfg.token, "token", os.Getenv("PGGATEWAY_TOKEN"), "bearer token callers must present when -api-key is set, required unless the gateway listens on a loopback address")
+	flag.BoolVar(&cfg.guard.enforce, "enforce", false, "enforce the input and output guard settings for every request, implied by any guard flag")
+	flag.StringVar(&cfg.guard.pii, "pii", "", "input pii setting to enforce: block or replace")
+	flag.StringVar(&cfg.guard.piiReplaceMethod, "pii-replace-method", "", "input pii replace method to enforce: random, fake, category or mask")
+	flag.BoolVar(&cfg.guard.injection, "block-injection", false, "enforce blocking prompt injection on input")
+	flag.BoolVar(&cfg.guard.factuality, "factuality", false, "enforce the factuality check on output")
+	flag.BoolVar(&cfg.guard.toxicity, "toxicity", false, "enforce the toxicity check on output")
+	flag.Parse()
+
+	logger := client.SlogLogger(slog.Default(), slog.LevelInfo)
+
+	gw, err := newGateway(logger, cfg)
+	if err != nil {
+		return fmt.Errorf("gateway: %w", err)
+	}
+
+	// -------------------------------------------------------------------------
+
+	srv := http.Server{
+		Addr:              cfg.addr,
+		Handler:           gw.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	serverErrors := make(chan error, 1)
+
+	go func() {
+		log.Println("pggateway: listening on", cfg.addr)
+		serverErrors <- srv.ListenAndServe()
+	}()
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrors:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server error: %w", err)
+		}
+
+	case sig := <-shutdown:
+		log.Println("pggateway: shutdown started", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			return fmt.Errorf("could not stop server gracefully: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func envOr(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// =============================================================================
+
+type config struct {
+	addr   string
+	host   string
+	apiKey string
+	token  string
+	guard  guardConfig
+}
+
+// validate refuses configurations that would let anyone who can reach the
+// gateway spend the configured API key.
+func (cfg config) validate() error {
+	if cfg.token != "" && cfg.apiKey == "" {
+		return errors.New("token requires an api key")
+	}
+
+	if cfg.apiKey != "" && cfg.token == "" && !loopback(cfg.addr) {
+		return fmt.Errorf("a token is required to serve the api key on %q, which isn't a loopback address", cfg.addr)
+	}
+
+	return nil
+}
+
+// loopback reports whether addr only accepts connections from this host. An
+// empty host listens on every interface.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type guardConfig struct {
+	enforce          bool
+	pii              string
+	piiReplaceMethod string
+	injection        bool
+	factuality       bool
+	toxicity         bool
+}
+
+// configured reports whether any guard setting was given.
+func (gc guardConfig) configured() bool {
+	return gc.pii != "" || gc.piiReplaceMethod != "" || gc.injection || gc.factuality || gc.toxicity
+}
+
+// settings validates the guard configuration and returns the input and
+// output documents to apply to chat and completion requests.
+func (gc guardConfig) settings() (client.D, client.D, error) {
+	input := client.D{}
+	output := client.D{}
+
+	if gc.pii != "" {
+		pii, err := client.PIIs.Parse(gc.pii)
+		if err != nil {
+			return nil, nil, err
+		}
+		input["pii"] = pii
+	}
+
+	if gc.piiReplaceMethod != "" {
+		method, err := client.ReplaceMethods.Parse(gc.piiReplaceMethod)
+		if err != nil {
+			return nil, nil, err
+		}
+		input["pii_replace_method"] = method
+	}
+
+	if gc.injection {
+		input["block_prompt_injection"] = true
+	}
+
+	output["factuality"] = gc.factuality
+	output["toxicity"] = gc.toxicity
+
+	return input, output, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// These types represent the subset of the OpenAI wire format the gateway
+// understands.
+
+type oaiError struct {
+	Error oaiErrorBody `json:"error"`
+}
+
+type oaiErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// =============================================================================
+
+type oaiChatRequest struct {
+	Model               string          `json:"model"`
+	Messages            json.RawMessage `json:"messages"`
+	MaxTokens           *int            `json:"max_tokens"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens"`
+	Temperature         *float64        `json:"temperature"`
+	TopP                *float64        `json:"top_p"`
+	TopK                *int            `json:"top_k"`
+	Stream              bool            `json:"stream"`
+	Input               map[string]any  `json:"input"`
+	Output              map[string]any  `json:"output"`
+}
+
+type oaiChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type oaiChatChoice struct {
+	Index        int            `json:"index"`
+	Message      oaiChatMessage `json:"message"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+type oaiChat struct {
+	ID      string          `json:"id"`
+	Object  string          `json:"object"`
+	Created int64           `json:"created"`
+	Model   string          `json:"model"`
+	Choices []oaiChatChoice `json:"choices"`
+}
+
+type oaiChatDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type oaiChatChunkChoice struct {
+	Index        int          `json:"index"`
+	Delta        oaiChatDelta `json:"delta"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type oaiChatChunk struct {
+	ID      string               `json:"id"`
+	Object  string               `json:"object"`
+	Created int64                `json:"created"`
+	Model   string               `json:"model"`
+	Choices []oaiChatChunkChoice `json:"choices"`
+}
+
+// =============================================================================
+
+type oaiCompletionRequest struct {
+	Model       string          `json:"model"`
+	Prompt      json.RawMessage `json:"prompt"`
+	MaxTokens   *int            `json:"max_tokens"`
+	Temperature *float64        `json:"temperature"`
+	TopP        *float64        `json:"top_p"`
+	TopK        *int            `json:"top_k"`
+	Stream      bool            `json:"stream"`
+	Input       map[string]any  `json:"input"`
+	Output      map[string]any  `json:"output"`
+}
+
+type oaiCompletionChoice struct {
+	Index        int     `json:"index"`
+	Text         string  `json:"text"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type oaiCompletion struct {
+	ID      string                `json:"id"`
+	Object  string                `json:"object"`
+	Created int64                 `json:"created"`
+	Model   string                `json:"model"`
+	Choices []oaiCompletionChoice `json:"choices"`
+}
+
+// =============================================================================
+
+type oaiEmbeddingRequest struct {
+	Model string          `json:"model"`
+	Input json.RawMessage `json:"input"`
+}
+
+type oaiEmbeddingData struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+type oaiEmbedding struct {
+	Object string             `json:"object"`
+	Model  string             `json:"model"`
+	Data   []oaiEmbeddingData `json:"data"`
+}
+
+// =============================================================================
+
+type oaiModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type oaiModelList struct {
+	Object string     `json:"object"`
+	Data   []oaiModel `json:"data"`
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -21,15 +22,7 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	logger := func(ctx context.Context, msg string, v ...any) {
-		s := fmt.Sprintf("msg: %s", msg)
-		for i := 0; i < len(v); i = i + 2 {
-			s = s + fmt.Sprintf(", %s: %v", v[i], v[i+1])
-		}
-		log.Println(s)
-	}
-
-	cln := client.New(logger, os.Getenv("PREDICTIONGUARD_API_KEY"))
+	cln := client.New(nil, os.Getenv("PREDICTIONGUARD_API_KEY"), client.WithSlog(slog.Default(), client.LogConfig{}))
 
 	// -------------------------------------------------------------------------
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -21,15 +22,7 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	logger := func(ctx context.Context, msg string, v ...any) {
-		s := fmt.Sprintf("msg: %s", msg)
-		for i := 0; i < len(v); i = i + 2 {
-			s = s + fmt.Sprintf(", %s: %v", v[i], v[i+1])
-		}
-		log.Println(s)
-	}
-
-	cln := client.New(logger, os.Getenv("PREDICTIONGUARD_API_KEY"))
+	cln := client.New(nil, os.Getenv("PREDICTIONGUARD_API_KEY"), client.WithSlog(slog.Default(), client.LogConfig{}))
 
 	// -------------------------------------------------------------------------
 
@@ -38,27 +31,19 @@ func run() error {
 		return fmt.Errorf("newimage: %w", err)
 	}
 
-	base64, err := image.EncodeBase64(ctx)
+	imagePart, err := client.NewImagePart(ctx, image)
 	if err != nil {
-		return fmt.Errorf("base64: %w", err)
+		return fmt.Errorf("imagepart: %w", err)
 	}
 
 	d := client.D{
 		"model": "llava-1.5-7b-hf",
-		"messages": []client.D{
+		"messages": []client.ChatMessage{
 			{
-				"role": client.Roles.User,
-				"content": []client.D{
-					{
-						"type": "text",
-						"text": "Is this a picture of a rose?",
-					},
-					{
-						"type": "image_url",
-						"image_url": client.D{
-							"url": fmt.Sprintf("data:image/png;base64,%s", base64),
-						},
-					},
+				Role: client.Roles.User.String(),
+				Parts: []client.ContentPart{
+					client.NewTextPart("Is this a picture of a rose?"),
+					imagePart,
 				},
 			},
 		},
@@ -80,7 +65,7 @@ func run() error {
 
 	const url = "https://api.predictionguard.com/chat/completions"
 
-	var resp client.ChatVision
+	var resp client.Chat
 	if err := cln.Do(ctx, http.MethodPost, url, d, &resp); err != nil {
 		return fmt.Errorf("do: %w", err)
 	}
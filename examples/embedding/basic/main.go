@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"time"
 
@@ -21,15 +21,7 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	logger := func(ctx context.Context, msg string, v ...any) {
-		s := fmt.Sprintf("msg: %s", msg)
-		for i := 0; i < len(v); i = i + 2 {
-			s = s + fmt.Sprintf(", %s: %v", v[i], v[i+1])
-		}
-		log.Println(s)
-	}
-
-	cln := client.New(logger, os.Getenv("PREDICTIONGUARD_API_KEY"))
+	cln := client.New(nil, os.Getenv("PREDICTIONGUARD_API_KEY"), client.WithSlog(slog.Default(), client.LogConfig{}))
 
 	// -------------------------------------------------------------------------
 
@@ -38,32 +30,24 @@ func run() error {
 		return fmt.Errorf("newimage: %w", err)
 	}
 
-	base64, err := image.EncodeBase64(ctx)
-	if err != nil {
-		return fmt.Errorf("base64: %w", err)
-	}
-
 	// -------------------------------------------------------------------------
 
-	d := client.D{
-		"model":              "bridgetower-large-itm-mlm-itc",
-		"truncate":           true,
-		"truncate_direction": client.Directions.Right,
-		"input": []client.D{
-			{
-				"text":  "A picture of a rose",
-				"image": base64,
-			},
+	req := client.EmbeddingRequest{
+		Model:     "bridgetower-large-itm-mlm-itc",
+		Truncate:  true,
+		Direction: client.Directions.Right,
+		Input: []client.EmbeddingInput{
+			client.NewTextImageInput("A picture of a rose", image),
 		},
 	}
 
 	// -------------------------------------------------------------------------
 
-	const url = "https://api.predictionguard.com/embeddings"
+	const host = "https://api.predictionguard.com"
 
-	var resp client.Embedding
-	if err := cln.Do(ctx, http.MethodPost, url, d, &resp); err != nil {
-		return fmt.Errorf("do: %w", err)
+	resp, err := cln.Embed(ctx, host, req)
+	if err != nil {
+		return fmt.Errorf("embed: %w", err)
 	}
 
 	for _, data := range resp.Data {
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"time"
 
@@ -21,33 +21,24 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	logger := func(ctx context.Context, msg string, v ...any) {
-		s := fmt.Sprintf("msg: %s", msg)
-		for i := 0; i < len(v); i = i + 2 {
-			s = s + fmt.Sprintf(", %s: %v", v[i], v[i+1])
-		}
-		log.Println(s)
-	}
-
-	cln := client.New(logger, os.Getenv("PREDICTIONGUARD_API_KEY"))
+	cln := client.New(nil, os.Getenv("PREDICTIONGUARD_API_KEY"), client.WithSlog(slog.Default(), client.LogConfig{}))
 
 	// -------------------------------------------------------------------------
 
-	d := client.D{
-		"model":    "bridgetower-large-itm-mlm-itc",
-		"truncate": false,
-		"input": [][]int{
-			{0, 3293, 83, 19893, 118963, 25, 7, 3034, 5, 2},
+	req := client.EmbeddingRequest{
+		Model: "bridgetower-large-itm-mlm-itc",
+		Input: []client.EmbeddingInput{
+			client.NewTokensInput([]int{0, 3293, 83, 19893, 118963, 25, 7, 3034, 5, 2}),
 		},
 	}
 
 	// -------------------------------------------------------------------------
 
-	const url = "https://api.predictionguard.com/embeddings"
+	const host = "https://api.predictionguard.com"
 
-	var resp client.Embedding
-	if err := cln.Do(ctx, http.MethodPost, url, d, &resp); err != nil {
-		return fmt.Errorf("do: %w", err)
+	resp, err := cln.Embed(ctx, host, req)
+	if err != nil {
+		return fmt.Errorf("embed: %w", err)
 	}
 
 	for _, data := range resp.Data {
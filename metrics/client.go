@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// Default buckets of the client histograms.
+var (
+	DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	DefaultTTFTBuckets    = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10}
+	DefaultRateBuckets    = []float64{1, 5, 10, 20, 40, 80, 160}
+)
+
+// DefaultNamespace prefixes the names of the client metrics.
+const DefaultNamespace = "predictionguard"
+
+// Config defines the names and buckets of the client metrics.
+type Config struct {
+	// Namespace prefixes every metric name.
+	Namespace string
+
+	// LatencyBuckets bound the request latency histogram, in seconds.
+	LatencyBuckets []float64
+
+	// TTFTBuckets bound the stream time to first token histogram, in
+	// seconds.
+	TTFTBuckets []float64
+
+	// RateBuckets bound the stream tokens per second histogram.
+	RateBuckets []float64
+}
+
+// Metrics implements client.Metrics and serves the measurements in the
+// Prometheus text format:
+//
+//	<namespace>_requests_total{endpoint,model,status}
+//	<namespace>_request_duration_seconds{endpoint,model}
+//	<namespace>_requests_in_flight{endpoint,model}
+//	<namespace>_retries_total{endpoint,model}
+//	<namespace>_stream_first_token_seconds{endpoint,model}
+//	<namespace>_stream_tokens_per_second{endpoint,model}
+//	<namespace>_stream_tokens_total{endpoint,model}
+//
+// The status label is the class of the status code, such as 2xx or 5xx, or
+// "error" when no response was received.
+type Metrics struct {
+	reg          *Registry
+	requests     *Counter
+	latency      *Histogram
+	inFlight     *Gauge
+	retries      *Counter
+	ttft         *Histogram
+	rate         *Histogram
+	streamTokens *Counter
+}
+
+// Compile time check that Metrics implements client.Metrics.
+var _ client.Metrics = (*Metrics)(nil)
+
+// New constructs the client metrics in a new registry.
+func New(cfg Config) *Metrics {
+	return NewIn(NewRegistry(), cfg)
+}
+
+// NewIn constructs the client metrics in an existing registry, so they can
+// be served with metrics of the application.
+func NewIn(reg *Registry, cfg Config) *Metrics {
+	if cfg.Namespace == "" {
+		cfg.Namespace = DefaultNamespace
+	}
+
+	if len(cfg.LatencyBuckets) == 0 {
+		cfg.LatencyBuckets = DefaultLatencyBuckets
+	}
+
+	if len(cfg.TTFTBuckets) == 0 {
+		cfg.TTFTBuckets = DefaultTTFTBuckets
+	}
+
+	if len(cfg.RateBuckets) == 0 {
+		cfg.RateBuckets = DefaultRateBuckets
+	}
+
+	ns := cfg.Namespace + "_"
+
+	m := Metrics{
+		reg:          reg,
+		requests:     reg.NewCounter(ns+"requests_total", "Requests made to the API.", "endpoint", "model", "status"),
+		latency:      reg.NewHistogram(ns+"request_duration_seconds", "Time to complete a request, or a stream.", cfg.LatencyBuckets, "endpoint", "model"),
+		inFlight:     reg.NewGauge(ns+"requests_in_flight", "Requests waiting for a response or streaming.", "endpoint", "model"),
+		retries:      reg.NewCounter(ns+"retries_total", "Failed requests that were sent again.", "endpoint", "model"),
+		ttft:         reg.NewHistogram(ns+"stream_first_token_seconds", "Time from sending a streamed request to its first token.", cfg.TTFTBuckets, "endpoint", "model"),
+		rate:         reg.NewHistogram(ns+"stream_tokens_per_second", "Tokens per second of a stream after the first token.", cfg.RateBuckets, "endpoint", "model"),
+		streamTokens: reg.NewCounter(ns+"stream_tokens_total", "Tokens received in streams.", "endpoint", "model"),
+	}
+
+	return &m
+}
+
+// Registry returns the registry holding the metrics.
+func (m *Metrics) Registry() *Registry {
+	return m.reg
+}
+
+// ServeHTTP serves every metric in the registry in the Prometheus text
+// format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.reg.ServeHTTP(w, r)
+}
+
+// RequestStart implements client.Metrics.
+func (m *Metrics) RequestStart(endpoint string, model string) {
+	m.inFlight.Add(1, endpoint, model)
+}
+
+// RequestEnd implements client.Metrics.
+func (m *Metrics) RequestEnd(endpoint string, model string, status int, latency time.Duration) {
+	m.inFlight.Add(-1, endpoint, model)
+	m.requests.Inc(endpoint, model, statusClass(status))
+	m.latency.Observe(latency.Seconds(), endpoint, model)
+}
+
+// Retry implements client.Metrics.
+func (m *Metrics) Retry(endpoint string, model string) {
+	m.retries.Inc(endpoint, model)
+}
+
+// StreamFirstToken implements client.Metrics.
+func (m *Metrics) StreamFirstToken(endpoint string, model string, ttft time.Duration) {
+	m.ttft.Observe(ttft.Seconds(), endpoint, model)
+}
+
+// StreamEnd implements client.Metrics.
+func (m *Metrics) StreamEnd(endpoint string, model string, tokens int, duration time.Duration) {
+	m.streamTokens.Add(float64(tokens), endpoint, model)
+
+	// A single token has no rate.
+	if tokens > 1 && duration > 0 {
+		m.rate.Observe(float64(tokens-1)/duration.Seconds(), endpoint, model)
+	}
+}
+
+// =============================================================================
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "error"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
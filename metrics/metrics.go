@@ -0,0 +1,327 @@
+// Package metrics provides counters, gauges and histograms that are served
+// in the Prometheus text format, and an implementation of client.Metrics
+// built on them, without depending on the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds a set of metrics and writes them in the Prometheus text
+// format. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	names    map[string]bool
+}
+
+// NewRegistry constructs an empty registry.
+func NewRegistry() *Registry {
+	r := Registry{
+		names: make(map[string]bool),
+	}
+
+	return &r
+}
+
+// NewCounter registers a counter. It panics when the name or labels are
+// invalid or the name is already registered.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{f: r.register(name, help, "counter", nil, labels)}
+}
+
+// NewGauge registers a gauge. It panics when the name or labels are invalid
+// or the name is already registered.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{f: r.register(name, help, "gauge", nil, labels)}
+}
+
+// NewHistogram registers a histogram with the specified upper bounds. It
+// panics when the name, labels or buckets are invalid or the name is
+// already registered.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 || !slices.IsSorted(buckets) || slices.Contains(buckets, math.Inf(1)) {
+		panic(fmt.Sprintf("metrics: histogram %q needs sorted, finite buckets", name))
+	}
+
+	return &Histogram{f: r.register(name, help, "histogram", slices.Clone(buckets), labels)}
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	cw := countWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(&cw)
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+func (r *Registry) register(name string, help string, kind string, buckets []float64, labels []string) *family {
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid name %q", name))
+	}
+
+	for _, l := range labels {
+		if !validName.MatchString(l) || strings.Contains(l, ":") || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label %q for %q", l, name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %q is already registered", name))
+	}
+	r.names[name] = true
+
+	f := family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families = append(r.families, &f)
+
+	return &f
+}
+
+// =============================================================================
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	f *family
+}
+
+// Inc adds one to the series with the label values.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v, which must not be negative, to the series with the label
+// values.
+func (c *Counter) Add(v float64, labels ...string) {
+	if v < 0 {
+		panic("metrics: counter can't decrease")
+	}
+
+	c.f.update(labels, func(s *series) { s.value += v })
+}
+
+// Gauge is a value that goes up and down, such as requests in flight.
+type Gauge struct {
+	f *family
+}
+
+// Set sets the series with the label values to v.
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.f.update(labels, func(s *series) { s.value = v })
+}
+
+// Add adds v to the series with the label values.
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.f.update(labels, func(s *series) { s.value += v })
+}
+
+// Histogram counts observations, such as latencies, in buckets.
+type Histogram struct {
+	f *family
+}
+
+// Observe records v in the series with the label values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.f.update(labels, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+
+		if i, _ := slices.BinarySearch(h.f.buckets, v); i < len(s.counts) {
+			s.counts[i]++
+		}
+
+		s.sum += v
+		s.count++
+	})
+}
+
+// =============================================================================
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (f *family) update(labels []string, fn func(s *series)) {
+	if len(labels) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %q takes %d label values, got %d", f.name, len(f.labels), len(labels)))
+	}
+
+	key := strings.Join(labels, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labels: slices.Clone(labels)}
+		f.series[key] = s
+	}
+
+	fn(s)
+}
+
+func (f *family) write(w *countWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.printf("# HELP %s %s\n", f.name, escapeHelp(f.help))
+	w.printf("# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+
+		if f.kind != "histogram" {
+			w.printf("%s%s %s\n", f.name, f.labelSet(s.labels, ""), formatFloat(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			w.printf("%s_bucket%s %d\n", f.name, f.labelSet(s.labels, formatFloat(bound)), cumulative)
+		}
+
+		w.printf("%s_bucket%s %d\n", f.name, f.labelSet(s.labels, "+Inf"), s.count)
+		w.printf("%s_sum%s %s\n", f.name, f.labelSet(s.labels, ""), formatFloat(s.sum))
+		w.printf("%s_count%s %d\n", f.name, f.labelSet(s.labels, ""), s.count)
+	}
+}
+
+// labelSet formats the labels of a series, adding the le label of a
+// histogram bucket when set.
+func (f *family) labelSet(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(f.labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+	}
+
+	if le != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`le="`)
+		b.WriteString(le)
+		b.WriteByte('"')
+	}
+
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countWriter remembers the bytes written and the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) printf(format string, args ...any) {
+	if cw.err != nil {
+		return
+	}
+
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
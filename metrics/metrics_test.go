@@ -0,0 +1,185 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/metrics"
+)
+
+func Test_Registry(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	jobs := reg.NewCounter("jobs_total", "Jobs run.\nBy queue.", "queue")
+	depth := reg.NewGauge("queue_depth", "Jobs waiting.")
+	wait := reg.NewHistogram("wait_seconds", "Time jobs wait.", []float64{0.5, 1}, "queue")
+
+	jobs.Inc(`mail "urgent"`)
+	jobs.Add(2, "batch")
+	depth.Set(3)
+	depth.Add(-1)
+	wait.Observe(0.25, "batch")
+	wait.Observe(1, "batch")
+	wait.Observe(4, "batch")
+
+	exp := `# HELP jobs_total Jobs run.\nBy queue.
+# TYPE jobs_total counter
+jobs_total{queue="batch"} 2
+jobs_total{queue="mail \"urgent\""} 1
+# HELP queue_depth Jobs waiting.
+# TYPE queue_depth gauge
+queue_depth 2
+# HELP wait_seconds Time jobs wait.
+# TYPE wait_seconds histogram
+wait_seconds_bucket{queue="batch",le="0.5"} 1
+wait_seconds_bucket{queue="batch",le="1"} 2
+wait_seconds_bucket{queue="batch",le="+Inf"} 3
+wait_seconds_sum{queue="batch"} 5.25
+wait_seconds_count{queue="batch"} 3
+`
+
+	var b strings.Builder
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatalf("Should be able to write the metrics: %s", err)
+	}
+
+	if b.String() != exp {
+		t.Fatalf("Should get the expected exposition\ngot:\n%s\nexp:\n%s", b.String(), exp)
+	}
+
+	panics := func(fn func()) (ok bool) {
+		defer func() { ok = recover() != nil }()
+		fn()
+		return false
+	}
+
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"duplicate", func() { reg.NewCounter("jobs_total", "") }},
+		{"invalid-name", func() { reg.NewCounter("jobs-total", "") }},
+		{"reserved-label", func() { reg.NewHistogram("h", "", []float64{1}, "le") }},
+		{"unsorted-buckets", func() { reg.NewHistogram("h2", "", []float64{2, 1}) }},
+		{"label-count", func() { jobs.Inc() }},
+		{"negative-counter", func() { jobs.Add(-1, "batch") }},
+	}
+
+	for _, tt := range tests {
+		if !panics(tt.fn) {
+			t.Fatalf("%s: Should panic", tt.name)
+		}
+	}
+}
+
+func Test_Metrics(t *testing.T) {
+	var embedCalls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1717439154,"model":"hermes","choices":[]}`)
+	})
+	mux.HandleFunc("POST /broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{"error":"boom"}`)
+	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		if embedCalls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"busy"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"emb-1","object":"embedding_batch","created":1717439154,"model":"bridgetower","data":[{"index":0,"object":"embedding","embedding":[0.5]}]}`)
+	})
+	mux.HandleFunc("POST /stream", func(w http.ResponseWriter, r *http.Request) {
+		for _, word := range []string{"one", "two", "three"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	m := metrics.New(metrics.Config{})
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key", client.WithMetrics(m))
+	sse := client.NewSSE[client.ChatSSE](logger, "key", client.WithMetrics(m))
+
+	ctx := context.Background()
+
+	for range 2 {
+		var resp client.Chat
+		if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", client.D{"model": "hermes"}, &resp); err != nil {
+			t.Fatalf("Should be able to chat: %s", err)
+		}
+	}
+
+	if err := cln.Do(ctx, http.MethodPost, srv.URL+"/broken", client.D{"model": "hermes"}, nil); err == nil {
+		t.Fatalf("Should fail for the broken endpoint")
+	}
+
+	cfg := client.EmbedConfig{Backoff: 1}
+	if _, err := cln.EmbedAll(ctx, srv.URL+"/embeddings", "bridgetower", []client.D{{"text": "a rose"}}, cfg); err != nil {
+		t.Fatalf("Should be able to embed after a retry: %s", err)
+	}
+
+	ch := make(chan client.ChatSSE)
+	if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", client.D{"model": "hermes"}, ch); err != nil {
+		t.Fatalf("Should be able to stream: %s", err)
+	}
+	for range ch {
+	}
+
+	scrape := httptest.NewServer(m)
+	defer scrape.Close()
+
+	// The stream is reported after its channel is closed.
+	var body string
+	for range 100 {
+		resp, err := http.Get(scrape.URL)
+		if err != nil {
+			t.Fatalf("Should be able to scrape: %s", err)
+		}
+
+		if ct := resp.Header.Get("Content-Type"); ct != metrics.ContentType {
+			t.Fatalf("Should serve the text format, got %q", ct)
+		}
+
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if body = string(data); strings.Contains(body, `predictionguard_stream_tokens_total{endpoint="/stream",model="hermes"} 3`) {
+			break
+		}
+	}
+
+	lines := []string{
+		`predictionguard_requests_total{endpoint="/chat/completions",model="hermes",status="2xx"} 2`,
+		`predictionguard_requests_total{endpoint="/broken",model="hermes",status="5xx"} 1`,
+		`predictionguard_requests_total{endpoint="/embeddings",model="bridgetower",status="5xx"} 1`,
+		`predictionguard_requests_total{endpoint="/embeddings",model="bridgetower",status="2xx"} 1`,
+		`predictionguard_requests_total{endpoint="/stream",model="hermes",status="2xx"} 1`,
+		`predictionguard_retries_total{endpoint="/embeddings",model="bridgetower"} 1`,
+		`predictionguard_requests_in_flight{endpoint="/chat/completions",model="hermes"} 0`,
+		`predictionguard_requests_in_flight{endpoint="/stream",model="hermes"} 0`,
+		`predictionguard_request_duration_seconds_count{endpoint="/chat/completions",model="hermes"} 2`,
+		`predictionguard_stream_first_token_seconds_count{endpoint="/stream",model="hermes"} 1`,
+		`predictionguard_stream_tokens_per_second_count{endpoint="/stream",model="hermes"} 1`,
+		`predictionguard_stream_tokens_total{endpoint="/stream",model="hermes"} 3`,
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("Should expose %s, got:\n%s", line, body)
+		}
+	}
+}
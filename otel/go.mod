@@ -0,0 +1,23 @@
+module github.com/predictionguard/go-client/v2/otel
+
+go 1.22.3
+
+// The client gained the Tracer interface in v2.1.0, so that version is
+// tagged before this module is. See "Modules and releases" in the README for
+// developing both modules together with a go.work file.
+
+require (
+	github.com/predictionguard/go-client/v2 v2.1.0
+	go.opentelemetry.io/otel v1.35.0
+	go.opentelemetry.io/otel/sdk v1.35.0
+	go.opentelemetry.io/otel/trace v1.35.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/metric v1.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -0,0 +1,148 @@
+// Package otel implements client.Tracer with OpenTelemetry. It lives in its
+// own module so the client doesn't depend on OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"strings"
+
+	"github.com/predictionguard/go-client/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans.
+const ScopeName = "github.com/predictionguard/go-client/v2/otel"
+
+// Attributes set on the spans.
+const (
+	AttrMethod           = attribute.Key("http.request.method")
+	AttrEndpoint         = attribute.Key("url.path")
+	AttrStatus           = attribute.Key("http.response.status_code")
+	AttrSystem           = attribute.Key("gen_ai.system")
+	AttrModel            = attribute.Key("gen_ai.request.model")
+	AttrPromptTokens     = attribute.Key("gen_ai.usage.input_tokens")
+	AttrCompletionTokens = attribute.Key("gen_ai.usage.output_tokens")
+	AttrRequestID        = attribute.Key("predictionguard.request_id")
+	AttrStream           = attribute.Key("predictionguard.stream")
+	AttrStreamTokens     = attribute.Key("predictionguard.stream.tokens")
+	AttrAttempt          = attribute.Key("predictionguard.retry.attempt")
+)
+
+// Names of the span events.
+const (
+	EventFirstByte = "first_byte"
+	EventRetry     = "retry"
+)
+
+// Tracer implements client.Tracer by starting a client span for each
+// request and propagating its context to the API in the W3C traceparent
+// and tracestate headers.
+type Tracer struct {
+	tracer trace.Tracer
+	prop   propagation.TraceContext
+}
+
+// Compile time check that Tracer implements client.Tracer.
+var _ client.Tracer = (*Tracer)(nil)
+
+// New constructs a tracer that starts spans with tp, or with the global
+// tracer provider when tp is nil.
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	t := Tracer{
+		tracer: tp.Tracer(ScopeName),
+	}
+
+	return &t
+}
+
+// Start implements client.Tracer.
+func (t *Tracer) Start(ctx context.Context, req client.TraceRequest) (context.Context, client.Span) {
+	attrs := []attribute.KeyValue{
+		AttrSystem.String("predictionguard"),
+		AttrMethod.String(req.Method),
+		AttrEndpoint.String(req.Endpoint),
+		AttrStream.Bool(req.Stream),
+	}
+
+	if req.Model != "" {
+		attrs = append(attrs, AttrModel.String(req.Model))
+	}
+
+	name := strings.TrimSpace(req.Method + " " + req.Endpoint)
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	carrier := propagation.MapCarrier{}
+	t.prop.Inject(ctx, carrier)
+
+	if parent := carrier.Get("traceparent"); parent != "" {
+		ctx = client.WithTraceParent(ctx, parent, carrier.Get("tracestate"))
+	}
+
+	return ctx, &Span{span: span}
+}
+
+// Retry implements client.Tracer by adding a retry event to the span in the
+// context, which is the span of the caller rather than of the request.
+func (t *Tracer) Retry(ctx context.Context, req client.TraceRequest, attempt int, err error) {
+	attrs := []attribute.KeyValue{
+		AttrEndpoint.String(req.Endpoint),
+		AttrAttempt.Int(attempt),
+	}
+
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.message", err.Error()))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent(EventRetry, trace.WithAttributes(attrs...))
+}
+
+// =============================================================================
+
+// Span implements client.Span with an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+// FirstByte implements client.Span.
+func (s *Span) FirstByte() {
+	s.span.AddEvent(EventFirstByte)
+}
+
+// Error implements client.Span.
+func (s *Span) Error(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End implements client.Span.
+func (s *Span) End(res client.TraceResult) {
+	var attrs []attribute.KeyValue
+
+	if res.Status != 0 {
+		attrs = append(attrs, AttrStatus.Int(res.Status))
+	}
+
+	if res.RequestID != "" {
+		attrs = append(attrs, AttrRequestID.String(res.RequestID))
+	}
+
+	if res.PromptTokens != 0 || res.CompletionTokens != 0 {
+		attrs = append(attrs, AttrPromptTokens.Int(res.PromptTokens), AttrCompletionTokens.Int(res.CompletionTokens))
+	}
+
+	if res.StreamTokens != 0 {
+		attrs = append(attrs, AttrStreamTokens.Int(res.StreamTokens))
+	}
+
+	s.span.SetAttributes(attrs...)
+	s.span.End()
+}
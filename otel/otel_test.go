@@ -0,0 +1,137 @@
+package otel_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/predictionguard/go-client/v2"
+	pgotel "github.com/predictionguard/go-client/v2/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_Tracer(t *testing.T) {
+	var mu sync.Mutex
+	var parents []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		parents = append(parents, r.Header.Get("traceparent"))
+		mu.Unlock()
+
+		w.Header().Set(client.RequestIDHeader, "req-1")
+		fmt.Fprint(w, `{"id":"chat-1","object":"chat.completion","created":1717439154,"model":"hermes","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+	})
+	mux.HandleFunc("POST /broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{"error":"boom"}`)
+	})
+	mux.HandleFunc("POST /stream", func(w http.ResponseWriter, r *http.Request) {
+		for _, word := range []string{"one", "two"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	tracer := pgotel.New(tp)
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key", client.WithTracer(tracer))
+	sse := client.NewSSE[client.ChatSSE](logger, "key", client.WithTracer(tracer))
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+
+	var resp client.Chat
+	if err := cln.Do(ctx, http.MethodPost, srv.URL+"/chat/completions", client.D{"model": "hermes"}, &resp); err != nil {
+		t.Fatalf("Should be able to chat: %s", err)
+	}
+
+	if err := cln.Do(ctx, http.MethodPost, srv.URL+"/broken", client.D{"model": "hermes"}, nil); err == nil {
+		t.Fatalf("Should fail for the broken endpoint")
+	}
+
+	ch := make(chan client.ChatSSE)
+	if err := sse.Do(ctx, http.MethodPost, srv.URL+"/stream", client.D{"model": "hermes"}, ch); err != nil {
+		t.Fatalf("Should be able to stream: %s", err)
+	}
+	for range ch {
+	}
+
+	// The stream span ends after its channel is closed.
+	deadline := time.Now().Add(time.Second)
+	for len(rec.Ended()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	root.End()
+
+	spans := rec.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("Should end 4 spans, got %d", len(spans))
+	}
+
+	chat, broken, stream := spans[0], spans[1], spans[2]
+
+	for _, span := range []sdktrace.ReadOnlySpan{chat, broken, stream} {
+		if span.Parent().SpanID() != root.SpanContext().SpanID() || span.SpanKind() != trace.SpanKindClient {
+			t.Fatalf("Should start %s as a client span of the root", span.Name())
+		}
+	}
+
+	// The API sees the span of the request as the parent.
+	exp := fmt.Sprintf("00-%s-%s-01", chat.SpanContext().TraceID(), chat.SpanContext().SpanID())
+	if len(parents) != 1 || parents[0] != exp {
+		t.Fatalf("Should propagate the span, got %v, exp %s", parents, exp)
+	}
+
+	for key, exp := range map[attribute.Key]attribute.Value{
+		pgotel.AttrEndpoint:         attribute.StringValue("/chat/completions"),
+		pgotel.AttrModel:            attribute.StringValue("hermes"),
+		pgotel.AttrStatus:           attribute.IntValue(http.StatusOK),
+		pgotel.AttrRequestID:        attribute.StringValue("req-1"),
+		pgotel.AttrPromptTokens:     attribute.IntValue(10),
+		pgotel.AttrCompletionTokens: attribute.IntValue(5),
+	} {
+		if v := attr(chat, key); v != exp {
+			t.Fatalf("Should set %s to %s, got %s", key, exp.Emit(), v.Emit())
+		}
+	}
+
+	if broken.Status().Code != codes.Error || len(broken.Events()) != 1 {
+		t.Fatalf("Should record the error of the broken request, got %+v", broken.Status())
+	}
+
+	if v := attr(broken, pgotel.AttrStatus); v.AsInt64() != http.StatusBadGateway {
+		t.Fatalf("Should set the status of the broken request, got %s", v.Emit())
+	}
+
+	if events := stream.Events(); len(events) != 1 || events[0].Name != pgotel.EventFirstByte {
+		t.Fatalf("Should add the first byte event to the stream, got %v", events)
+	}
+
+	if v := attr(stream, pgotel.AttrStreamTokens); v.AsInt64() != 2 {
+		t.Fatalf("Should count the stream tokens, got %s", v.Emit())
+	}
+}
+
+// attr returns the value of the attribute of the span with the key.
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	set := attribute.NewSet(span.Attributes()...)
+	v, _ := set.Value(key)
+	return v
+}
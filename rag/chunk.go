@@ -0,0 +1,152 @@
+package rag
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span represents a piece of a document and its byte offsets in the
+// original text.
+type Span struct {
+	Text  string
+	Start int
+	Stop  int
+}
+
+// Chunker splits a document's text into spans small enough to embed.
+type Chunker interface {
+	Chunk(ctx context.Context, text string) ([]Span, error)
+}
+
+// =============================================================================
+
+// CharChunker splits text into spans of at most Size bytes, overlapping by
+// Overlap bytes. Cuts prefer paragraph breaks, then sentence ends, then
+// whitespace.
+type CharChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Chunk implements the Chunker interface.
+func (c CharChunker) Chunk(ctx context.Context, text string) ([]Span, error) {
+	size := c.Size
+	if size <= 0 {
+		size = 1000
+	}
+
+	overlap := min(max(c.Overlap, 0), size/2)
+
+	var spans []Span
+	for start := 0; start < len(text); {
+		stop := len(text)
+		if start+size < len(text) {
+			stop = bestBreak(text, start+size/2, start+size)
+		}
+
+		if span, ok := trimmed(text, start, stop); ok {
+			spans = append(spans, span)
+		}
+
+		if stop == len(text) {
+			break
+		}
+
+		// The overlap starts on a rune boundary, so text without spaces
+		// such as Chinese or Japanese isn't cut inside a character.
+		next := stop - overlap
+		for next > start && !utf8.RuneStart(text[next]) {
+			next--
+		}
+
+		if overlap > 0 {
+			next = alignWord(text, next, stop)
+		}
+
+		start = max(next, start+1)
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+
+	return spans, nil
+}
+
+// =============================================================================
+
+// bestBreak returns the best position to cut text within (lo, hi]. A
+// paragraph break wins over a sentence end which wins over whitespace, and
+// later positions win ties. When there is no natural break, hi is returned
+// moved back to a rune boundary.
+func bestBreak(text string, lo int, hi int) int {
+	best, bestRank := hi, 0
+	for pos := hi; pos > lo; pos-- {
+		if rank := breakRank(text, pos); rank > bestRank {
+			best, bestRank = pos, rank
+		}
+	}
+
+	if bestRank > 0 {
+		return best
+	}
+
+	for hi > lo && !utf8.RuneStart(text[hi]) {
+		hi--
+	}
+
+	return hi
+}
+
+// breakRank ranks cutting text at pos, so text[:pos] and text[pos:] are the
+// two halves. Higher is better and zero means the cut splits a word.
+func breakRank(text string, pos int) int {
+	switch {
+	case pos <= 0 || pos >= len(text):
+		return 3
+	case pos >= 2 && text[pos-2:pos] == "\n\n":
+		return 3
+	case pos >= 2 && unicode.IsSpace(rune(text[pos-1])) && isSentenceEnd(text[pos-2]):
+		return 2
+	case unicode.IsSpace(rune(text[pos-1])):
+		return 1
+	}
+	return 0
+}
+
+// alignWord moves pos forward to the start of the next word so an overlap
+// doesn't begin in the middle of one, without going past limit.
+func alignWord(text string, pos int, limit int) int {
+	for i := pos; i < limit; i++ {
+		if i == 0 || unicode.IsSpace(rune(text[i-1])) {
+			return i
+		}
+	}
+	return pos
+}
+
+// trimmed returns the span for text[start:stop] with surrounding whitespace
+// removed and the offsets adjusted to match.
+func trimmed(text string, start int, stop int) (Span, bool) {
+	s := text[start:stop]
+
+	lead := len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return Span{}, false
+	}
+
+	span := Span{
+		Text:  s,
+		Start: start + lead,
+		Stop:  start + lead + len(s),
+	}
+
+	return span, true
+}
+
+func isSentenceEnd(b byte) bool {
+	return b == '.' || b == '!' || b == '?'
+}
@@ -0,0 +1,208 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// TokenConfig defines the behavior of a TokenChunker.
+type TokenConfig struct {
+	// Host is the base URL of the Prediction Guard API.
+	Host string
+
+	// Model is the model whose tokenizer defines the token boundaries.
+	Model string
+
+	// MaxTokens is the maximum number of tokens in a chunk. Special tokens
+	// the model adds around an input, such as <s>, are not counted, so leave
+	// some headroom below the model's context limit.
+	MaxTokens int
+
+	// Overlap is the number of tokens shared by neighboring chunks.
+	Overlap int
+
+	// WindowBytes bounds the size of the text sent to the tokenize endpoint
+	// in one request. Longer text is tokenized in windows cut on the same
+	// breaks as the chunks. Zero means 32 KiB.
+	WindowBytes int
+}
+
+// TokenChunker splits text on token boundaries of a specific model using the
+// tokenize endpoint, so every chunk fits within a token budget. Cuts prefer
+// paragraph breaks, then sentence ends, then whitespace.
+type TokenChunker struct {
+	cln *client.Client
+	cfg TokenConfig
+}
+
+// NewTokenChunker constructs a chunker that tokenizes with the specified
+// client and config.
+func NewTokenChunker(cln *client.Client, cfg TokenConfig) *TokenChunker {
+	if cfg.Host == "" {
+		cfg.Host = client.DefaultHost
+	}
+	cfg.Host = strings.TrimSuffix(cfg.Host, "/")
+
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 256
+	}
+
+	cfg.Overlap = min(max(cfg.Overlap, 0), cfg.MaxTokens/2)
+
+	if cfg.WindowBytes <= 0 {
+		cfg.WindowBytes = 32 << 10
+	}
+
+	tc := TokenChunker{
+		cln: cln,
+		cfg: cfg,
+	}
+
+	return &tc
+}
+
+// Chunk implements the Chunker interface.
+func (tc *TokenChunker) Chunk(ctx context.Context, text string) ([]Span, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	window := tc.cfg.WindowBytes
+
+	var tokens []client.TokenData
+	for start := 0; start < len(text); {
+		stop := len(text)
+		if start+window < len(text) {
+			stop = bestBreak(text, start+window/2, start+window)
+		}
+
+		part, err := tc.tokenize(ctx, text[start:stop])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range part {
+			t.Start += start
+			t.Stop += start
+			tokens = append(tokens, t)
+		}
+
+		start = stop
+	}
+
+	return tc.split(text, tokens), nil
+}
+
+// tokenize returns the tokens of text with byte offsets into it.
+func (tc *TokenChunker) tokenize(ctx context.Context, text string) ([]client.TokenData, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	d := client.D{
+		"model": tc.cfg.Model,
+		"input": text,
+	}
+
+	var resp client.Tokenize
+	if err := tc.cln.Do(ctx, http.MethodPost, tc.cfg.Host+"/tokenize", d, &resp); err != nil {
+		return nil, fmt.Errorf("tokenize: %w", err)
+	}
+
+	return byteOffsets(text, resp.Data), nil
+}
+
+// split groups the tokens into spans of at most MaxTokens tokens.
+func (tc *TokenChunker) split(text string, tokens []client.TokenData) []Span {
+	maxTokens := tc.cfg.MaxTokens
+
+	var spans []Span
+	for i := 0; i < len(tokens); {
+		end := len(tokens)
+		if i+maxTokens < len(tokens) {
+			end = tc.cut(text, tokens, i+maxTokens/2+1, i+maxTokens)
+		}
+
+		if span, ok := trimmed(text, tokens[i].Start, tokens[end-1].Stop); ok {
+			spans = append(spans, span)
+		}
+
+		if end == len(tokens) {
+			break
+		}
+
+		i = max(end-tc.cfg.Overlap, i+1)
+	}
+
+	return spans
+}
+
+// cut returns the token index in [lo, hi] to end a chunk before, choosing
+// the best break in the text and the latest token on ties.
+func (tc *TokenChunker) cut(text string, tokens []client.TokenData, lo int, hi int) int {
+	best, bestRank := hi, -1
+	for j := hi; j >= lo; j-- {
+		if rank := breakRank(text, tokens[j].Start); rank > bestRank {
+			best, bestRank = j, rank
+		}
+	}
+	return best
+}
+
+// byteOffsets converts the character offsets returned by the tokenize
+// endpoint into byte offsets into text. Special tokens that don't cover any
+// text, such as <s>, are dropped.
+func byteOffsets(text string, tokens []client.TokenData) []client.TokenData {
+	runes := make([]int, 0, len(text)+1)
+	for i := range text {
+		runes = append(runes, i)
+	}
+	runes = append(runes, len(text))
+
+	pos := func(r int) int {
+		return runes[min(max(r, 0), len(runes)-1)]
+	}
+
+	out := make([]client.TokenData, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Stop <= t.Start {
+			continue
+		}
+
+		t.Start = pos(t.Start)
+		t.Stop = pos(t.Stop)
+		out = append(out, t)
+	}
+
+	// Some tokenizers report offsets in bytes rather than characters. When
+	// the text is ASCII the two agree, otherwise check the token text still
+	// lines up and fall back to the raw offsets if it doesn't.
+	if utf8.RuneCountInString(text) != len(text) && !aligned(text, out) {
+		out = out[:0]
+		for _, t := range tokens {
+			if t.Stop > t.Start && t.Stop <= len(text) {
+				out = append(out, t)
+			}
+		}
+	}
+
+	return out
+}
+
+// aligned reports if the token texts match the text at their offsets,
+// ignoring tokenizer markers for leading spaces.
+func aligned(text string, tokens []client.TokenData) bool {
+	for _, t := range tokens {
+		got := strings.TrimSpace(text[t.Start:t.Stop])
+		want := strings.TrimSpace(strings.NewReplacer("▁", " ", "Ġ", " ").Replace(t.Text))
+		if want != "" && got != want {
+			return false
+		}
+	}
+	return true
+}
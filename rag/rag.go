@@ -0,0 +1,458 @@
+// Package rag provides a retrieval augmented generation pipeline built on
+// the Prediction Guard embeddings, rerank, chat and factuality endpoints.
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/vector"
+)
+
+// Metadata keys the pipeline stores with every chunk in the index.
+const (
+	MetaDocumentID = "rag_document_id"
+	MetaText       = "rag_text"
+	MetaStart      = "rag_start"
+	MetaStop       = "rag_stop"
+)
+
+// ErrNoContext is returned when retrieval finds nothing to answer from.
+var ErrNoContext = errors.New("no relevant context found")
+
+// DefaultSystemPrompt instructs the model to answer from the numbered
+// context passages and cite them.
+const DefaultSystemPrompt = `Answer the question using only the numbered context passages provided. Cite the passages you use with their number in square brackets, for example [1]. If the context doesn't contain the answer, say that you don't know.`
+
+// Config defines the behavior of the pipeline.
+type Config struct {
+	// Host is the base URL of the Prediction Guard API.
+	Host string
+
+	EmbeddingModel string
+	RerankModel    string
+	ChatModel      string
+
+	// Chunker splits documents during ingestion. A CharChunker of 1000
+	// bytes with 100 bytes of overlap is used when this is not set. Use a
+	// TokenChunker to keep chunks within a model's token limit.
+	Chunker Chunker
+
+	// BatchSize is the number of chunks embedded per request.
+	BatchSize int
+
+	// Candidates is the number of chunks retrieved from the index before
+	// reranking.
+	Candidates int
+
+	// TopK is the number of reranked chunks used to build the prompt.
+	TopK int
+
+	// MinRelevance drops reranked chunks scoring below this value.
+	MinRelevance float64
+
+	// SystemPrompt replaces DefaultSystemPrompt.
+	SystemPrompt string
+
+	MaxTokens   int
+	Temperature float64
+
+	// Factuality checks the answer against the retrieved context.
+	Factuality bool
+}
+
+// Document represents a source document to ingest.
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]any
+}
+
+// Chunk represents a piece of a source document.
+type Chunk struct {
+	ID         string
+	DocumentID string
+	Text       string
+	Start      int
+	Stop       int
+	Metadata   map[string]any
+}
+
+// Passage represents a retrieved chunk and its scores.
+type Passage struct {
+	Chunk          Chunk
+	Similarity     float64
+	RelevanceScore float64
+}
+
+// Citation connects a numbered reference in an answer to its passage.
+type Citation struct {
+	Number  int
+	Passage Passage
+}
+
+// Answer represents the result of asking the pipeline a question.
+type Answer struct {
+	Text       string
+	Citations  []Citation
+	Passages   []Passage
+	Factuality *float64
+}
+
+// =============================================================================
+
+// Pipeline ingests documents into a vector index and answers questions from
+// them.
+type Pipeline struct {
+	cln   *client.Client
+	index vector.Index
+	cfg   Config
+}
+
+// New constructs a pipeline that stores chunks in the specified index.
+func New(cln *client.Client, index vector.Index, cfg Config) *Pipeline {
+	if cfg.Host == "" {
+		cfg.Host = client.DefaultHost
+	}
+	cfg.Host = strings.TrimSuffix(cfg.Host, "/")
+
+	if cfg.Chunker == nil {
+		cfg.Chunker = CharChunker{Size: 1000, Overlap: 100}
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 32
+	}
+
+	if cfg.TopK <= 0 {
+		cfg.TopK = 5
+	}
+
+	if cfg.Candidates < cfg.TopK {
+		cfg.Candidates = max(20, cfg.TopK)
+	}
+
+	if cfg.SystemPrompt == "" {
+		cfg.SystemPrompt = DefaultSystemPrompt
+	}
+
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 1000
+	}
+
+	p := Pipeline{
+		cln:   cln,
+		index: index,
+		cfg:   cfg,
+	}
+
+	return &p
+}
+
+// Ingest chunks, embeds and indexes the documents, returning the number of
+// chunks stored. The chunks are only added to the index once every batch
+// is embedded, so a failed ingest stores nothing and can be retried.
+func (p *Pipeline) Ingest(ctx context.Context, docs ...Document) (int, error) {
+	var chunks []Chunk
+
+	for _, doc := range docs {
+		spans, err := p.cfg.Chunker.Chunk(ctx, doc.Text)
+		if err != nil {
+			return 0, fmt.Errorf("chunk %q: %w", doc.ID, err)
+		}
+
+		for i, span := range spans {
+			chunks = append(chunks, Chunk{
+				ID:         fmt.Sprintf("%s#%d", doc.ID, i),
+				DocumentID: doc.ID,
+				Text:       span.Text,
+				Start:      span.Start,
+				Stop:       span.Stop,
+				Metadata:   doc.Metadata,
+			})
+		}
+	}
+
+	items := make([]vector.Item, len(chunks))
+
+	for start := 0; start < len(chunks); start += p.cfg.BatchSize {
+		batch := chunks[start:min(start+p.cfg.BatchSize, len(chunks))]
+
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Text
+		}
+
+		vectors, err := p.embed(ctx, texts)
+		if err != nil {
+			return 0, err
+		}
+
+		for i, c := range batch {
+			items[start+i] = vector.Item{
+				ID:       c.ID,
+				Vector:   vectors[i],
+				Metadata: chunkMetadata(c),
+			}
+		}
+	}
+
+	if err := p.index.Add(items...); err != nil {
+		return 0, fmt.Errorf("index: %w", err)
+	}
+
+	return len(chunks), nil
+}
+
+// Retrieve returns the passages most relevant to the query, reranked and
+// best first. The filter restricts the search by chunk metadata and can
+// be nil.
+func (p *Pipeline) Retrieve(ctx context.Context, query string, filter vector.Filter) ([]Passage, error) {
+	vectors, err := p.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := p.index.Search(vectors[0], p.cfg.Candidates, filter)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	passages := make([]Passage, len(results))
+	docs := make([]string, len(results))
+	for i, r := range results {
+		passages[i] = Passage{
+			Chunk:      chunkFromResult(r),
+			Similarity: r.Score,
+		}
+		docs[i] = passages[i].Chunk.Text
+	}
+
+	d := client.D{
+		"model":            p.cfg.RerankModel,
+		"query":            query,
+		"documents":        docs,
+		"return_documents": false,
+	}
+
+	var resp client.Rerank
+	if err := p.cln.Do(ctx, http.MethodPost, p.cfg.Host+"/rerank", d, &resp); err != nil {
+		return nil, fmt.Errorf("rerank: %w", err)
+	}
+
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		return resp.Results[i].RelevanceScore > resp.Results[j].RelevanceScore
+	})
+
+	reranked := make([]Passage, 0, p.cfg.TopK)
+	for _, r := range resp.Results {
+		if len(reranked) == p.cfg.TopK {
+			break
+		}
+
+		if r.Index < 0 || r.Index >= len(passages) || r.RelevanceScore < p.cfg.MinRelevance {
+			continue
+		}
+
+		passage := passages[r.Index]
+		passage.RelevanceScore = r.RelevanceScore
+		reranked = append(reranked, passage)
+	}
+
+	return reranked, nil
+}
+
+// Ask retrieves context for the question and asks the chat model to answer
+// from it. The filter restricts the search by chunk metadata and can be nil.
+func (p *Pipeline) Ask(ctx context.Context, question string, filter vector.Filter) (Answer, error) {
+	passages, err := p.Retrieve(ctx, question, filter)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	if len(passages) == 0 {
+		return Answer{}, ErrNoContext
+	}
+
+	reference := buildContext(passages)
+
+	d := client.D{
+		"model": p.cfg.ChatModel,
+		"messages": []client.D{
+			{
+				"role":    client.Roles.System,
+				"content": p.cfg.SystemPrompt,
+			},
+			{
+				"role":    client.Roles.User,
+				"content": fmt.Sprintf("Context:\n%s\nQuestion: %s", reference, question),
+			},
+		},
+		"max_tokens":  p.cfg.MaxTokens,
+		"temperature": p.cfg.Temperature,
+	}
+
+	var resp client.Chat
+	if err := p.cln.Do(ctx, http.MethodPost, p.cfg.Host+"/chat/completions", d, &resp); err != nil {
+		return Answer{}, fmt.Errorf("chat: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return Answer{}, errors.New("chat: no choices returned")
+	}
+
+	text := resp.Choices[0].Message.Content
+
+	answer := Answer{
+		Text:      text,
+		Citations: citations(text, passages),
+		Passages:  passages,
+	}
+
+	if p.cfg.Factuality {
+		d := client.D{
+			"reference": reference,
+			"text":      text,
+		}
+
+		var resp client.Factuality
+		if err := p.cln.Do(ctx, http.MethodPost, p.cfg.Host+"/factuality", d, &resp); err != nil {
+			return Answer{}, fmt.Errorf("factuality: %w", err)
+		}
+
+		if len(resp.Checks) > 0 {
+			score := resp.Checks[0].Score
+			answer.Factuality = &score
+		}
+	}
+
+	return answer, nil
+}
+
+// =============================================================================
+
+func (p *Pipeline) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	input := make([]client.D, len(texts))
+	for i, text := range texts {
+		input[i] = client.D{"text": text}
+	}
+
+	d := client.D{
+		"model": p.cfg.EmbeddingModel,
+		"input": input,
+	}
+
+	var resp client.Embedding
+	if err := p.cln.Do(ctx, http.MethodPost, p.cfg.Host+"/embeddings", d, &resp); err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings: unexpected index %d", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("embeddings: missing index %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+func buildContext(passages []Passage) string {
+	var b strings.Builder
+	for i, p := range passages {
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, p.Chunk.Text)
+	}
+	return b.String()
+}
+
+var citationRE = regexp.MustCompile(`\[(\d+)\]`)
+
+// citations returns the passages referenced in the answer text in the order
+// they are first cited.
+func citations(text string, passages []Passage) []Citation {
+	var cites []Citation
+	seen := make(map[int]bool)
+
+	for _, m := range citationRE.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > len(passages) || seen[n] {
+			continue
+		}
+		seen[n] = true
+
+		cites = append(cites, Citation{
+			Number:  n,
+			Passage: passages[n-1],
+		})
+	}
+
+	return cites
+}
+
+func chunkMetadata(c Chunk) map[string]any {
+	meta := make(map[string]any, len(c.Metadata)+4)
+	for k, v := range c.Metadata {
+		meta[k] = v
+	}
+
+	meta[MetaDocumentID] = c.DocumentID
+	meta[MetaText] = c.Text
+	meta[MetaStart] = c.Start
+	meta[MetaStop] = c.Stop
+
+	return meta
+}
+
+func chunkFromResult(r vector.Result) Chunk {
+	c := Chunk{
+		ID:       r.ID,
+		Metadata: make(map[string]any, len(r.Metadata)),
+	}
+
+	for k, v := range r.Metadata {
+		switch k {
+		case MetaDocumentID:
+			c.DocumentID, _ = v.(string)
+		case MetaText:
+			c.Text, _ = v.(string)
+		case MetaStart:
+			c.Start = toInt(v)
+		case MetaStop:
+			c.Stop = toInt(v)
+		default:
+			c.Metadata[k] = v
+		}
+	}
+
+	return c
+}
+
+// toInt handles offsets stored as int and offsets that come back as float64
+// after an index is loaded from disk.
+func toInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,356 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/rag"
+	"github.com/predictionguard/go-client/v2/vector"
+)
+
+func Test_Pipeline(t *testing.T) {
+	srv := newService(t)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "some-key")
+
+	p := rag.New(cln, vector.NewFlat(vector.Metrics.Cosine), rag.Config{
+		Host:       srv.URL,
+		Chunker:    rag.CharChunker{Size: 40},
+		BatchSize:  2,
+		TopK:       2,
+		Factuality: true,
+	})
+
+	docs := []rag.Document{
+		{
+			ID:       "go",
+			Text:     "Go was designed at Google. Go has goroutines for concurrency.\n\nGo compiles to a single binary.",
+			Metadata: map[string]any{"topic": "lang"},
+		},
+		{
+			ID:       "pizza",
+			Text:     "Pizza is made with dough, tomato and cheese. Pizza is baked in an oven.",
+			Metadata: map[string]any{"topic": "food"},
+		},
+	}
+
+	n, err := p.Ingest(context.Background(), docs...)
+	if err != nil {
+		t.Fatalf("Should be able to ingest: %s", err)
+	}
+
+	if n < 4 {
+		t.Fatalf("Should get at least 4 chunks, got %d", n)
+	}
+
+	answer, err := p.Ask(context.Background(), "how does go do concurrency", nil)
+	if err != nil {
+		t.Fatalf("Should be able to ask: %s", err)
+	}
+
+	if len(answer.Citations) != 1 || answer.Citations[0].Number != 1 {
+		t.Fatalf("Should get a single citation to passage 1, got %+v", answer.Citations)
+	}
+
+	cited := answer.Citations[0].Passage.Chunk
+	if cited.DocumentID != "go" || !strings.Contains(cited.Text, "goroutines") {
+		t.Fatalf("Should cite the goroutine chunk, got %+v", cited)
+	}
+
+	if docs[0].Text[cited.Start:cited.Stop] != cited.Text {
+		t.Fatalf("Should map the chunk offsets back to the source text")
+	}
+
+	if answer.Factuality == nil || *answer.Factuality != 0.9 {
+		t.Fatalf("Should get the factuality score")
+	}
+
+	passages, err := p.Retrieve(context.Background(), "pizza oven", vector.Match(map[string]any{"topic": "lang"}))
+	if err != nil {
+		t.Fatalf("Should be able to retrieve: %s", err)
+	}
+
+	for _, ps := range passages {
+		if ps.Chunk.DocumentID != "go" {
+			t.Fatalf("Should only retrieve chunks matching the filter, got %q", ps.Chunk.DocumentID)
+		}
+	}
+}
+
+func Test_Ingest(t *testing.T) {
+	srv := newService(t)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "some-key")
+
+	index := vector.NewFlat(vector.Metrics.Cosine)
+	p := rag.New(cln, index, rag.Config{
+		Host:      srv.URL,
+		Chunker:   rag.CharChunker{Size: 40},
+		BatchSize: 2,
+	})
+
+	docs := []rag.Document{
+		{ID: "go", Text: "Go was designed at Google. Go has goroutines for concurrency.\n\nGo compiles to a single binary."},
+		{ID: "flaky", Text: "The embeddings are unavailable once."},
+	}
+
+	if _, err := p.Ingest(context.Background(), docs...); err == nil {
+		t.Fatalf("Should fail when a batch can't be embedded")
+	}
+
+	if index.Len() != 0 {
+		t.Fatalf("Should not store any chunk of a failed ingest, got %d", index.Len())
+	}
+
+	n, err := p.Ingest(context.Background(), docs...)
+	if err != nil {
+		t.Fatalf("Should be able to retry the ingest: %s", err)
+	}
+
+	if n != index.Len() || n < 3 {
+		t.Fatalf("Should store every chunk on retry, got %d of %d", index.Len(), n)
+	}
+}
+
+func Test_CharChunker(t *testing.T) {
+	text := "First sentence here. Second sentence follows.\n\nNew paragraph starts. And it ends here."
+
+	spans, err := rag.CharChunker{Size: 40, Overlap: 10}.Chunk(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Should be able to chunk: %s", err)
+	}
+
+	if len(spans) < 2 {
+		t.Fatalf("Should get multiple spans, got %d", len(spans))
+	}
+
+	for _, s := range spans {
+		if len(s.Text) > 40 {
+			t.Fatalf("Should get spans of at most 40 bytes, got %d", len(s.Text))
+		}
+
+		if text[s.Start:s.Stop] != s.Text {
+			t.Fatalf("Should get offsets matching the text for %q", s.Text)
+		}
+	}
+
+	if spans[0].Text != "First sentence here." {
+		t.Fatalf("Should cut on a sentence end, got %q", spans[0].Text)
+	}
+
+	// Text without spaces has no word to align the overlap with.
+	cjk := strings.Repeat("日本語のテキスト", 20)
+
+	spans, err = rag.CharChunker{Size: 40, Overlap: 10}.Chunk(context.Background(), cjk)
+	if err != nil {
+		t.Fatalf("Should be able to chunk: %s", err)
+	}
+
+	for _, s := range spans {
+		if !utf8.ValidString(s.Text) || cjk[s.Start:s.Stop] != s.Text {
+			t.Fatalf("Should cut on rune boundaries, got %q at %d", s.Text, s.Start)
+		}
+	}
+}
+
+func Test_TokenChunker(t *testing.T) {
+	srv := newService(t)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "some-key")
+
+	tc := rag.NewTokenChunker(cln, rag.TokenConfig{
+		Host:        srv.URL,
+		Model:       "neural-chat-7b-v3-3",
+		MaxTokens:   6,
+		Overlap:     1,
+		WindowBytes: 40,
+	})
+
+	text := "Café crème is nice. It tastes great.\n\nThe next paragraph has more words in it."
+
+	spans, err := tc.Chunk(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Should be able to chunk: %s", err)
+	}
+
+	exp := []string{
+		"Café crème is nice.",
+		"nice. It tastes great.",
+		"great.\n\nThe next paragraph has more",
+		"more words in it.",
+	}
+
+	if len(spans) != len(exp) {
+		t.Fatalf("Should get %d spans, got %d: %+v", len(exp), len(spans), spans)
+	}
+
+	for i, s := range spans {
+		if s.Text != exp[i] {
+			t.Fatalf("Should get span %q, got %q", exp[i], s.Text)
+		}
+
+		if text[s.Start:s.Stop] != s.Text {
+			t.Fatalf("Should get offsets matching the text for %q", s.Text)
+		}
+
+		if n := len(strings.Fields(s.Text)); n > 6 {
+			t.Fatalf("Should get at most 6 tokens, got %d", n)
+		}
+	}
+
+	// A long document is tokenized in windows the endpoint accepts.
+	tc = rag.NewTokenChunker(cln, rag.TokenConfig{Host: srv.URL, MaxTokens: 50})
+	text = strings.Repeat(text+"\n\n", 1000)
+
+	spans, err = tc.Chunk(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Should be able to chunk a long document: %s", err)
+	}
+
+	if last := spans[len(spans)-1]; last.Stop != len(strings.TrimSpace(text)) {
+		t.Fatalf("Should cover the whole document, got a last span ending at %d", last.Stop)
+	}
+}
+
+// =============================================================================
+
+var vocab = []string{"go", "goroutines", "concurrency", "google", "binary", "pizza", "cheese", "oven", "dough"}
+
+// embed returns a bag of words vector over a tiny vocabulary so similarity
+// is predictable.
+func embed(text string) []float64 {
+	v := make([]float64, len(vocab)+1)
+	v[len(vocab)] = 0.01
+
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		w = strings.Trim(w, ".,?")
+		for i, word := range vocab {
+			if w == word {
+				v[i]++
+			}
+		}
+	}
+
+	return v
+}
+
+func newService(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	var unavailable atomic.Bool
+
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []struct {
+				Text string `json:"text"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if len(body.Input) > 2 {
+			t.Errorf("Should embed in batches of 2, got %d", len(body.Input))
+		}
+
+		// Fail the first batch holding text that asks for it.
+		for _, in := range body.Input {
+			if strings.Contains(in.Text, "unavailable") && !unavailable.Swap(true) {
+				http.Error(w, `{"error":"service unavailable"}`, http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		var resp client.Embedding
+		for i := len(body.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, client.EmbeddingData{Index: i, Object: "embedding", Embedding: embed(body.Input[i].Text)})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	mux.HandleFunc("POST /rerank", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string   `json:"query"`
+			Documents []string `json:"documents"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		var resp client.Rerank
+		for i, doc := range body.Documents {
+			score := 0.1
+			if strings.Contains(body.Query, "concurrency") && strings.Contains(doc, "goroutines") {
+				score = 0.9
+			}
+			resp.Results = append(resp.Results, client.RerankResult{Index: i, RelevanceScore: score, Text: doc})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []client.ChatMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		content := "I don't know."
+		if strings.Contains(body.Messages[1].Content, "[1] Go has goroutines") {
+			content = "Go uses goroutines [1]."
+		}
+
+		fmt.Fprintf(w, `{"id":"chat-1","object":"chat.completion","created":1715628729,"model":"neural-chat-7b-v3-3","choices":[{"index":0,"message":{"role":"assistant","content":%q}}]}`, content)
+	})
+
+	mux.HandleFunc("POST /factuality", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"checks":[{"score":0.9,"index":0,"status":"success"}],"created":1715730425,"id":"fact-1","object":"factuality.check"}`)
+	})
+
+	// The tokenizer treats every word as a token and reports character
+	// offsets, not byte offsets, like the real endpoint.
+	mux.HandleFunc("POST /tokenize", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if len(body.Input) > 32<<10 {
+			http.Error(w, `{"error":"input too long"}`, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		resp := client.Tokenize{
+			Data: []client.TokenData{{ID: 1, Start: 0, Stop: 0, Text: "<s>"}},
+		}
+
+		runes := []rune(body.Input)
+		for i := 0; i < len(runes); {
+			for i < len(runes) && unicode.IsSpace(runes[i]) {
+				i++
+			}
+
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+
+			if i > start {
+				resp.Data = append(resp.Data, client.TokenData{ID: len(resp.Data) + 1, Start: start, Stop: i, Text: string(runes[start:i])})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	return httptest.NewServer(mux)
+}
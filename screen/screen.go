@@ -0,0 +1,544 @@
+// Package screen provides http middleware that screens inbound request text
+// with the Prediction Guard check endpoints before it reaches a handler.
+package screen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// DefaultInjectionThreshold is used when no injection threshold is configured.
+const DefaultInjectionThreshold = 0.5
+
+// maxBodyBytes bounds the size of an inbound body. Larger bodies are
+// rejected rather than screened in part.
+const maxBodyBytes = 10 << 20
+
+// Config defines the behavior of the screening middleware.
+type Config struct {
+	// Host is the base URL of the Prediction Guard API.
+	Host string
+
+	// JSONFields are dot separated paths to string values inside a JSON
+	// body. A numeric segment indexes an array and a "*" segment matches
+	// every element, so "messages.*.content" screens every chat message.
+	// When set, bodies of any content type other than a form are screened
+	// as JSON, and rejected with 415 if they aren't JSON.
+	JSONFields []string
+
+	// FormFields are the names of url encoded form and query values to
+	// screen. When set, multipart form bodies are rejected with 415 since
+	// they can't be screened.
+	FormFields []string
+
+	// InjectionThreshold rejects a request when the injection probability
+	// of any field is greater than this value. DefaultInjectionThreshold is
+	// used when this is not set.
+	InjectionThreshold float64
+
+	// ToxicityThreshold rejects a request when the toxicity score of any
+	// field is greater than this value. Zero disables the check.
+	ToxicityThreshold float64
+
+	// PII enables the PII check. Block rejects a request containing PII and
+	// Replace rewrites the body with the redacted prompt. The zero value
+	// disables the check.
+	PII client.PII
+
+	// PIIReplaceMethod is used when PII is set to Replace. Mask is used
+	// when this is not set.
+	PIIReplaceMethod client.ReplaceMethod
+
+	// RejectStatus is the status code for a rejected request.
+	// StatusBadRequest is used when this is not set.
+	RejectStatus int
+
+	// RejectBody is written for a rejected request. A JSON error document
+	// is used when this is not set.
+	RejectBody []byte
+
+	// RejectContentType is the content type for RejectBody.
+	RejectContentType string
+
+	// Log receives the details of API failures, which are reported to the
+	// caller with only the status text. Nil discards them.
+	Log client.Logger
+}
+
+// Verdict represents the result of screening a single field.
+type Verdict struct {
+	Field     string
+	Text      string
+	Injection float64
+	Toxicity  float64
+	Redacted  string
+	Rejected  bool
+	Reason    string
+}
+
+// =============================================================================
+
+type ctxKey int
+
+const verdictKey ctxKey = 1
+
+// FromContext returns the verdicts attached to the request context by the
+// middleware.
+func FromContext(ctx context.Context) ([]Verdict, bool) {
+	v, ok := ctx.Value(verdictKey).([]Verdict)
+	return v, ok
+}
+
+// =============================================================================
+
+// Middleware returns http middleware that screens the configured fields of
+// each inbound request using the specified client.
+func Middleware(cln *client.Client, cfg Config) func(http.Handler) http.Handler {
+	if cfg.Host == "" {
+		cfg.Host = client.DefaultHost
+	}
+	cfg.Host = strings.TrimSuffix(cfg.Host, "/")
+
+	if cfg.InjectionThreshold == 0 {
+		cfg.InjectionThreshold = DefaultInjectionThreshold
+	}
+
+	if cfg.RejectStatus == 0 {
+		cfg.RejectStatus = http.StatusBadRequest
+	}
+
+	if cfg.PIIReplaceMethod.String() == "" {
+		cfg.PIIReplaceMethod = client.ReplaceMethods.Mask
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = func(ctx context.Context, msg string, v ...any) {}
+	}
+
+	s := screener{
+		cln: cln,
+		cfg: cfg,
+	}
+
+	m := func(next http.Handler) http.Handler {
+		h := func(w http.ResponseWriter, r *http.Request) {
+			verdicts, err := s.screen(w, r)
+			if err != nil {
+				var re *requestError
+				if errors.As(err, &re) {
+					http.Error(w, err.Error(), re.status)
+					return
+				}
+
+				// API failures can carry upstream details that aren't for
+				// the caller.
+				s.cfg.Log(r.Context(), "screen: middleware", "method", r.Method, "path", r.URL.Path, "ERROR", err)
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+				return
+			}
+
+			for _, v := range verdicts {
+				if v.Rejected {
+					s.reject(w, v)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), verdictKey, verdicts)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(h)
+	}
+
+	return m
+}
+
+// =============================================================================
+
+// requestError is a failure caused by the inbound request rather than the
+// API, which is reported to the caller with its status.
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+type screener struct {
+	cln *client.Client
+	cfg Config
+}
+
+func (s screener) screen(w http.ResponseWriter, r *http.Request) ([]Verdict, error) {
+	verdicts, err := s.screenQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range verdicts {
+		if v.Rejected {
+			return verdicts, nil
+		}
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return verdicts, nil
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return nil, &requestError{status: http.StatusRequestEntityTooLarge, err: fmt.Errorf("body exceeds %d bytes", mbe.Limit)}
+		}
+		return nil, fmt.Errorf("readall: %w", err)
+	}
+	r.Body.Close()
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var body []Verdict
+	switch {
+	case ct == "application/json" || strings.HasSuffix(ct, "+json"):
+		body, data, err = s.screenJSON(r.Context(), data, http.StatusBadRequest)
+
+	case ct == "application/x-www-form-urlencoded":
+		body, data, err = s.screenForm(r.Context(), data)
+
+	case ct == "multipart/form-data" && len(s.cfg.FormFields) > 0:
+		err = &requestError{status: http.StatusUnsupportedMediaType, err: errors.New("multipart forms can't be screened")}
+
+	// Handlers often decode a body as JSON whatever its content type, so
+	// any other body is screened as JSON and rejected if it isn't.
+	case len(s.cfg.JSONFields) > 0:
+		body, data, err = s.screenJSON(r.Context(), data, http.StatusUnsupportedMediaType)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	setBody(r, data)
+
+	return append(verdicts, body...), nil
+}
+
+// screenQuery screens the form fields of the url query, which handlers
+// reading form values see along with the body.
+func (s screener) screenQuery(r *http.Request) ([]Verdict, error) {
+	if len(s.cfg.FormFields) == 0 || r.URL.RawQuery == "" {
+		return nil, nil
+	}
+
+	values, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, err: fmt.Errorf("parse query: %w", err)}
+	}
+
+	verdicts, rewrite, err := s.screenValues(r.Context(), values)
+	if err != nil {
+		return nil, err
+	}
+
+	if rewrite {
+		r.URL.RawQuery = values.Encode()
+		r.RequestURI = r.URL.RequestURI()
+	}
+
+	return verdicts, nil
+}
+
+// screenJSON screens the JSON fields of data, rejecting data that isn't JSON
+// with the invalid status.
+func (s screener) screenJSON(ctx context.Context, data []byte, invalid int) ([]Verdict, []byte, error) {
+	if len(s.cfg.JSONFields) == 0 {
+		return nil, data, nil
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, &requestError{status: invalid, err: fmt.Errorf("decoding: %w", err)}
+	}
+
+	var verdicts []Verdict
+	var rewrite bool
+
+	for _, field := range s.cfg.JSONFields {
+		for _, ref := range lookup(doc, "", strings.Split(field, ".")) {
+			v, err := s.check(ctx, ref.path, ref.get())
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if v.Redacted != "" && v.Redacted != v.Text {
+				ref.set(v.Redacted)
+				rewrite = true
+			}
+
+			verdicts = append(verdicts, v)
+		}
+	}
+
+	if !rewrite {
+		return verdicts, data, nil
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding: %w", err)
+	}
+
+	return verdicts, data, nil
+}
+
+func (s screener) screenForm(ctx context.Context, data []byte) ([]Verdict, []byte, error) {
+	if len(s.cfg.FormFields) == 0 {
+		return nil, data, nil
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, nil, &requestError{status: http.StatusBadRequest, err: fmt.Errorf("parse form: %w", err)}
+	}
+
+	verdicts, rewrite, err := s.screenValues(ctx, values)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !rewrite {
+		return verdicts, data, nil
+	}
+
+	return verdicts, []byte(values.Encode()), nil
+}
+
+// screenValues screens the form fields of values, replacing redacted values
+// in place and reporting if any were.
+func (s screener) screenValues(ctx context.Context, values url.Values) ([]Verdict, bool, error) {
+	var verdicts []Verdict
+	var rewrite bool
+
+	for _, field := range s.cfg.FormFields {
+		for i, text := range values[field] {
+			v, err := s.check(ctx, field, text)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if v.Redacted != "" && v.Redacted != v.Text {
+				values[field][i] = v.Redacted
+				rewrite = true
+			}
+
+			verdicts = append(verdicts, v)
+		}
+	}
+
+	return verdicts, rewrite, nil
+}
+
+func (s screener) check(ctx context.Context, field string, text string) (Verdict, error) {
+	v := Verdict{
+		Field: field,
+		Text:  text,
+	}
+
+	var inj client.Injection
+	d := client.D{
+		"prompt": text,
+		"detect": true,
+	}
+	if err := s.cln.Do(ctx, http.MethodPost, s.cfg.Host+"/injection", d, &inj); err != nil {
+		return Verdict{}, fmt.Errorf("injection: %w", err)
+	}
+
+	if len(inj.Checks) > 0 {
+		v.Injection = inj.Checks[0].Probability
+	}
+
+	if v.Injection > s.cfg.InjectionThreshold {
+		v.Rejected = true
+		v.Reason = "injection"
+		return v, nil
+	}
+
+	if s.cfg.ToxicityThreshold > 0 {
+		var tox client.Toxicity
+		d := client.D{
+			"text": text,
+		}
+		if err := s.cln.Do(ctx, http.MethodPost, s.cfg.Host+"/toxicity", d, &tox); err != nil {
+			return Verdict{}, fmt.Errorf("toxicity: %w", err)
+		}
+
+		if len(tox.Checks) > 0 {
+			v.Toxicity = tox.Checks[0].Score
+		}
+
+		if v.Toxicity > s.cfg.ToxicityThreshold {
+			v.Rejected = true
+			v.Reason = "toxicity"
+			return v, nil
+		}
+	}
+
+	if s.cfg.PII.String() != "" {
+		var pii client.ReplacePII
+		d := client.D{
+			"prompt":         text,
+			"replace":        true,
+			"replace_method": s.cfg.PIIReplaceMethod,
+		}
+		if err := s.cln.Do(ctx, http.MethodPost, s.cfg.Host+"/PII", d, &pii); err != nil {
+			return Verdict{}, fmt.Errorf("pii: %w", err)
+		}
+
+		if len(pii.Checks) > 0 {
+			v.Redacted = pii.Checks[0].NewPrompt
+		}
+
+		if v.Redacted != "" && v.Redacted != text && s.cfg.PII.Equal(client.PIIs.Block) {
+			v.Rejected = true
+			v.Reason = "pii"
+			return v, nil
+		}
+	}
+
+	return v, nil
+}
+
+func (s screener) reject(w http.ResponseWriter, v Verdict) {
+	body := s.cfg.RejectBody
+	ct := s.cfg.RejectContentType
+
+	if body == nil {
+		body, _ = json.Marshal(client.Error{
+			Message: fmt.Sprintf("request rejected: %s detected in %q", v.Reason, v.Field),
+		})
+		ct = "application/json"
+	}
+
+	if ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+
+	w.WriteHeader(s.cfg.RejectStatus)
+	w.Write(body)
+}
+
+// =============================================================================
+
+type ref struct {
+	path string
+	get  func() string
+	set  func(string)
+}
+
+// lookup walks the decoded JSON document following the path segments and
+// returns a reference to every string value that matches.
+func lookup(node any, path string, segs []string) []ref {
+	if len(segs) == 0 {
+		return nil
+	}
+
+	seg := segs[0]
+	next := path + seg
+	if path != "" {
+		next = path + "." + seg
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, exists := n[seg]
+		if !exists {
+			return nil
+		}
+
+		if len(segs) == 1 {
+			str, ok := child.(string)
+			if !ok {
+				return nil
+			}
+
+			return []ref{{
+				path: next,
+				get:  func() string { return str },
+				set:  func(s string) { n[seg] = s },
+			}}
+		}
+
+		return lookup(child, next, segs[1:])
+
+	case []any:
+		var idxs []int
+		switch seg {
+		case "*":
+			for i := range n {
+				idxs = append(idxs, i)
+			}
+
+		default:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil
+			}
+			idxs = append(idxs, i)
+		}
+
+		var refs []ref
+		for _, i := range idxs {
+			elemPath := path + "." + strconv.Itoa(i)
+			if path == "" {
+				elemPath = strconv.Itoa(i)
+			}
+
+			if len(segs) == 1 {
+				str, ok := n[i].(string)
+				if !ok {
+					continue
+				}
+
+				refs = append(refs, ref{
+					path: elemPath,
+					get:  func() string { return str },
+					set:  func(s string) { n[i] = s },
+				})
+				continue
+			}
+
+			refs = append(refs, lookup(n[i], elemPath, segs[1:])...)
+		}
+
+		return refs
+	}
+
+	return nil
+}
+
+func setBody(r *http.Request, data []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
@@ -0,0 +1,307 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// byteChars maps every byte to the printable character byte-level BPE
+// vocabularies use for it, the table GPT-2 introduced. Printable Latin-1
+// bytes map to themselves and the rest to characters from U+0100 on, so a
+// space becomes Ġ and a newline Ċ.
+var byteChars = func() [256]string {
+	var chars [256]string
+
+	next := rune(256)
+	for b := range 256 {
+		switch {
+		case b >= '!' && b <= '~', b >= 0xA1 && b <= 0xAC, b >= 0xAE && b <= 0xFF:
+			chars[b] = string(rune(b))
+		default:
+			chars[b] = string(next)
+			next++
+		}
+	}
+
+	return chars
+}()
+
+// byteSection tokenizes the text between two added tokens with a byte-level
+// model. Each character is split into its UTF-8 bytes, and tokens made of
+// part of a character cover the whole character.
+func (tk *Tokenizer) byteSection(tokens []client.TokenData, text []rune, start int, end int) []client.TokenData {
+	chars := text[start:end]
+	pos := make([]int, 0, len(chars)+1)
+
+	// The added space takes the position of the first character, like the
+	// Hugging Face implementation aligns it.
+	if tk.prefixSpace && chars[0] != ' ' {
+		chars = append([]rune{' '}, chars...)
+		pos = append(pos, start)
+	}
+
+	for i := start; i < end; i++ {
+		pos = append(pos, i)
+	}
+
+	pieces := [][2]int{{0, len(chars)}}
+	for _, p := range tk.patterns {
+		pieces = p.split(chars, pieces)
+	}
+
+	var buf [utf8.UTFMax]byte
+	for _, piece := range pieces {
+		syms := make([]symbol, 0, piece[1]-piece[0])
+
+		for i := piece[0]; i < piece[1]; i++ {
+			n := utf8.EncodeRune(buf[:], chars[i])
+			for _, b := range buf[:n] {
+				syms = append(syms, symbol{text: byteChars[b], start: pos[i], stop: pos[i] + 1})
+			}
+		}
+
+		if tk.ignoreMerges {
+			var word strings.Builder
+			for _, s := range syms {
+				word.WriteString(s.text)
+			}
+
+			if id, ok := tk.vocab[word.String()]; ok {
+				tokens = append(tokens, client.TokenData{ID: id, Start: syms[0].start, Stop: syms[len(syms)-1].stop, Text: word.String()})
+				continue
+			}
+		}
+
+		tokens = tk.emit(tokens, tk.merge(syms))
+	}
+
+	return tokens
+}
+
+// trimOffsets moves the offsets of the tokens past the spaces they start or
+// end with, as the ByteLevel post-processor does with trim_offsets set. A
+// single leading space on the first token is kept when the post-processor
+// adds a prefix space.
+func (tk *Tokenizer) trimOffsets(tokens []client.TokenData) {
+	space := byteChars[' ']
+
+	isSpace := func(r rune) bool {
+		return string(r) == space || unicode.IsSpace(r)
+	}
+
+	for i := range tokens {
+		t := &tokens[i]
+
+		trimmed := strings.TrimLeftFunc(t.Text, isSpace)
+		lead := utf8.RuneCountInString(t.Text) - utf8.RuneCountInString(trimmed)
+		trail := utf8.RuneCountInString(trimmed) - utf8.RuneCountInString(strings.TrimRightFunc(trimmed, isSpace))
+
+		// A token of only spaces counts them as both leading and trailing.
+		if trimmed == "" {
+			trail = lead
+		}
+
+		if lead > 0 {
+			if (i == 0 || t.Start == 0) && tk.trimPrefix && lead == 1 {
+				lead = 0
+			}
+			t.Start = min(t.Start+lead, t.Stop)
+		}
+
+		if trail > 0 && t.Stop >= trail {
+			t.Stop = max(t.Stop-trail, t.Start)
+		}
+	}
+}
+
+// =============================================================================
+
+// pattern is one of the regular expressions byte-level models split text
+// with. They rely on a negative lookahead, which the regexp package doesn't
+// support, so the known patterns are matched by hand instead.
+type pattern struct {
+	// foldCase matches contractions such as 'S as well as 's.
+	foldCase bool
+
+	// leadOther lets a word start with any one character that isn't a
+	// letter, number or line break, not just a space.
+	leadOther bool
+
+	// maxDigits limits the digits in a number, with no leading space. Zero
+	// allows any number of digits after an optional space.
+	maxDigits int
+
+	// lineBreaks keeps the line breaks after punctuation with it and
+	// groups whitespace up to the last line break of a run.
+	lineBreaks bool
+}
+
+// patterns are the split expressions of the byte-level models in use.
+var patterns = map[string]pattern{
+	// GPT-2, also used by the ByteLevel pre-tokenizer itself.
+	`'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`: {},
+
+	// Llama 3.
+	`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`: {
+		foldCase:   true,
+		leadOther:  true,
+		maxDigits:  3,
+		lineBreaks: true,
+	},
+
+	// Qwen 2.
+	`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`: {
+		foldCase:   true,
+		leadOther:  true,
+		maxDigits:  1,
+		lineBreaks: true,
+	},
+}
+
+// gpt2Pattern is the pattern of a ByteLevel pre-tokenizer using its regex.
+var gpt2Pattern = patterns[`'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`]
+
+// contractions are tried in the order of the expressions.
+var contractions = [][]rune{[]rune("s"), []rune("t"), []rune("re"), []rune("ve"), []rune("m"), []rune("ll"), []rune("d")}
+
+// split splits each piece into the matches of the pattern, keeping the text
+// between matches as pieces of their own.
+func (p pattern) split(text []rune, pieces [][2]int) [][2]int {
+	out := make([][2]int, 0, len(pieces))
+
+	for _, piece := range pieces {
+		gap := piece[0]
+
+		for i := piece[0]; i < piece[1]; {
+			end := p.match(text[:piece[1]], i)
+			if end == i {
+				i++
+				continue
+			}
+
+			if gap < i {
+				out = append(out, [2]int{gap, i})
+			}
+
+			out = append(out, [2]int{i, end})
+			i, gap = end, end
+		}
+
+		if gap < piece[1] {
+			out = append(out, [2]int{gap, piece[1]})
+		}
+	}
+
+	return out
+}
+
+// match returns the end of the match starting at i, trying the alternatives
+// in order like the expressions do. It returns i when nothing matches.
+func (p pattern) match(text []rune, i int) int {
+	n := len(text)
+	at := func(j int, fn func(rune) bool) bool {
+		return j < n && fn(text[j])
+	}
+	run := func(j int, fn func(rune) bool) int {
+		for j < n && fn(text[j]) {
+			j++
+		}
+		return j
+	}
+
+	if text[i] == '\'' {
+		for _, c := range contractions {
+			if p.contraction(text[i+1:], c) {
+				return i + 1 + len(c)
+			}
+		}
+	}
+
+	// Words.
+	switch {
+	case p.leadOther && !isLineBreak(text[i]) && !isLetter(text[i]) && !isNumber(text[i]) && at(i+1, isLetter):
+		return run(i+1, isLetter)
+	case !p.leadOther && text[i] == ' ' && at(i+1, isLetter):
+		return run(i+1, isLetter)
+	case isLetter(text[i]):
+		return run(i, isLetter)
+	}
+
+	// Numbers.
+	switch {
+	case p.maxDigits > 0 && isNumber(text[i]):
+		return min(run(i, isNumber), i+p.maxDigits)
+	case p.maxDigits == 0 && text[i] == ' ' && at(i+1, isNumber):
+		return run(i+1, isNumber)
+	case p.maxDigits == 0 && isNumber(text[i]):
+		return run(i, isNumber)
+	}
+
+	// Punctuation and symbols.
+	j := i
+	if text[j] == ' ' && at(j+1, isOther) {
+		j++
+	}
+	if isOther(text[j]) {
+		j = run(j, isOther)
+		if p.lineBreaks {
+			j = run(j, isLineBreak)
+		}
+		return j
+	}
+
+	// Whitespace.
+	end := run(i, unicode.IsSpace)
+	if end == i {
+		return i
+	}
+
+	if p.lineBreaks {
+		for j := end - 1; j >= i; j-- {
+			if isLineBreak(text[j]) {
+				return j + 1
+			}
+		}
+	}
+
+	// Whitespace followed by other text leaves its last character to lead
+	// the next match.
+	if end < n && end-1 > i {
+		return end - 1
+	}
+
+	return end
+}
+
+func (p pattern) contraction(text []rune, c []rune) bool {
+	if len(text) < len(c) {
+		return false
+	}
+
+	for i, r := range c {
+		if text[i] != r && !(p.foldCase && strings.EqualFold(string(text[i]), string(r))) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r)
+}
+
+func isNumber(r rune) bool {
+	return unicode.IsNumber(r)
+}
+
+func isOther(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isLineBreak(r rune) bool {
+	return r == '\r' || r == '\n'
+}
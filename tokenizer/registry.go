@@ -0,0 +1,129 @@
+package tokenizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// RegistryConfig defines where a Registry finds tokenizers.
+type RegistryConfig struct {
+	// Host is the base URL of the Prediction Guard API, used for models
+	// without a local tokenizer.
+	Host string
+
+	// Dir holds a tokenizer per model at Dir/<model>/tokenizer.json, the
+	// layout of a Hugging Face model snapshot. When empty only tokenizers
+	// added with Add are used.
+	Dir string
+}
+
+// Registry tokenizes locally for models with a tokenizer and falls back to
+// the tokenize endpoint for the rest, which includes every Unigram model. Files are loaded on first use and models without a
+// usable file are remembered, so the directory is only checked once per
+// model. It is safe for concurrent use.
+type Registry struct {
+	cln    *client.Client
+	cfg    RegistryConfig
+	mu     sync.Mutex
+	models map[string]*Tokenizer
+}
+
+// NewRegistry constructs a registry that falls back to the specified client
+// for models without a local tokenizer.
+func NewRegistry(cln *client.Client, cfg RegistryConfig) *Registry {
+	if cfg.Host == "" {
+		cfg.Host = client.DefaultHost
+	}
+	cfg.Host = strings.TrimSuffix(cfg.Host, "/")
+
+	r := Registry{
+		cln:    cln,
+		cfg:    cfg,
+		models: make(map[string]*Tokenizer),
+	}
+
+	return &r
+}
+
+// Add registers the tokenizer for the model, replacing any loaded from the
+// directory.
+func (r *Registry) Add(model string, tk *Tokenizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.models[model] = tk
+}
+
+// Local returns the local tokenizer for the model. It reports false when
+// there is no file for the model or the file uses an unsupported pipeline;
+// other load failures are returned as errors.
+func (r *Registry) Local(model string) (*Tokenizer, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tk, exists := r.models[model]; exists {
+		return tk, tk != nil, nil
+	}
+
+	if r.cfg.Dir == "" || !filepath.IsLocal(model) {
+		r.models[model] = nil
+		return nil, false, nil
+	}
+
+	tk, err := LoadFile(filepath.Join(r.cfg.Dir, model, "tokenizer.json"))
+	switch {
+	case err == nil:
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrUnsupported):
+		tk = nil
+	default:
+		return nil, false, fmt.Errorf("model %q: %w", model, err)
+	}
+
+	r.models[model] = tk
+
+	return tk, tk != nil, nil
+}
+
+// Tokenize returns the tokens for the input, locally when the model has a
+// tokenizer and from the tokenize endpoint otherwise.
+func (r *Registry) Tokenize(ctx context.Context, model string, input string) ([]client.TokenData, error) {
+	tk, ok, err := r.Local(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return tk.Tokenize(input), nil
+	}
+
+	d := client.D{
+		"model": model,
+		"input": input,
+	}
+
+	var resp client.Tokenize
+	if err := r.cln.Do(ctx, http.MethodPost, r.cfg.Host+"/tokenize", d, &resp); err != nil {
+		return nil, fmt.Errorf("tokenize: %w", err)
+	}
+
+	return resp.Data, nil
+}
+
+// Count returns the number of tokens in the input, including special
+// tokens added by the model.
+func (r *Registry) Count(ctx context.Context, model string, input string) (int, error) {
+	tokens, err := r.Tokenize(ctx, model, input)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(tokens), nil
+}
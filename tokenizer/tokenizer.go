@@ -0,0 +1,650 @@
+// Package tokenizer provides local tokenization that matches the tokenize
+// endpoint of the Prediction Guard API, so tokens can be counted without a
+// network round trip.
+//
+// SentencePiece-style BPE tokenizers, as used by Llama 2 and Mistral
+// models, and byte-level BPE tokenizers, as used by GPT-2, Llama 3 and
+// Qwen 2 models, are implemented. Files for Unigram models and pipelines
+// with other steps, such as Unicode normalization, fail to load with
+// ErrUnsupported, so a Registry sends those models to the tokenize endpoint.
+package tokenizer
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// ErrUnsupported is returned when a tokenizer file uses a model or pipeline
+// step this package doesn't implement.
+var ErrUnsupported = errors.New("unsupported tokenizer")
+
+// Tokenizer is a BPE tokenizer loaded from a Hugging Face tokenizer.json
+// file. It is safe for concurrent use.
+type Tokenizer struct {
+	vocab        map[string]int
+	ranks        map[[2]string]int
+	added        []addedToken
+	prefix       []client.TokenData
+	suffix       []client.TokenData
+	unk          int
+	unkText      string
+	fuseUnk      bool
+	byteFallback bool
+	ignoreMerges bool
+	replacement  string
+	scheme       string
+	split        bool
+	byteLevel    bool
+	prefixSpace  bool
+	patterns     []pattern
+	trim         bool
+	trimPrefix   bool
+}
+
+type addedToken struct {
+	id      int
+	content []rune
+}
+
+// Set of prepend schemes that decide which sections of the input get the
+// replacement character added in front.
+const (
+	schemeAlways = "always"
+	schemeFirst  = "first"
+	schemeNever  = "never"
+)
+
+// Load reads a tokenizer from a tokenizer.json document.
+func Load(r io.Reader) (*Tokenizer, error) {
+	var f file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	return build(f)
+}
+
+// LoadFile reads a tokenizer from a tokenizer.json file.
+func LoadFile(path string) (*Tokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Tokenize returns the tokens for the input the same way the tokenize
+// endpoint does: special tokens added by the model, such as <s>, are
+// included with empty offsets, and Start and Stop are character offsets
+// into the input with Stop exclusive.
+func (tk *Tokenizer) Tokenize(input string) []client.TokenData {
+	text := []rune(input)
+
+	tokens := make([]client.TokenData, 0, len(tk.prefix)+len(text)/3+len(tk.suffix))
+	tokens = append(tokens, tk.prefix...)
+
+	start := 0
+	for start <= len(text) {
+		pos, added, ok := tk.nextAdded(text, start)
+		if !ok {
+			pos = len(text)
+		}
+
+		tokens = tk.section(tokens, text, start, pos)
+
+		if !ok {
+			break
+		}
+
+		tokens = append(tokens, client.TokenData{
+			ID:    added.id,
+			Start: pos,
+			Stop:  pos + len(added.content),
+			Text:  string(added.content),
+		})
+
+		start = pos + len(added.content)
+	}
+
+	if tk.trim {
+		tk.trimOffsets(tokens[len(tk.prefix):])
+	}
+
+	return append(tokens, tk.suffix...)
+}
+
+// Count returns the number of tokens in the input, including special
+// tokens added by the model.
+func (tk *Tokenizer) Count(input string) int {
+	return len(tk.Tokenize(input))
+}
+
+// =============================================================================
+
+// nextAdded finds the first added token at or after start, preferring the
+// longest one when several begin at the same position.
+func (tk *Tokenizer) nextAdded(text []rune, start int) (int, addedToken, bool) {
+	for i := start; i < len(text); i++ {
+		for _, a := range tk.added {
+			if len(a.content) <= len(text)-i && slices.Equal(text[i:i+len(a.content)], a.content) {
+				return i, a, true
+			}
+		}
+	}
+
+	return 0, addedToken{}, false
+}
+
+// section tokenizes the text between two added tokens.
+func (tk *Tokenizer) section(tokens []client.TokenData, text []rune, start int, end int) []client.TokenData {
+	if start == end {
+		return tokens
+	}
+
+	if tk.byteLevel {
+		return tk.byteSection(tokens, text, start, end)
+	}
+
+	syms := make([]symbol, 0, end-start+1)
+
+	if tk.replacement != "" && (tk.scheme == schemeAlways || (tk.scheme == schemeFirst && start == 0)) {
+		syms = append(syms, symbol{text: tk.replacement, start: start, stop: start})
+	}
+
+	for i := start; i < end; i++ {
+		s := string(text[i])
+		if text[i] == ' ' && tk.replacement != "" {
+			s = tk.replacement
+		}
+		syms = append(syms, symbol{text: s, start: i, stop: i + 1})
+	}
+
+	if !tk.split {
+		return tk.emit(tokens, tk.merge(syms))
+	}
+
+	// Words begin at each replacement character.
+	for len(syms) > 0 {
+		n := 1
+		for n < len(syms) && syms[n].text != tk.replacement {
+			n++
+		}
+
+		tokens = tk.emit(tokens, tk.merge(syms[:n]))
+		syms = syms[n:]
+	}
+
+	return tokens
+}
+
+// emit appends the tokens for the merged symbols. Symbols missing from the
+// vocabulary become byte tokens when the model has them and the unknown
+// token otherwise.
+func (tk *Tokenizer) emit(tokens []client.TokenData, syms []symbol) []client.TokenData {
+	var lastUnk bool
+
+	for _, s := range syms {
+		if id, ok := tk.vocab[s.text]; ok {
+			tokens = append(tokens, client.TokenData{ID: id, Start: s.start, Stop: s.stop, Text: s.text})
+			lastUnk = false
+			continue
+		}
+
+		if tk.byteFallback {
+			if bytes, ok := tk.byteTokens(s); ok {
+				tokens = append(tokens, bytes...)
+				lastUnk = false
+				continue
+			}
+		}
+
+		if tk.unk < 0 {
+			continue
+		}
+
+		if lastUnk && tk.fuseUnk {
+			tokens[len(tokens)-1].Stop = s.stop
+			continue
+		}
+
+		tokens = append(tokens, client.TokenData{ID: tk.unk, Start: s.start, Stop: s.stop, Text: tk.unkText})
+		lastUnk = true
+	}
+
+	return tokens
+}
+
+// byteTokens returns a token per UTF-8 byte of the symbol, all covering the
+// symbol's characters.
+func (tk *Tokenizer) byteTokens(s symbol) ([]client.TokenData, bool) {
+	tokens := make([]client.TokenData, len(s.text))
+
+	for i := range len(s.text) {
+		text := fmt.Sprintf("<0x%02X>", s.text[i])
+
+		id, ok := tk.vocab[text]
+		if !ok {
+			return nil, false
+		}
+
+		tokens[i] = client.TokenData{ID: id, Start: s.start, Stop: s.stop, Text: text}
+	}
+
+	return tokens, true
+}
+
+// =============================================================================
+
+type symbol struct {
+	text  string
+	start int
+	stop  int
+	prev  int
+	next  int
+}
+
+type candidate struct {
+	rank int
+	left int
+}
+
+type candidates []candidate
+
+func (c candidates) Len() int { return len(c) }
+func (c candidates) Less(i, j int) bool {
+	if c[i].rank != c[j].rank {
+		return c[i].rank < c[j].rank
+	}
+	return c[i].left < c[j].left
+}
+func (c candidates) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c *candidates) Push(x any)   { *c = append(*c, x.(candidate)) }
+func (c *candidates) Pop() any {
+	old := *c
+	x := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return x
+}
+
+// merge applies the merges to the symbols, always taking the lowest ranked
+// pair and the leftmost one on ties. Symbols are kept in a linked list so
+// each merge is a heap operation rather than a rescan.
+func (tk *Tokenizer) merge(syms []symbol) []symbol {
+	if len(syms) < 2 {
+		return syms
+	}
+
+	for i := range syms {
+		syms[i].prev = i - 1
+		syms[i].next = i + 1
+	}
+	syms[len(syms)-1].next = -1
+
+	var queue candidates
+	push := func(left int) {
+		if left < 0 || syms[left].next < 0 {
+			return
+		}
+		right := syms[left].next
+		if rank, ok := tk.ranks[[2]string{syms[left].text, syms[right].text}]; ok {
+			heap.Push(&queue, candidate{rank: rank, left: left})
+		}
+	}
+
+	for i := range len(syms) - 1 {
+		push(i)
+	}
+
+	for queue.Len() > 0 {
+		c := heap.Pop(&queue).(candidate)
+
+		left := &syms[c.left]
+		if left.text == "" || left.next < 0 {
+			continue
+		}
+
+		// The pair may have changed since it was queued. Ranks are unique,
+		// so a matching rank means the same pair.
+		right := &syms[left.next]
+		if rank, ok := tk.ranks[[2]string{left.text, right.text}]; !ok || rank != c.rank {
+			continue
+		}
+
+		left.text += right.text
+		left.stop = right.stop
+		left.next = right.next
+		if right.next >= 0 {
+			syms[right.next].prev = c.left
+		}
+		right.text = ""
+
+		push(left.prev)
+		push(c.left)
+	}
+
+	out := syms[:0]
+	for i := 0; i >= 0; i = syms[i].next {
+		out = append(out, syms[i])
+	}
+
+	return out
+}
+
+// =============================================================================
+
+type file struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	Normalizer    *component `json:"normalizer"`
+	PreTokenizer  *component `json:"pre_tokenizer"`
+	PostProcessor *component `json:"post_processor"`
+	Model         struct {
+		Type                    string            `json:"type"`
+		UnkToken                *string           `json:"unk_token"`
+		FuseUnk                 bool              `json:"fuse_unk"`
+		ByteFallback            bool              `json:"byte_fallback"`
+		IgnoreMerges            bool              `json:"ignore_merges"`
+		ContinuingSubwordPrefix *string           `json:"continuing_subword_prefix"`
+		EndOfWordSuffix         *string           `json:"end_of_word_suffix"`
+		Vocab                   json.RawMessage   `json:"vocab"`
+		Merges                  []json.RawMessage `json:"merges"`
+	} `json:"model"`
+}
+
+type component struct {
+	Type          string      `json:"type"`
+	Normalizers   []component `json:"normalizers"`
+	PreTokenizers []component `json:"pretokenizers"`
+	Processors    []component `json:"processors"`
+	Prepend       string      `json:"prepend"`
+	Pattern       struct {
+		String *string `json:"String"`
+		Regex  *string `json:"Regex"`
+	} `json:"pattern"`
+	Behavior       string `json:"behavior"`
+	Invert         bool   `json:"invert"`
+	Content        string `json:"content"`
+	Replacement    string `json:"replacement"`
+	AddPrefixSpace *bool  `json:"add_prefix_space"`
+	TrimOffsets    *bool  `json:"trim_offsets"`
+	UseRegex       *bool  `json:"use_regex"`
+	PrependScheme  string `json:"prepend_scheme"`
+	Split          *bool  `json:"split"`
+	Single         []struct {
+		SpecialToken *struct {
+			ID string `json:"id"`
+		} `json:"SpecialToken"`
+		Sequence *struct {
+			ID string `json:"id"`
+		} `json:"Sequence"`
+	} `json:"single"`
+	SpecialTokens map[string]struct {
+		IDs    []int    `json:"ids"`
+		Tokens []string `json:"tokens"`
+	} `json:"special_tokens"`
+}
+
+func build(f file) (*Tokenizer, error) {
+	if f.Model.Type != "BPE" {
+		return nil, fmt.Errorf("model type %q: %w", f.Model.Type, ErrUnsupported)
+	}
+
+	if f.Model.ContinuingSubwordPrefix != nil || f.Model.EndOfWordSuffix != nil {
+		return nil, fmt.Errorf("subword affixes: %w", ErrUnsupported)
+	}
+
+	var vocab map[string]int
+	if err := json.Unmarshal(f.Model.Vocab, &vocab); err != nil {
+		return nil, fmt.Errorf("vocab: %w", err)
+	}
+
+	tk := Tokenizer{
+		vocab:        vocab,
+		ranks:        make(map[[2]string]int, len(f.Model.Merges)),
+		unk:          -1,
+		fuseUnk:      f.Model.FuseUnk,
+		byteFallback: f.Model.ByteFallback,
+		ignoreMerges: f.Model.IgnoreMerges,
+		scheme:       schemeNever,
+	}
+
+	if f.Model.UnkToken != nil {
+		id, ok := tk.vocab[*f.Model.UnkToken]
+		if !ok {
+			return nil, fmt.Errorf("unknown token %q isn't in the vocabulary", *f.Model.UnkToken)
+		}
+		tk.unk = id
+		tk.unkText = *f.Model.UnkToken
+	}
+
+	for i, raw := range f.Model.Merges {
+		pair, err := parseMerge(raw)
+		if err != nil {
+			return nil, fmt.Errorf("merge %d: %w", i, err)
+		}
+		if _, exists := tk.ranks[pair]; !exists {
+			tk.ranks[pair] = i
+		}
+	}
+
+	for _, a := range f.AddedTokens {
+		if a.Content == "" {
+			continue
+		}
+		tk.added = append(tk.added, addedToken{id: a.ID, content: []rune(a.Content)})
+	}
+
+	// The longest token wins when several match at the same position.
+	slices.SortStableFunc(tk.added, func(a, b addedToken) int {
+		return len(b.content) - len(a.content)
+	})
+
+	if err := tk.normalizer(f.Normalizer); err != nil {
+		return nil, err
+	}
+
+	if err := tk.preTokenizer(f.PreTokenizer); err != nil {
+		return nil, err
+	}
+
+	if err := tk.postProcessor(f.PostProcessor); err != nil {
+		return nil, err
+	}
+
+	// Splits only apply to byte-level models, and the two kinds of space
+	// handling don't mix.
+	if (len(tk.patterns) > 0 && !tk.byteLevel) || (tk.byteLevel && tk.replacement != "") {
+		return nil, fmt.Errorf("pre-tokenizers: %w", ErrUnsupported)
+	}
+
+	return &tk, nil
+}
+
+func parseMerge(raw json.RawMessage) ([2]string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		a, b, ok := strings.Cut(s, " ")
+		if !ok || a == "" || b == "" || strings.Contains(b, " ") {
+			return [2]string{}, fmt.Errorf("invalid merge %q", s)
+		}
+		return [2]string{a, b}, nil
+	}
+
+	var pair []string
+	if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+		return [2]string{}, fmt.Errorf("invalid merge %s", raw)
+	}
+
+	return [2]string{pair[0], pair[1]}, nil
+}
+
+// normalizer accepts the normalizer of recent Llama and Mistral files, which
+// prepends the replacement character and replaces spaces with it.
+func (tk *Tokenizer) normalizer(c *component) error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.Type {
+	case "Sequence":
+		for i := range c.Normalizers {
+			if err := tk.normalizer(&c.Normalizers[i]); err != nil {
+				return err
+			}
+		}
+
+	case "Prepend":
+		if tk.replacement != "" && tk.replacement != c.Prepend {
+			return fmt.Errorf("prepend %q: %w", c.Prepend, ErrUnsupported)
+		}
+		tk.replacement = c.Prepend
+		tk.scheme = schemeAlways
+
+	case "Replace":
+		if c.Pattern.String == nil || *c.Pattern.String != " " || (tk.replacement != "" && tk.replacement != c.Content) {
+			return fmt.Errorf("replace %q: %w", c.Content, ErrUnsupported)
+		}
+		tk.replacement = c.Content
+
+	default:
+		return fmt.Errorf("normalizer %q: %w", c.Type, ErrUnsupported)
+	}
+
+	return nil
+}
+
+// preTokenizer accepts the Metaspace pre-tokenizer of older Llama and
+// Mistral files, and the ByteLevel and Split pre-tokenizers of byte-level
+// models.
+func (tk *Tokenizer) preTokenizer(c *component) error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.Type {
+	case "Sequence":
+		for i := range c.PreTokenizers {
+			if err := tk.preTokenizer(&c.PreTokenizers[i]); err != nil {
+				return err
+			}
+		}
+
+	case "Metaspace":
+		tk.replacement = c.Replacement
+		tk.split = c.Split == nil || *c.Split
+
+		switch {
+		case c.PrependScheme != "":
+			if c.PrependScheme != schemeAlways && c.PrependScheme != schemeFirst && c.PrependScheme != schemeNever {
+				return fmt.Errorf("prepend scheme %q: %w", c.PrependScheme, ErrUnsupported)
+			}
+			tk.scheme = c.PrependScheme
+
+		case c.AddPrefixSpace == nil || *c.AddPrefixSpace:
+			tk.scheme = schemeAlways
+
+		default:
+			tk.scheme = schemeNever
+		}
+
+	case "ByteLevel":
+		if tk.byteLevel {
+			return fmt.Errorf("pre-tokenizer %q twice: %w", c.Type, ErrUnsupported)
+		}
+		tk.byteLevel = true
+
+		// The prefix space is added to every piece split so far, which is
+		// only the whole section when nothing was split before.
+		tk.prefixSpace = c.AddPrefixSpace == nil || *c.AddPrefixSpace
+		if tk.prefixSpace && len(tk.patterns) > 0 {
+			return fmt.Errorf("prefix space after split: %w", ErrUnsupported)
+		}
+
+		if c.UseRegex == nil || *c.UseRegex {
+			tk.patterns = append(tk.patterns, gpt2Pattern)
+		}
+
+	case "Split":
+		if c.Pattern.Regex == nil || c.Behavior != "Isolated" || c.Invert || tk.byteLevel {
+			return fmt.Errorf("split: %w", ErrUnsupported)
+		}
+
+		p, ok := patterns[*c.Pattern.Regex]
+		if !ok {
+			return fmt.Errorf("split pattern %q: %w", *c.Pattern.Regex, ErrUnsupported)
+		}
+		tk.patterns = append(tk.patterns, p)
+
+	default:
+		return fmt.Errorf("pre-tokenizer %q: %w", c.Type, ErrUnsupported)
+	}
+
+	return nil
+}
+
+// postProcessor reads the special tokens added around a single input and
+// the offset trimming of byte-level models.
+func (tk *Tokenizer) postProcessor(c *component) error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.Type {
+	case "Sequence":
+		for i := range c.Processors {
+			if err := tk.postProcessor(&c.Processors[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "ByteLevel":
+		tk.trim = c.TrimOffsets == nil || *c.TrimOffsets
+		tk.trimPrefix = c.AddPrefixSpace == nil || *c.AddPrefixSpace
+		return nil
+
+	case "TemplateProcessing":
+	default:
+		return fmt.Errorf("post-processor %q: %w", c.Type, ErrUnsupported)
+	}
+
+	var seen bool
+	for _, piece := range c.Single {
+		if piece.Sequence != nil {
+			seen = true
+			continue
+		}
+
+		if piece.SpecialToken == nil {
+			continue
+		}
+
+		special, ok := c.SpecialTokens[piece.SpecialToken.ID]
+		if !ok || len(special.IDs) != len(special.Tokens) {
+			return fmt.Errorf("special token %q isn't defined", piece.SpecialToken.ID)
+		}
+
+		for i, id := range special.IDs {
+			token := client.TokenData{ID: id, Text: special.Tokens[i]}
+			if seen {
+				tk.suffix = append(tk.suffix, token)
+			} else {
+				tk.prefix = append(tk.prefix, token)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,365 @@
+package tokenizer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/tokenizer"
+)
+
+// expected represents an input and the tokens the reference implementation
+// produces for it. See testdata/README.md for how they were generated.
+type expected struct {
+	Input  string             `json:"input"`
+	Tokens []client.TokenData `json:"tokens"`
+}
+
+func loadExpected(t *testing.T, model string) []expected {
+	data, err := os.ReadFile(filepath.Join("testdata", model, "expected.json"))
+	if err != nil {
+		t.Fatalf("Should be able to read the expected tokens: %s", err)
+	}
+
+	var exps []expected
+	if err := json.Unmarshal(data, &exps); err != nil {
+		t.Fatalf("Should be able to decode the expected tokens: %s", err)
+	}
+
+	return exps
+}
+
+func Test_Tokenizer(t *testing.T) {
+	// The legacy file uses a Metaspace pre-tokenizer that only prefixes the
+	// start of the input, the current one a normalizer that prefixes every
+	// section between added tokens.
+	for _, model := range []string{"tiny-llama", "tiny-llama-legacy"} {
+		t.Run(model, func(t *testing.T) {
+			tk, err := tokenizer.LoadFile(filepath.Join("testdata", model, "tokenizer.json"))
+			if err != nil {
+				t.Fatalf("Should be able to load the tokenizer: %s", err)
+			}
+
+			for _, exp := range loadExpected(t, model) {
+				got := tk.Tokenize(exp.Input)
+
+				if diff := cmp.Diff(got, exp.Tokens); diff != "" {
+					t.Fatalf("Should match the reference for %q, diff:\n%s", exp.Input, diff)
+				}
+
+				if n := tk.Count(exp.Input); n != len(exp.Tokens) {
+					t.Fatalf("Should count %d tokens for %q, got %d", len(exp.Tokens), exp.Input, n)
+				}
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		tests := []struct {
+			name string
+			json string
+		}{
+			{"unigram", `{"model":{"type":"Unigram","vocab":[]}}`},
+			{"nfkc", `{"normalizer":{"type":"NFKC"},"model":{"type":"BPE","vocab":{},"merges":[]}}`},
+			{"split-pattern", `{"pre_tokenizer":{"type":"Sequence","pretokenizers":[{"type":"Split","pattern":{"Regex":"\\s+"},"behavior":"Isolated"},{"type":"ByteLevel","use_regex":false}]},"model":{"type":"BPE","vocab":{},"merges":[]}}`},
+			{"split-without-byte-level", `{"pre_tokenizer":{"type":"Split","pattern":{"Regex":"'s|'t|'re|'ve|'m|'ll|'d| ?\\p{L}+| ?\\p{N}+| ?[^\\s\\p{L}\\p{N}]+|\\s+(?!\\S)|\\s+"},"behavior":"Isolated"},"model":{"type":"BPE","vocab":{},"merges":[]}}`},
+		}
+
+		for _, tt := range tests {
+			if _, err := tokenizer.Load(strings.NewReader(tt.json)); !errors.Is(err, tokenizer.ErrUnsupported) {
+				t.Fatalf("%s: Should be unsupported, got %v", tt.name, err)
+			}
+		}
+
+		if _, err := tokenizer.Load(strings.NewReader(`{"model":{"type":"BPE","vocab":{},"merges":["nospace"]}}`)); err == nil {
+			t.Fatalf("Should reject a malformed merge")
+		}
+	})
+}
+
+func Test_ByteLevel(t *testing.T) {
+	tests := []struct {
+		model  string
+		input  string
+		tokens []client.TokenData
+	}{
+		{
+			model: "tiny-gpt2",
+			input: "Hello world",
+			tokens: []client.TokenData{
+				{ID: 264, Start: 0, Stop: 5, Text: "Hello"},
+				{ID: 260, Start: 6, Stop: 11, Text: "Ġworld"},
+			},
+		},
+		{
+			model: "tiny-gpt2",
+			input: "Hello  world",
+			tokens: []client.TokenData{
+				{ID: 264, Start: 0, Stop: 5, Text: "Hello"},
+				{ID: 32, Start: 6, Stop: 6, Text: "Ġ"},
+				{ID: 260, Start: 7, Stop: 12, Text: "Ġworld"},
+			},
+		},
+		{
+			model: "tiny-gpt2",
+			input: "it's 12é<|endoftext|>",
+			tokens: []client.TokenData{
+				{ID: 105, Start: 0, Stop: 1, Text: "i"},
+				{ID: 116, Start: 1, Stop: 2, Text: "t"},
+				{ID: 267, Start: 2, Stop: 4, Text: "'s"},
+				{ID: 32, Start: 5, Stop: 5, Text: "Ġ"},
+				{ID: 268, Start: 5, Stop: 7, Text: "12"},
+				{ID: 266, Start: 7, Stop: 8, Text: "Ã©"},
+				{ID: 269, Start: 8, Stop: 21, Text: "<|endoftext|>"},
+			},
+		},
+		{
+			model: "tiny-gpt2",
+			input: "héllo\n\nworld  ",
+			tokens: []client.TokenData{
+				{ID: 104, Start: 0, Stop: 1, Text: "h"},
+				{ID: 266, Start: 1, Stop: 2, Text: "Ã©"},
+				{ID: 262, Start: 2, Stop: 4, Text: "ll"},
+				{ID: 111, Start: 4, Stop: 5, Text: "o"},
+				{ID: 10, Start: 5, Stop: 6, Text: "Ċ"},
+				{ID: 10, Start: 6, Stop: 7, Text: "Ċ"},
+				{ID: 119, Start: 7, Stop: 8, Text: "w"},
+				{ID: 257, Start: 8, Stop: 10, Text: "or"},
+				{ID: 259, Start: 10, Stop: 12, Text: "ld"},
+				{ID: 265, Start: 14, Stop: 14, Text: "ĠĠ"},
+			},
+		},
+		{
+			model: "tiny-llama3",
+			input: "Hello world",
+			tokens: []client.TokenData{
+				{ID: 270, Text: "<|begin_of_text|>"},
+				{ID: 264, Start: 0, Stop: 5, Text: "Hello"},
+				{ID: 260, Start: 5, Stop: 11, Text: "Ġworld"},
+			},
+		},
+		{
+			// The vocabulary has Ġthere without the merges to build it.
+			model: "tiny-llama3",
+			input: "Hi there!\n\n12345",
+			tokens: []client.TokenData{
+				{ID: 270, Text: "<|begin_of_text|>"},
+				{ID: 72, Start: 0, Stop: 1, Text: "H"},
+				{ID: 105, Start: 1, Stop: 2, Text: "i"},
+				{ID: 271, Start: 2, Stop: 8, Text: "Ġthere"},
+				{ID: 33, Start: 8, Stop: 9, Text: "!"},
+				{ID: 10, Start: 9, Stop: 10, Text: "Ċ"},
+				{ID: 10, Start: 10, Stop: 11, Text: "Ċ"},
+				{ID: 268, Start: 11, Stop: 13, Text: "12"},
+				{ID: 51, Start: 13, Stop: 14, Text: "3"},
+				{ID: 52, Start: 14, Stop: 15, Text: "4"},
+				{ID: 53, Start: 15, Stop: 16, Text: "5"},
+			},
+		},
+		{
+			model: "tiny-llama3",
+			input: "IT'S",
+			tokens: []client.TokenData{
+				{ID: 270, Text: "<|begin_of_text|>"},
+				{ID: 73, Start: 0, Stop: 1, Text: "I"},
+				{ID: 84, Start: 1, Stop: 2, Text: "T"},
+				{ID: 39, Start: 2, Stop: 3, Text: "'"},
+				{ID: 83, Start: 3, Stop: 4, Text: "S"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tk, err := tokenizer.LoadFile(filepath.Join("testdata", tt.model, "tokenizer.json"))
+		if err != nil {
+			t.Fatalf("%s: Should be able to load the tokenizer: %s", tt.model, err)
+		}
+
+		if diff := cmp.Diff(tk.Tokenize(tt.input), tt.tokens); diff != "" {
+			t.Fatalf("%s: Should get the expected tokens for %q, diff:\n%s", tt.model, tt.input, diff)
+		}
+	}
+}
+
+var record = flag.Bool("record", false, "record the tokenize responses in testdata/recorded using PREDICTIONGUARD_API_KEY")
+
+// Test_Recorded checks the tokenizers in testdata/recorded against the
+// responses of the tokenize endpoint for the same model. Each directory is
+// named after a served model and holds its tokenizer.json and the recorded
+// responses.json. See testdata/README.md for how to record them.
+func Test_Recorded(t *testing.T) {
+	models, _ := filepath.Glob(filepath.Join("testdata", "recorded", "*", "tokenizer.json"))
+	if len(models) == 0 {
+		t.Skip("no recorded models in testdata/recorded")
+	}
+
+	if *record {
+		recordResponses(t, models)
+	}
+
+	for _, path := range models {
+		dir := filepath.Dir(path)
+
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			tk, err := tokenizer.LoadFile(path)
+			if err != nil {
+				t.Fatalf("Should be able to load the tokenizer: %s", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "responses.json"))
+			if err != nil {
+				t.Fatalf("Should be able to read the recorded responses: %s", err)
+			}
+
+			var exps []expected
+			if err := json.Unmarshal(data, &exps); err != nil {
+				t.Fatalf("Should be able to decode the recorded responses: %s", err)
+			}
+
+			for _, exp := range exps {
+				if diff := cmp.Diff(tk.Tokenize(exp.Input), exp.Tokens); diff != "" {
+					t.Fatalf("Should match the tokenize endpoint for %q, diff:\n%s", exp.Input, diff)
+				}
+			}
+		})
+	}
+}
+
+// recordResponses calls the tokenize endpoint for every input in
+// testdata/recorded/inputs.json and writes the responses next to each
+// model's tokenizer.
+func recordResponses(t *testing.T, models []string) {
+	data, err := os.ReadFile(filepath.Join("testdata", "recorded", "inputs.json"))
+	if err != nil {
+		t.Fatalf("Should be able to read the inputs: %s", err)
+	}
+
+	var inputs []string
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		t.Fatalf("Should be able to decode the inputs: %s", err)
+	}
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, os.Getenv("PREDICTIONGUARD_API_KEY"))
+
+	for _, path := range models {
+		dir := filepath.Dir(path)
+
+		exps := make([]expected, len(inputs))
+		for i, input := range inputs {
+			d := client.D{
+				"model": filepath.Base(dir),
+				"input": input,
+			}
+
+			var resp client.Tokenize
+			if err := cln.Do(context.Background(), http.MethodPost, client.DefaultHost+"/tokenize", d, &resp); err != nil {
+				t.Fatalf("%s: Should be able to tokenize %q: %s", filepath.Base(dir), input, err)
+			}
+
+			exps[i] = expected{Input: input, Tokens: resp.Data}
+		}
+
+		data, err := json.MarshalIndent(exps, "", "  ")
+		if err != nil {
+			t.Fatalf("Should be able to encode the responses: %s", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "responses.json"), append(data, '\n'), 0o644); err != nil {
+			t.Fatalf("Should be able to write the responses: %s", err)
+		}
+	}
+}
+
+func Test_Registry(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tokenize", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"id":"token-1","object":"tokens","created":1729871708,"model":"remote","data":[{"id":1,"start":0,"stop":0,"text":"<s>"},{"id":42,"start":0,"stop":2,"text":"▁hi"}]}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, "key")
+
+	// A model with a file the package can't use falls back too.
+	dir := t.TempDir()
+	data, _ := os.ReadFile(filepath.Join("testdata", "tiny-llama", "tokenizer.json"))
+	os.MkdirAll(filepath.Join(dir, "tiny-llama"), 0o755)
+	os.WriteFile(filepath.Join(dir, "tiny-llama", "tokenizer.json"), data, 0o644)
+	os.MkdirAll(filepath.Join(dir, "unigram"), 0o755)
+	os.WriteFile(filepath.Join(dir, "unigram", "tokenizer.json"), []byte(`{"model":{"type":"Unigram"}}`), 0o644)
+
+	reg := tokenizer.NewRegistry(cln, tokenizer.RegistryConfig{Host: srv.URL, Dir: dir})
+
+	exp := loadExpected(t, "tiny-llama")[0]
+
+	for range 2 {
+		got, err := reg.Tokenize(ctx, "tiny-llama", exp.Input)
+		if err != nil {
+			t.Fatalf("Should be able to tokenize locally: %s", err)
+		}
+
+		if diff := cmp.Diff(got, exp.Tokens); diff != "" {
+			t.Fatalf("Should match the reference, diff:\n%s", diff)
+		}
+	}
+
+	if calls.Load() != 0 {
+		t.Fatalf("Should not call the api for a local model, got %d calls", calls.Load())
+	}
+
+	for _, model := range []string{"remote", "unigram", "../tiny-llama"} {
+		n, err := reg.Count(ctx, model, "hi")
+		if err != nil {
+			t.Fatalf("%s: Should fall back to the api: %s", model, err)
+		}
+
+		if n != 2 {
+			t.Fatalf("%s: Should get 2 tokens, got %d", model, n)
+		}
+	}
+
+	if calls.Load() != 3 {
+		t.Fatalf("Should call the api for each remote model, got %d calls", calls.Load())
+	}
+
+	// A broken file is an error rather than a silent fallback.
+	os.MkdirAll(filepath.Join(dir, "broken"), 0o755)
+	os.WriteFile(filepath.Join(dir, "broken", "tokenizer.json"), []byte(`{`), 0o644)
+
+	if _, err := reg.Tokenize(ctx, "broken", "hi"); err == nil {
+		t.Fatalf("Should fail for a broken tokenizer file")
+	}
+}
+
+func Benchmark_Tokenize(b *testing.B) {
+	tk, err := tokenizer.LoadFile(filepath.Join("testdata", "tiny-llama", "tokenizer.json"))
+	if err != nil {
+		b.Fatalf("Should be able to load the tokenizer: %s", err)
+	}
+
+	input := strings.Repeat("how many tokens exist for this sentence. ", 100)
+
+	b.ResetTimer()
+	for range b.N {
+		tk.Tokenize(input)
+	}
+}
@@ -0,0 +1,70 @@
+package vector
+
+import "fmt"
+
+type metricSet struct {
+	Cosine     Metric
+	DotProduct Metric
+	L2         Metric
+}
+
+// Metrics represents the set of supported similarity metrics.
+var Metrics = metricSet{
+	Cosine:     newMetric("cosine"),
+	DotProduct: newMetric("dot"),
+	L2:         newMetric("l2"),
+}
+
+func (metricSet) Parse(value string) (Metric, error) {
+	metric, exists := metrics[value]
+	if !exists {
+		return Metric{}, fmt.Errorf("invalid metric %q", value)
+	}
+
+	return metric, nil
+}
+
+func (metricSet) MustParse(value string) Metric {
+	metric, err := Metrics.Parse(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return metric
+}
+
+// =============================================================================
+
+var metrics = make(map[string]Metric)
+
+type Metric struct {
+	value string
+}
+
+func newMetric(metric string) Metric {
+	m := Metric{metric}
+	metrics[metric] = m
+	return m
+}
+
+func (m Metric) String() string {
+	return m.value
+}
+
+func (m *Metric) UnmarshalText(data []byte) error {
+	metric, err := Metrics.Parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	m.value = metric.value
+	return nil
+}
+
+func (m Metric) MarshalText() ([]byte, error) {
+	return []byte(m.value), nil
+}
+
+func (m Metric) Equal(m2 Metric) bool {
+	return m.value == m2.value
+}
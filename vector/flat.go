@@ -0,0 +1,187 @@
+package vector
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Flat is an exact index that compares a query against every stored vector.
+// It is safe for concurrent use.
+type Flat struct {
+	metric Metric
+	mu     sync.RWMutex
+	dim    int
+	ids    map[string]int
+	items  []Item
+	norms  []float64
+}
+
+// NewFlat constructs a flat index using the specified metric.
+func NewFlat(metric Metric) *Flat {
+	return &Flat{
+		metric: metric,
+		ids:    make(map[string]int),
+	}
+}
+
+// Metric returns the metric used by the index.
+func (f *Flat) Metric() Metric {
+	return f.metric
+}
+
+// Len returns the number of items in the index.
+func (f *Flat) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return len(f.items)
+}
+
+// Add stores a copy of the items in the index. No items are stored if any id
+// already exists or any vector has the wrong dimension.
+func (f *Flat) Add(items ...Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dim := f.dim
+	seen := make(map[string]struct{}, len(items))
+
+	for _, item := range items {
+		if _, exists := f.ids[item.ID]; exists {
+			return fmt.Errorf("add %q: %w", item.ID, ErrExists)
+		}
+
+		if _, exists := seen[item.ID]; exists {
+			return fmt.Errorf("add %q: %w", item.ID, ErrExists)
+		}
+		seen[item.ID] = struct{}{}
+
+		if dim == 0 {
+			dim = len(item.Vector)
+		}
+
+		if len(item.Vector) != dim || dim == 0 {
+			return fmt.Errorf("add %q: %w", item.ID, ErrDimension)
+		}
+	}
+
+	f.dim = dim
+
+	for _, item := range items {
+		f.ids[item.ID] = len(f.items)
+		f.items = append(f.items, item.clone())
+		f.norms = append(f.norms, norm(item.Vector))
+	}
+
+	return nil
+}
+
+// Update replaces the vector and metadata of an existing item.
+func (f *Flat) Update(item Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	idx, exists := f.ids[item.ID]
+	if !exists {
+		return fmt.Errorf("update %q: %w", item.ID, ErrNotFound)
+	}
+
+	if len(item.Vector) != f.dim {
+		return fmt.Errorf("update %q: %w", item.ID, ErrDimension)
+	}
+
+	f.items[idx] = item.clone()
+	f.norms[idx] = norm(item.Vector)
+
+	return nil
+}
+
+// Delete removes the items with the specified ids and returns the number
+// of items removed.
+func (f *Flat) Delete(ids ...string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int
+	for _, id := range ids {
+		idx, exists := f.ids[id]
+		if !exists {
+			continue
+		}
+
+		// Move the last item into the deleted slot to keep storage dense.
+		last := len(f.items) - 1
+		if idx != last {
+			f.items[idx] = f.items[last]
+			f.norms[idx] = f.norms[last]
+			f.ids[f.items[idx].ID] = idx
+		}
+
+		f.items[last] = Item{}
+		f.items = f.items[:last]
+		f.norms = f.norms[:last]
+		delete(f.ids, id)
+		n++
+	}
+
+	if len(f.items) == 0 {
+		f.dim = 0
+	}
+
+	return n
+}
+
+// Get returns a copy of the item with the specified id.
+func (f *Flat) Get(id string) (Item, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	idx, exists := f.ids[id]
+	if !exists {
+		return Item{}, false
+	}
+
+	return f.items[idx].clone(), true
+}
+
+// Search returns the k items closest to the query, best match first. The
+// filter can be nil.
+func (f *Flat) Search(query []float64, k int, filter Filter) ([]Result, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.items) == 0 || k <= 0 {
+		return nil, nil
+	}
+
+	if len(query) != f.dim {
+		return nil, ErrDimension
+	}
+
+	qNorm := norm(query)
+	top := topK{k: k}
+
+	for i, item := range f.items {
+		if filter != nil && !filter(item.Metadata) {
+			continue
+		}
+
+		top.offer(candidate{
+			idx: i,
+			sim: similarity(f.metric, query, qNorm, item.Vector, f.norms[i]),
+		})
+	}
+
+	cands := top.sorted()
+	results := make([]Result, len(cands))
+	for i, c := range cands {
+		item := f.items[c.idx]
+		results[i] = Result{
+			ID:       item.ID,
+			Score:    externalScore(f.metric, c.sim),
+			Metadata: item.Metadata,
+		}
+	}
+
+	return results, nil
+}
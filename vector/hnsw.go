@@ -0,0 +1,583 @@
+package vector
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Default HNSW tuning parameters.
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 64
+)
+
+// HNSWConfig represents the tuning parameters for an HNSW index.
+type HNSWConfig struct {
+	// M is the number of neighbors each node links to on the upper layers.
+	// Layer zero links to 2*M neighbors. Higher values improve recall at the
+	// cost of memory and insert time.
+	M int
+
+	// EfConstruction is the size of the candidate list used while inserting.
+	EfConstruction int
+
+	// EfSearch is the size of the candidate list used while searching. It is
+	// raised to k when a search asks for more results.
+	EfSearch int
+
+	// Seed makes the level assignment of nodes reproducible.
+	Seed int64
+}
+
+type hnswNode struct {
+	item    Item
+	norm    float64
+	friends [][]int32
+	deleted bool
+}
+
+// HNSW is an approximate nearest neighbor index based on hierarchical
+// navigable small world graphs. Deleted items are marked and skipped but
+// remain in the graph for navigation until Compact is called. It is safe
+// for concurrent use.
+type HNSW struct {
+	metric  Metric
+	cfg     HNSWConfig
+	ml      float64
+	mu      sync.RWMutex
+	rng     *rand.Rand
+	dim     int
+	nodes   []*hnswNode
+	ids     map[string]int32
+	entry   int32
+	level   int
+	deleted int
+	visited sync.Pool
+}
+
+// NewHNSW constructs an HNSW index using the specified metric and config.
+// Zero values in the config are replaced with the defaults.
+func NewHNSW(metric Metric, cfg HNSWConfig) *HNSW {
+	if cfg.M <= 1 {
+		cfg.M = DefaultM
+	}
+
+	if cfg.EfConstruction <= 0 {
+		cfg.EfConstruction = DefaultEfConstruction
+	}
+
+	if cfg.EfSearch <= 0 {
+		cfg.EfSearch = DefaultEfSearch
+	}
+
+	h := HNSW{
+		metric: metric,
+		cfg:    cfg,
+		ml:     1 / math.Log(float64(cfg.M)),
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+		ids:    make(map[string]int32),
+		entry:  -1,
+	}
+
+	return &h
+}
+
+// Metric returns the metric used by the index.
+func (h *HNSW) Metric() Metric {
+	return h.metric
+}
+
+// Config returns the tuning parameters of the index.
+func (h *HNSW) Config() HNSWConfig {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.cfg
+}
+
+// SetEfSearch changes the size of the candidate list used while searching.
+func (h *HNSW) SetEfSearch(ef int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ef > 0 {
+		h.cfg.EfSearch = ef
+	}
+}
+
+// Len returns the number of live items in the index.
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.ids)
+}
+
+// Add inserts a copy of the items into the index. No items are inserted if
+// any id already exists or any vector has the wrong dimension.
+func (h *HNSW) Add(items ...Item) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	dim := h.dim
+	seen := make(map[string]struct{}, len(items))
+
+	for _, item := range items {
+		if _, exists := h.ids[item.ID]; exists {
+			return fmt.Errorf("add %q: %w", item.ID, ErrExists)
+		}
+
+		if _, exists := seen[item.ID]; exists {
+			return fmt.Errorf("add %q: %w", item.ID, ErrExists)
+		}
+		seen[item.ID] = struct{}{}
+
+		if dim == 0 {
+			dim = len(item.Vector)
+		}
+
+		if len(item.Vector) != dim || dim == 0 {
+			return fmt.Errorf("add %q: %w", item.ID, ErrDimension)
+		}
+	}
+
+	h.dim = dim
+
+	for _, item := range items {
+		h.insert(item.clone())
+	}
+
+	return nil
+}
+
+// Update replaces the vector and metadata of an existing item. When only the
+// metadata changes the graph is left as is, otherwise the item is reinserted.
+func (h *HNSW) Update(item Item) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	idx, exists := h.ids[item.ID]
+	if !exists {
+		return fmt.Errorf("update %q: %w", item.ID, ErrNotFound)
+	}
+
+	if len(item.Vector) != h.dim {
+		return fmt.Errorf("update %q: %w", item.ID, ErrDimension)
+	}
+
+	n := h.nodes[idx]
+	if equalVectors(n.item.Vector, item.Vector) {
+		n.item.Metadata = item.Metadata
+		return nil
+	}
+
+	n.deleted = true
+	h.deleted++
+	delete(h.ids, item.ID)
+
+	h.insert(item.clone())
+
+	return nil
+}
+
+// Delete marks the items with the specified ids as deleted and returns the
+// number of items removed.
+func (h *HNSW) Delete(ids ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var n int
+	for _, id := range ids {
+		idx, exists := h.ids[id]
+		if !exists {
+			continue
+		}
+
+		h.nodes[idx].deleted = true
+		h.deleted++
+		delete(h.ids, id)
+		n++
+	}
+
+	return n
+}
+
+// Deleted returns the number of deleted items still held in the graph.
+func (h *HNSW) Deleted() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.deleted
+}
+
+// Compact rebuilds the graph from the live items, releasing the memory held
+// by deleted items.
+func (h *HNSW) Compact() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	nodes := h.nodes
+
+	h.nodes = nil
+	h.ids = make(map[string]int32, len(h.ids))
+	h.entry = -1
+	h.level = 0
+	h.deleted = 0
+
+	for _, n := range nodes {
+		if !n.deleted {
+			h.insert(n.item)
+		}
+	}
+
+	if len(h.nodes) == 0 {
+		h.dim = 0
+	}
+}
+
+// Get returns a copy of the item with the specified id.
+func (h *HNSW) Get(id string) (Item, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	idx, exists := h.ids[id]
+	if !exists {
+		return Item{}, false
+	}
+
+	return h.nodes[idx].item.clone(), true
+}
+
+// Search returns approximately the k items closest to the query, best match
+// first. The filter can be nil.
+func (h *HNSW) Search(query []float64, k int, filter Filter) ([]Result, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.ids) == 0 || k <= 0 {
+		return nil, nil
+	}
+
+	if len(query) != h.dim {
+		return nil, ErrDimension
+	}
+
+	qNorm := norm(query)
+	accept := func(n *hnswNode) bool {
+		return !n.deleted && (filter == nil || filter(n.item.Metadata))
+	}
+
+	ep := h.greedy(query, qNorm, h.entry, h.level, 1)
+
+	// With deletes or a selective filter the first pass can come back short,
+	// so the candidate list is widened until enough matches are found.
+	ef := max(h.cfg.EfSearch, k)
+	var cands []candidate
+	for {
+		cands = h.searchLayer(query, qNorm, []int32{ep}, ef, 0, accept)
+		if len(cands) >= k || ef >= len(h.nodes) {
+			break
+		}
+		ef *= 2
+	}
+
+	if len(cands) > k {
+		cands = cands[:k]
+	}
+
+	results := make([]Result, len(cands))
+	for i, c := range cands {
+		n := h.nodes[c.idx]
+		results[i] = Result{
+			ID:       n.item.ID,
+			Score:    externalScore(h.metric, c.sim),
+			Metadata: n.item.Metadata,
+		}
+	}
+
+	return results, nil
+}
+
+// =============================================================================
+
+func (h *HNSW) insert(item Item) {
+	idx := int32(len(h.nodes))
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) * h.ml))
+
+	n := hnswNode{
+		item:    item,
+		norm:    norm(item.Vector),
+		friends: make([][]int32, level+1),
+	}
+
+	h.nodes = append(h.nodes, &n)
+	h.ids[item.ID] = idx
+
+	if h.entry == -1 {
+		h.entry = idx
+		h.level = level
+		return
+	}
+
+	ep := h.greedy(item.Vector, n.norm, h.entry, h.level, level+1)
+	eps := []int32{ep}
+
+	for l := min(level, h.level); l >= 0; l-- {
+		cands := h.searchLayer(item.Vector, n.norm, eps, h.cfg.EfConstruction, l, nil)
+
+		n.friends[l] = h.selectNeighbors(cands, h.maxFriends(l))
+
+		for _, f := range n.friends[l] {
+			h.link(f, idx, l)
+		}
+
+		eps = eps[:0]
+		for _, c := range cands {
+			eps = append(eps, int32(c.idx))
+		}
+	}
+
+	if level > h.level {
+		h.entry = idx
+		h.level = level
+	}
+}
+
+// link adds a connection from node src to node dst on the specified layer,
+// pruning the connections of src when it has too many.
+func (h *HNSW) link(src int32, dst int32, layer int) {
+	s := h.nodes[src]
+	s.friends[layer] = append(s.friends[layer], dst)
+
+	maxF := h.maxFriends(layer)
+	if len(s.friends[layer]) <= maxF {
+		return
+	}
+
+	cands := make([]candidate, len(s.friends[layer]))
+	for i, f := range s.friends[layer] {
+		fn := h.nodes[f]
+		cands[i] = candidate{
+			idx: int(f),
+			sim: similarity(h.metric, s.item.Vector, s.norm, fn.item.Vector, fn.norm),
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].sim > cands[j].sim })
+
+	s.friends[layer] = h.selectNeighbors(cands, maxF)
+}
+
+func (h *HNSW) maxFriends(layer int) int {
+	if layer == 0 {
+		return 2 * h.cfg.M
+	}
+	return h.cfg.M
+}
+
+// selectNeighbors implements the neighbor selection heuristic from the HNSW
+// paper. A candidate is kept when it is closer to the base than to any
+// neighbor already selected, which keeps links spread across clusters. The
+// remaining slots are filled with the closest pruned candidates. The
+// candidates must be sorted best first.
+func (h *HNSW) selectNeighbors(cands []candidate, m int) []int32 {
+	selected := make([]int32, 0, m)
+	var pruned []int32
+
+	for _, c := range cands {
+		if len(selected) >= m {
+			break
+		}
+
+		cn := h.nodes[c.idx]
+		keep := true
+		for _, s := range selected {
+			sn := h.nodes[s]
+			if similarity(h.metric, cn.item.Vector, cn.norm, sn.item.Vector, sn.norm) > c.sim {
+				keep = false
+				break
+			}
+		}
+
+		switch keep {
+		case true:
+			selected = append(selected, int32(c.idx))
+		default:
+			pruned = append(pruned, int32(c.idx))
+		}
+	}
+
+	for _, p := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, p)
+	}
+
+	return selected
+}
+
+// greedy walks down from the top layer to the stop layer, moving to the
+// closest neighbor on each layer, and returns the node it ends at.
+func (h *HNSW) greedy(query []float64, qNorm float64, ep int32, top int, stop int) int32 {
+	en := h.nodes[ep]
+	best := similarity(h.metric, query, qNorm, en.item.Vector, en.norm)
+
+	for l := top; l >= stop; l-- {
+		for changed := true; changed; {
+			changed = false
+
+			for _, f := range h.nodes[ep].friends[l] {
+				fn := h.nodes[f]
+				if sim := similarity(h.metric, query, qNorm, fn.item.Vector, fn.norm); sim > best {
+					best = sim
+					ep = f
+					changed = true
+				}
+			}
+		}
+	}
+
+	return ep
+}
+
+// searchLayer performs a best first search of a single layer and returns up
+// to ef of the closest nodes the accept function allows, best first. When
+// accept is nil every node is allowed.
+func (h *HNSW) searchLayer(query []float64, qNorm float64, eps []int32, ef int, layer int, accept func(*hnswNode) bool) []candidate {
+	vl := h.visitedList()
+	defer h.visited.Put(vl)
+
+	explore := candHeap{max: true}
+	found := candHeap{}
+
+	for _, ep := range eps {
+		if vl.visit(ep) {
+			continue
+		}
+
+		n := h.nodes[ep]
+		c := candidate{idx: int(ep), sim: similarity(h.metric, query, qNorm, n.item.Vector, n.norm)}
+
+		heap.Push(&explore, c)
+		if accept == nil || accept(n) {
+			heap.Push(&found, c)
+		}
+	}
+
+	for explore.Len() > 0 {
+		c := heap.Pop(&explore).(candidate)
+
+		if found.Len() >= ef && c.sim < found.items[0].sim {
+			break
+		}
+
+		for _, f := range h.nodes[c.idx].friends[layer] {
+			if vl.visit(f) {
+				continue
+			}
+
+			fn := h.nodes[f]
+			sim := similarity(h.metric, query, qNorm, fn.item.Vector, fn.norm)
+
+			if found.Len() < ef || sim > found.items[0].sim {
+				heap.Push(&explore, candidate{idx: int(f), sim: sim})
+
+				if accept == nil || accept(fn) {
+					heap.Push(&found, candidate{idx: int(f), sim: sim})
+					if found.Len() > ef {
+						heap.Pop(&found)
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]candidate, found.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&found).(candidate)
+	}
+
+	return out
+}
+
+// =============================================================================
+
+// visitedList tracks the nodes seen during a search. Bumping the epoch
+// clears the list without touching the marks.
+type visitedList struct {
+	marks []uint32
+	epoch uint32
+}
+
+func (h *HNSW) visitedList() *visitedList {
+	vl, _ := h.visited.Get().(*visitedList)
+	if vl == nil {
+		vl = &visitedList{}
+	}
+
+	if len(vl.marks) < len(h.nodes) {
+		vl.marks = make([]uint32, len(h.nodes)+len(h.nodes)/4)
+		vl.epoch = 0
+	}
+
+	vl.epoch++
+	if vl.epoch == 0 {
+		clear(vl.marks)
+		vl.epoch = 1
+	}
+
+	return vl
+}
+
+// visit marks the node as visited and reports if it already was.
+func (vl *visitedList) visit(idx int32) bool {
+	if vl.marks[idx] == vl.epoch {
+		return true
+	}
+	vl.marks[idx] = vl.epoch
+	return false
+}
+
+// candHeap is a heap of candidates ordered by similarity. It's a min heap
+// unless max is set.
+type candHeap struct {
+	items []candidate
+	max   bool
+}
+
+func (c *candHeap) Len() int      { return len(c.items) }
+func (c *candHeap) Swap(i, j int) { c.items[i], c.items[j] = c.items[j], c.items[i] }
+func (c *candHeap) Push(x any)    { c.items = append(c.items, x.(candidate)) }
+
+func (c *candHeap) Less(i, j int) bool {
+	if c.max {
+		return c.items[i].sim > c.items[j].sim
+	}
+	return c.items[i].sim < c.items[j].sim
+}
+
+func (c *candHeap) Pop() any {
+	n := len(c.items)
+	item := c.items[n-1]
+	c.items = c.items[:n-1]
+	return item
+}
+
+func equalVectors(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
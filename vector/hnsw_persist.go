@@ -0,0 +1,383 @@
+package vector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// The HNSW file format is little endian and laid out as:
+//
+//	magic      [4]byte "PGVI"
+//	version    uint16
+//	metric     uint8 length, bytes
+//	m, efc, efs, dim  uint32
+//	seed       int64
+//	entry      int32
+//	level      uint32
+//	nodes      uint32 count, then per node:
+//	  deleted  uint8
+//	  id       uint32 length, bytes
+//	  metadata uint32 length, JSON bytes
+//	  vector   dim float64
+//	  layers   uint32 count, then per layer: uint32 count, int32 ids
+//	checksum   uint32 CRC32 (IEEE) of everything before it
+//
+// Metadata is stored as JSON, so numbers come back as float64 after a load.
+const (
+	hnswMagic   = "PGVI"
+	hnswVersion = 1
+)
+
+// ErrFormat is returned when loading data that isn't a valid index file.
+var ErrFormat = errors.New("invalid index format")
+
+// Save writes the index to w in a versioned binary format.
+func (h *HNSW) Save(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	enc := encoder{w: io.MultiWriter(bw, crc)}
+
+	enc.bytes([]byte(hnswMagic))
+	enc.u16(hnswVersion)
+	enc.str8(h.metric.String())
+	enc.u32(uint32(h.cfg.M))
+	enc.u32(uint32(h.cfg.EfConstruction))
+	enc.u32(uint32(h.cfg.EfSearch))
+	enc.u32(uint32(h.dim))
+	enc.i64(h.cfg.Seed)
+	enc.i32(h.entry)
+	enc.u32(uint32(h.level))
+	enc.u32(uint32(len(h.nodes)))
+
+	for _, n := range h.nodes {
+		var deleted uint8
+		if n.deleted {
+			deleted = 1
+		}
+		enc.u8(deleted)
+		enc.str32(n.item.ID)
+
+		var meta []byte
+		if n.item.Metadata != nil {
+			var err error
+			if meta, err = json.Marshal(n.item.Metadata); err != nil {
+				return fmt.Errorf("encoding metadata %q: %w", n.item.ID, err)
+			}
+		}
+		enc.u32(uint32(len(meta)))
+		enc.bytes(meta)
+
+		for _, v := range n.item.Vector {
+			enc.u64(math.Float64bits(v))
+		}
+
+		enc.u32(uint32(len(n.friends)))
+		for _, friends := range n.friends {
+			enc.u32(uint32(len(friends)))
+			for _, f := range friends {
+				enc.i32(f)
+			}
+		}
+	}
+
+	if enc.err != nil {
+		return fmt.Errorf("write: %w", enc.err)
+	}
+
+	if err := binary.Write(bw, binary.LittleEndian, crc.Sum32()); err != nil {
+		return fmt.Errorf("write checksum: %w", err)
+	}
+
+	return bw.Flush()
+}
+
+// SaveFile writes the index to the specified file. The data is written to a
+// temporary file first and renamed, so an existing file is never left
+// partially written.
+func (h *HNSW) SaveFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := h.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	return nil
+}
+
+// LoadHNSW reads an index written by Save.
+func LoadHNSW(r io.Reader) (*HNSW, error) {
+	crc := crc32.NewIEEE()
+	dec := decoder{r: io.TeeReader(bufio.NewReader(r), crc)}
+
+	if magic := dec.bytes(4); dec.err != nil || string(magic) != hnswMagic {
+		return nil, fmt.Errorf("magic: %w", ErrFormat)
+	}
+
+	if version := dec.u16(); dec.err == nil && version != hnswVersion {
+		return nil, fmt.Errorf("unsupported version %d: %w", version, ErrFormat)
+	}
+
+	metric, err := Metrics.Parse(dec.str8())
+	if dec.err == nil && err != nil {
+		return nil, fmt.Errorf("%w: %w", err, ErrFormat)
+	}
+
+	cfg := HNSWConfig{
+		M:              int(dec.u32()),
+		EfConstruction: int(dec.u32()),
+		EfSearch:       int(dec.u32()),
+	}
+	dim := int(dec.u32())
+	cfg.Seed = dec.i64()
+
+	if dim > 1<<20 {
+		return nil, fmt.Errorf("dimension %d: %w", dim, ErrFormat)
+	}
+
+	h := NewHNSW(metric, cfg)
+	h.dim = dim
+	h.entry = dec.i32()
+	h.level = int(dec.u32())
+
+	count := dec.u32()
+	if dec.err != nil {
+		return nil, fmt.Errorf("header: %w", dec.err)
+	}
+
+	h.nodes = make([]*hnswNode, 0, min(count, 1<<20))
+
+	for i := uint32(0); i < count && dec.err == nil; i++ {
+		var n hnswNode
+		n.deleted = dec.u8() == 1
+		n.item.ID = dec.str32()
+
+		if meta := dec.bytes(int(dec.u32())); len(meta) > 0 {
+			if err := json.Unmarshal(meta, &n.item.Metadata); err != nil {
+				return nil, fmt.Errorf("decoding metadata %q: %w", n.item.ID, err)
+			}
+		}
+
+		n.item.Vector = make([]float64, dim)
+		for j := range n.item.Vector {
+			n.item.Vector[j] = math.Float64frombits(dec.u64())
+		}
+		n.norm = norm(n.item.Vector)
+
+		layers := dec.u32()
+		if layers == 0 || layers > 64 {
+			return nil, fmt.Errorf("node %d layers: %w", i, ErrFormat)
+		}
+
+		n.friends = make([][]int32, layers)
+		for l := range n.friends {
+			size := dec.u32()
+			if size > 1<<16 {
+				return nil, fmt.Errorf("node %d links: %w", i, ErrFormat)
+			}
+
+			friends := make([]int32, size)
+			for j := range friends {
+				friends[j] = dec.i32()
+				if friends[j] < 0 || uint32(friends[j]) >= count {
+					return nil, fmt.Errorf("node %d link: %w", i, ErrFormat)
+				}
+			}
+			n.friends[l] = friends
+		}
+
+		switch n.deleted {
+		case true:
+			h.deleted++
+		default:
+			if _, exists := h.ids[n.item.ID]; exists {
+				return nil, fmt.Errorf("node %d duplicate id %q: %w", i, n.item.ID, ErrFormat)
+			}
+			h.ids[n.item.ID] = int32(i)
+		}
+
+		h.nodes = append(h.nodes, &n)
+	}
+
+	if dec.err != nil {
+		return nil, fmt.Errorf("nodes: %w", dec.err)
+	}
+
+	want := crc.Sum32()
+	var got uint32
+	if err := binary.Read(dec.r, binary.LittleEndian, &got); err != nil || got != want {
+		return nil, fmt.Errorf("checksum: %w", ErrFormat)
+	}
+
+	switch {
+	case count == 0:
+		if h.entry != -1 || h.level != 0 {
+			return nil, fmt.Errorf("entry point: %w", ErrFormat)
+		}
+
+	case h.entry < 0 || uint32(h.entry) >= count || len(h.nodes[h.entry].friends) != h.level+1:
+		return nil, fmt.Errorf("entry point: %w", ErrFormat)
+	}
+
+	// A search walks a link on layer l straight into that layer of the
+	// linked node, so every linked node must reach it.
+	for i, n := range h.nodes {
+		for l, friends := range n.friends {
+			for _, f := range friends {
+				if len(h.nodes[f].friends) <= l {
+					return nil, fmt.Errorf("node %d link to %d on layer %d: %w", i, f, l, ErrFormat)
+				}
+			}
+		}
+	}
+
+	// Continue the level assignment from a different point than the original
+	// run so reloaded indexes don't repeat the same levels.
+	h.rng = rand.New(rand.NewSource(cfg.Seed + int64(count)))
+
+	return h, nil
+}
+
+// LoadHNSWFile reads an index from the specified file.
+func LoadHNSWFile(path string) (*HNSW, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	return LoadHNSW(f)
+}
+
+// =============================================================================
+
+// encoder writes little endian values and remembers the first error so the
+// caller can check once at the end.
+type encoder struct {
+	w   io.Writer
+	buf [8]byte
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) u8(v uint8) {
+	e.buf[0] = v
+	e.bytes(e.buf[:1])
+}
+
+func (e *encoder) u16(v uint16) {
+	binary.LittleEndian.PutUint16(e.buf[:2], v)
+	e.bytes(e.buf[:2])
+}
+
+func (e *encoder) u32(v uint32) {
+	binary.LittleEndian.PutUint32(e.buf[:4], v)
+	e.bytes(e.buf[:4])
+}
+
+func (e *encoder) u64(v uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], v)
+	e.bytes(e.buf[:8])
+}
+
+func (e *encoder) i32(v int32) { e.u32(uint32(v)) }
+func (e *encoder) i64(v int64) { e.u64(uint64(v)) }
+
+func (e *encoder) str8(s string) {
+	e.u8(uint8(len(s)))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) str32(s string) {
+	e.u32(uint32(len(s)))
+	e.bytes([]byte(s))
+}
+
+// decoder reads little endian values and remembers the first error so the
+// caller can check once at the end.
+type decoder struct {
+	r   io.Reader
+	buf [8]byte
+	err error
+}
+
+// maxField bounds a single length prefixed field to protect against
+// corrupt input allocating huge buffers.
+const maxField = 64 << 20
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n == 0 {
+		return nil
+	}
+
+	if n < 0 || n > maxField {
+		d.err = ErrFormat
+		return nil
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = err
+		return nil
+	}
+
+	return b
+}
+
+func (d *decoder) fill(n int) []byte {
+	if d.err != nil {
+		clear(d.buf[:])
+		return d.buf[:n]
+	}
+
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		d.err = err
+		clear(d.buf[:])
+	}
+
+	return d.buf[:n]
+}
+
+func (d *decoder) u8() uint8   { return d.fill(1)[0] }
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.fill(2)) }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.fill(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.fill(8)) }
+func (d *decoder) i32() int32  { return int32(d.u32()) }
+func (d *decoder) i64() int64  { return int64(d.u64()) }
+
+func (d *decoder) str8() string  { return string(d.bytes(int(d.u8()))) }
+func (d *decoder) str32() string { return string(d.bytes(int(d.u32()))) }
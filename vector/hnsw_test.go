@@ -0,0 +1,380 @@
+package vector_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2/vector"
+)
+
+func Test_HNSWRecall(t *testing.T) {
+	items, queries := dataset(1000, 50, 16)
+
+	for _, metric := range []vector.Metric{vector.Metrics.Cosine, vector.Metrics.DotProduct, vector.Metrics.L2} {
+		f := func(t *testing.T) {
+			flat := vector.NewFlat(metric)
+			hnsw := vector.NewHNSW(metric, vector.HNSWConfig{Seed: 1})
+
+			if err := flat.Add(items...); err != nil {
+				t.Fatalf("Should be able to add to flat: %s", err)
+			}
+
+			if err := hnsw.Add(items...); err != nil {
+				t.Fatalf("Should be able to add to hnsw: %s", err)
+			}
+
+			if got := recall(t, flat, hnsw, queries, 10); got < 0.9 {
+				t.Fatalf("Should get a recall of at least 0.9, got %.3f", got)
+			}
+		}
+
+		t.Run(metric.String(), f)
+	}
+}
+
+func Test_HNSWDelete(t *testing.T) {
+	items, queries := dataset(600, 20, 16)
+
+	flat := vector.NewFlat(vector.Metrics.Cosine)
+	hnsw := vector.NewHNSW(vector.Metrics.Cosine, vector.HNSWConfig{Seed: 1})
+	flat.Add(items...)
+	hnsw.Add(items...)
+
+	var ids []string
+	for i := 0; i < len(items); i += 3 {
+		ids = append(ids, items[i].ID)
+	}
+
+	flat.Delete(ids...)
+	if n := hnsw.Delete(ids...); n != len(ids) {
+		t.Fatalf("Should delete %d items, got %d", len(ids), n)
+	}
+
+	if got := recall(t, flat, hnsw, queries, 10); got < 0.9 {
+		t.Fatalf("Should keep a recall of at least 0.9 after deletes, got %.3f", got)
+	}
+
+	if hnsw.Len() != flat.Len() || hnsw.Deleted() != len(ids) {
+		t.Fatalf("Should have %d live and %d deleted items, got %d and %d", flat.Len(), len(ids), hnsw.Len(), hnsw.Deleted())
+	}
+
+	hnsw.Compact()
+
+	if hnsw.Deleted() != 0 || hnsw.Len() != flat.Len() {
+		t.Fatalf("Should have no deleted items after compact")
+	}
+
+	if got := recall(t, flat, hnsw, queries, 10); got < 0.9 {
+		t.Fatalf("Should keep a recall of at least 0.9 after compact, got %.3f", got)
+	}
+
+	moved := vector.Item{ID: items[1].ID, Vector: queries[0], Metadata: map[string]any{"moved": true}}
+	if err := hnsw.Update(moved); err != nil {
+		t.Fatalf("Should be able to update: %s", err)
+	}
+
+	results, _ := hnsw.Search(queries[0], 1, vector.Match(map[string]any{"moved": true}))
+	if len(results) != 1 || results[0].ID != moved.ID {
+		t.Fatalf("Should find the moved item, got %v", results)
+	}
+
+	// The index keeps its own copy of the vectors.
+	queries[0][0]++
+
+	if got, _ := hnsw.Get(moved.ID); got.Vector[0] == queries[0][0] {
+		t.Fatalf("Should not share vectors with the caller")
+	}
+
+	if err := hnsw.Update(vector.Item{ID: "missing", Vector: queries[0]}); !errors.Is(err, vector.ErrNotFound) {
+		t.Fatalf("Should get ErrNotFound, got %v", err)
+	}
+}
+
+func Test_HNSWPersist(t *testing.T) {
+	items, queries := dataset(500, 10, 8)
+	items[0].Metadata = map[string]any{"source": "doc-1"}
+
+	hnsw := vector.NewHNSW(vector.Metrics.L2, vector.HNSWConfig{M: 8, Seed: 1})
+	hnsw.Add(items...)
+	hnsw.Delete(items[1].ID)
+
+	path := filepath.Join(t.TempDir(), "index.hnsw")
+	if err := hnsw.SaveFile(path); err != nil {
+		t.Fatalf("Should be able to save: %s", err)
+	}
+
+	loaded, err := vector.LoadHNSWFile(path)
+	if err != nil {
+		t.Fatalf("Should be able to load: %s", err)
+	}
+
+	if loaded.Len() != hnsw.Len() || loaded.Deleted() != 1 || loaded.Config().M != 8 {
+		t.Fatalf("Should load the same index state")
+	}
+
+	if item, _ := loaded.Get(items[0].ID); item.Metadata["source"] != "doc-1" {
+		t.Fatalf("Should load the metadata, got %v", item.Metadata)
+	}
+
+	for _, q := range queries {
+		exp, _ := hnsw.Search(q, 5, nil)
+		got, _ := loaded.Search(q, 5, nil)
+
+		for i := range exp {
+			if exp[i].ID != got[i].ID {
+				t.Fatalf("Should get the same results after a load, got %v, exp %v", got, exp)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	loaded.Save(&buf)
+
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+
+	if _, err := vector.LoadHNSW(bytes.NewReader(data)); err == nil {
+		t.Fatalf("Should fail to load corrupt data")
+	}
+}
+
+func Test_HNSWLoadInvalid(t *testing.T) {
+	valid := []fileNode{
+		{id: "a", layers: [][]int32{{1}, {1}}},
+		{id: "b", layers: [][]int32{{0}, {0}}},
+	}
+
+	tt := []struct {
+		Name  string
+		Entry int32
+		Level uint32
+		Nodes []fileNode
+		Valid bool
+	}{
+		{
+			Name:  "valid",
+			Entry: 0,
+			Level: 1,
+			Nodes: valid,
+			Valid: true,
+		},
+		{
+			Name:  "empty",
+			Entry: -1,
+			Level: 0,
+			Valid: true,
+		},
+		{
+			Name:  "empty-entry",
+			Entry: 5,
+			Level: 0,
+		},
+		{
+			Name:  "empty-level",
+			Entry: -1,
+			Level: 1,
+		},
+		{
+			Name:  "deleted-duplicate",
+			Entry: 0,
+			Level: 1,
+			Nodes: append(valid, fileNode{id: "a", deleted: true, layers: [][]int32{{0}}}),
+			Valid: true,
+		},
+		{
+			Name:  "duplicate-id",
+			Entry: 0,
+			Level: 1,
+			Nodes: append(valid, fileNode{id: "a", layers: [][]int32{{0}}}),
+		},
+		{
+			Name:  "no-layers",
+			Entry: 0,
+			Level: 1,
+			Nodes: append(valid, fileNode{id: "c"}),
+		},
+		{
+			Name:  "entry-level",
+			Entry: 0,
+			Level: 2,
+			Nodes: valid,
+		},
+		{
+			Name:  "link-layer",
+			Entry: 0,
+			Level: 1,
+			Nodes: []fileNode{
+				{id: "a", layers: [][]int32{{1}, {1}}},
+				{id: "b", layers: [][]int32{{0}}},
+			},
+		},
+	}
+
+	for _, test := range tt {
+		t.Run(test.Name, func(t *testing.T) {
+			data := hnswFile(test.Entry, test.Level, test.Nodes)
+
+			h, err := vector.LoadHNSW(bytes.NewReader(data))
+
+			switch test.Valid {
+			case true:
+				if err != nil {
+					t.Fatalf("Should be able to load: %s", err)
+				}
+
+				if _, err := h.Search([]float64{1, 0}, 2, nil); err != nil {
+					t.Fatalf("Should be able to search: %s", err)
+				}
+
+				if err := h.Add(vector.Item{ID: "z", Vector: []float64{1, 1}}); err != nil {
+					t.Fatalf("Should be able to add: %s", err)
+				}
+
+			default:
+				if !errors.Is(err, vector.ErrFormat) {
+					t.Fatalf("Should get ErrFormat, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+// =============================================================================
+
+func BenchmarkSearch(b *testing.B) {
+	items, queries := dataset(20000, 200, 64)
+
+	flat := vector.NewFlat(vector.Metrics.Cosine)
+	flat.Add(items...)
+
+	b.Run("flat", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			flat.Search(queries[i%len(queries)], 10, nil)
+		}
+	})
+
+	hnsw := vector.NewHNSW(vector.Metrics.Cosine, vector.HNSWConfig{Seed: 1})
+	hnsw.Add(items...)
+
+	for _, ef := range []int{16, 64, 256} {
+		b.Run(fmt.Sprintf("hnsw-ef%d", ef), func(b *testing.B) {
+			hnsw.SetEfSearch(ef)
+			r := recall(b, flat, hnsw, queries, 10)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				hnsw.Search(queries[i%len(queries)], 10, nil)
+			}
+
+			b.ReportMetric(r, "recall")
+		})
+	}
+}
+
+// =============================================================================
+
+func dataset(n int, q int, dim int) ([]vector.Item, [][]float64) {
+	rng := rand.New(rand.NewSource(42))
+
+	vec := func() []float64 {
+		v := make([]float64, dim)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+
+	items := make([]vector.Item, n)
+	for i := range items {
+		items[i] = vector.Item{ID: fmt.Sprintf("item-%d", i), Vector: vec()}
+	}
+
+	queries := make([][]float64, q)
+	for i := range queries {
+		queries[i] = vec()
+	}
+
+	return items, queries
+}
+
+type fileNode struct {
+	id      string
+	deleted bool
+	layers  [][]int32
+}
+
+// hnswFile encodes an L2 index of two dimensional vectors in the format
+// written by Save, so tests can describe graphs Save would never write.
+func hnswFile(entry int32, level uint32, nodes []fileNode) []byte {
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+
+	buf.WriteString("PGVI")
+	w(uint16(1))
+	w(uint8(len("l2")))
+	buf.WriteString("l2")
+	w([]uint32{8, 200, 64, 2})
+	w(int64(1))
+	w(entry)
+	w(level)
+	w(uint32(len(nodes)))
+
+	for i, n := range nodes {
+		var deleted uint8
+		if n.deleted {
+			deleted = 1
+		}
+		w(deleted)
+		w(uint32(len(n.id)))
+		buf.WriteString(n.id)
+		w(uint32(0))
+		w([]uint64{math.Float64bits(float64(i)), 0})
+
+		w(uint32(len(n.layers)))
+		for _, friends := range n.layers {
+			w(uint32(len(friends)))
+			w(friends)
+		}
+	}
+
+	w(crc32.ChecksumIEEE(buf.Bytes()))
+
+	return buf.Bytes()
+}
+
+func recall(tb testing.TB, exact vector.Index, approx vector.Index, queries [][]float64, k int) float64 {
+	var hits, total int
+
+	for _, q := range queries {
+		exp, err := exact.Search(q, k, nil)
+		if err != nil {
+			tb.Fatalf("Should be able to search exact: %s", err)
+		}
+
+		got, err := approx.Search(q, k, nil)
+		if err != nil {
+			tb.Fatalf("Should be able to search approx: %s", err)
+		}
+
+		ids := make(map[string]bool, len(got))
+		for _, r := range got {
+			ids[r.ID] = true
+		}
+
+		for _, r := range exp {
+			if ids[r.ID] {
+				hits++
+			}
+		}
+		total += len(exp)
+	}
+
+	return float64(hits) / float64(total)
+}
@@ -0,0 +1,156 @@
+package vector
+
+import (
+	"math"
+	"math/bits"
+)
+
+// ToFloat32 converts a vector to float32, halving its memory.
+func ToFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = float32(f)
+	}
+	return out
+}
+
+// ToFloat64 converts a vector to float64.
+func ToFloat64(v []float32) []float64 {
+	out := make([]float64, len(v))
+	for i, f := range v {
+		out[i] = float64(f)
+	}
+	return out
+}
+
+// Normalize scales the vector in place to unit length. After normalizing,
+// the dot product of two vectors equals their cosine similarity. A zero
+// vector is left unchanged.
+func Normalize(v []float64) {
+	n := norm(v)
+	if n == 0 {
+		return
+	}
+
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// Normalize32 scales the vector in place to unit length.
+func Normalize32(v []float32) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+
+	if sum == 0 {
+		return
+	}
+
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+}
+
+// =============================================================================
+
+// Int8Vector is a vector quantized to one byte per dimension using a single
+// symmetric scale, a quarter of the memory of float32.
+type Int8Vector struct {
+	Values []int8
+	Scale  float32
+}
+
+// QuantizeInt8 quantizes the vector by mapping the largest absolute value
+// to 127.
+func QuantizeInt8(v []float32) Int8Vector {
+	var maxAbs float32
+	for _, f := range v {
+		maxAbs = max(maxAbs, float32(math.Abs(float64(f))))
+	}
+
+	q := Int8Vector{
+		Values: make([]int8, len(v)),
+		Scale:  maxAbs / 127,
+	}
+
+	if maxAbs == 0 {
+		return q
+	}
+
+	inv := 127 / maxAbs
+	for i, f := range v {
+		q.Values[i] = int8(math.Round(float64(f * inv)))
+	}
+
+	return q
+}
+
+// Dequantize returns the approximate float32 vector.
+func (q Int8Vector) Dequantize() []float32 {
+	out := make([]float32, len(q.Values))
+	for i, v := range q.Values {
+		out[i] = float32(v) * q.Scale
+	}
+	return out
+}
+
+// DotInt8 returns the approximate dot product of two quantized vectors
+// using integer arithmetic.
+func DotInt8(a Int8Vector, b Int8Vector) float32 {
+	var sum int32
+	for i := range a.Values {
+		sum += int32(a.Values[i]) * int32(b.Values[i])
+	}
+	return float32(sum) * a.Scale * b.Scale
+}
+
+// =============================================================================
+
+// BinaryVector is a vector quantized to one bit per dimension holding the
+// sign of each value, a thirty second of the memory of float32. It's best
+// used to shortlist candidates that are then rescored with full vectors.
+type BinaryVector struct {
+	Bits []uint64
+	Dim  int
+}
+
+// QuantizeBinary sets a bit for every dimension greater than zero.
+func QuantizeBinary(v []float32) BinaryVector {
+	b := BinaryVector{
+		Bits: make([]uint64, (len(v)+63)/64),
+		Dim:  len(v),
+	}
+
+	for i, f := range v {
+		if f > 0 {
+			b.Bits[i/64] |= 1 << (i % 64)
+		}
+	}
+
+	return b
+}
+
+// Signs returns the vector as +1 and -1 values.
+func (b BinaryVector) Signs() []float32 {
+	out := make([]float32, b.Dim)
+	for i := range out {
+		out[i] = -1
+		if b.Bits[i/64]&(1<<(i%64)) != 0 {
+			out[i] = 1
+		}
+	}
+	return out
+}
+
+// Hamming returns the number of dimensions where the signs differ. Lower
+// means more similar.
+func Hamming(a BinaryVector, b BinaryVector) int {
+	var n int
+	for i := range a.Bits {
+		n += bits.OnesCount64(a.Bits[i] ^ b.Bits[i])
+	}
+	return n
+}
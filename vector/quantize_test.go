@@ -0,0 +1,194 @@
+package vector_test
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2/vector"
+)
+
+func Test_Normalize(t *testing.T) {
+	v := []float64{3, 4}
+	vector.Normalize(v)
+
+	if v[0] != 0.6 || v[1] != 0.8 {
+		t.Fatalf("Should get a unit vector, got %v", v)
+	}
+
+	v32 := vector.ToFloat32([]float64{3, 4})
+	vector.Normalize32(v32)
+
+	if math.Abs(float64(v32[0])-0.6) > 1e-6 || math.Abs(float64(v32[1])-0.8) > 1e-6 {
+		t.Fatalf("Should get a unit float32 vector, got %v", v32)
+	}
+
+	zero := []float64{0, 0}
+	vector.Normalize(zero)
+
+	if zero[0] != 0 || zero[1] != 0 {
+		t.Fatalf("Should leave a zero vector alone, got %v", zero)
+	}
+}
+
+func Test_QuantizeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	v := randomUnit(rng, 1024)
+
+	q := vector.QuantizeInt8(v)
+	back := q.Dequantize()
+
+	for i := range v {
+		if diff := math.Abs(float64(v[i] - back[i])); diff > float64(q.Scale)/2+1e-7 {
+			t.Fatalf("Should reconstruct within half a step at %d, got a diff of %g with step %g", i, diff, q.Scale)
+		}
+	}
+
+	b := vector.QuantizeBinary(v)
+	signs := b.Signs()
+
+	for i := range v {
+		if (v[i] > 0) != (signs[i] > 0) {
+			t.Fatalf("Should keep the sign at %d", i)
+		}
+	}
+
+	if vector.Hamming(b, b) != 0 {
+		t.Fatalf("Should get a zero distance to itself")
+	}
+
+	inv := make([]float32, len(v))
+	for i := range v {
+		inv[i] = -v[i]
+		if v[i] == 0 {
+			inv[i] = 1
+		}
+	}
+
+	if d := vector.Hamming(b, vector.QuantizeBinary(inv)); d != len(v) {
+		t.Fatalf("Should get a distance of %d to the inverse, got %d", len(v), d)
+	}
+}
+
+// Test_QuantizeAccuracy measures how well the compact representations keep
+// the ranking of exact search. Int8 is used directly, binary is used to
+// shortlist 100 candidates that are rescored with the float vectors.
+func Test_QuantizeAccuracy(t *testing.T) {
+	const (
+		n   = 2000
+		dim = 256
+		k   = 10
+	)
+
+	rng := rand.New(rand.NewSource(7))
+
+	// Clustered data is closer to real embeddings than uniform noise.
+	centers := make([][]float32, 20)
+	for i := range centers {
+		centers[i] = randomUnit(rng, dim)
+	}
+
+	data := make([][]float32, n)
+	for i := range data {
+		data[i] = jitter(rng, centers[i%len(centers)], 0.5)
+	}
+
+	i8 := make([]vector.Int8Vector, n)
+	bin := make([]vector.BinaryVector, n)
+	for i, v := range data {
+		i8[i] = vector.QuantizeInt8(v)
+		bin[i] = vector.QuantizeBinary(v)
+	}
+
+	var i8Recall, binRecall float64
+	const queries = 50
+
+	for range queries {
+		q := jitter(rng, centers[rng.Intn(len(centers))], 0.5)
+		qi8 := vector.QuantizeInt8(q)
+		qbin := vector.QuantizeBinary(q)
+
+		exact := topIdx(n, k, func(i int) float64 { return float64(dot32(q, data[i])) })
+		approx := topIdx(n, k, func(i int) float64 { return float64(vector.DotInt8(qi8, i8[i])) })
+
+		short := topIdx(n, 100, func(i int) float64 { return -float64(vector.Hamming(qbin, bin[i])) })
+		rescored := topIdx(len(short), k, func(i int) float64 { return float64(dot32(q, data[short[i]])) })
+		for i := range rescored {
+			rescored[i] = short[rescored[i]]
+		}
+
+		i8Recall += overlap(exact, approx)
+		binRecall += overlap(exact, rescored)
+	}
+
+	i8Recall /= queries
+	binRecall /= queries
+
+	t.Logf("int8 recall@%d: %.3f, binary+rescore recall@%d: %.3f", k, i8Recall, k, binRecall)
+
+	if i8Recall < 0.9 {
+		t.Fatalf("Should get an int8 recall of at least 0.9, got %.3f", i8Recall)
+	}
+
+	if binRecall < 0.8 {
+		t.Fatalf("Should get a binary recall of at least 0.8, got %.3f", binRecall)
+	}
+}
+
+// =============================================================================
+
+func randomUnit(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	vector.Normalize32(v)
+	return v
+}
+
+func jitter(rng *rand.Rand, center []float32, amount float64) []float32 {
+	v := make([]float32, len(center))
+	for i := range v {
+		v[i] = center[i] + float32(rng.NormFloat64()*amount/math.Sqrt(float64(len(center))))
+	}
+	vector.Normalize32(v)
+	return v
+}
+
+func dot32(a []float32, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func topIdx(n int, k int, score func(i int) float64) []int {
+	idx := make([]int, n)
+	scores := make([]float64, n)
+	for i := range idx {
+		idx[i] = i
+		scores[i] = score(i)
+	}
+
+	sort.SliceStable(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+
+	return idx[:min(k, n)]
+}
+
+func overlap(exp []int, got []int) float64 {
+	set := make(map[int]bool, len(got))
+	for _, i := range got {
+		set[i] = true
+	}
+
+	var hits int
+	for _, i := range exp {
+		if set[i] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(len(exp))
+}
@@ -0,0 +1,201 @@
+// Package vector provides in-memory indexes for searching the embeddings
+// returned by the Prediction Guard embeddings endpoint.
+package vector
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+
+	"github.com/predictionguard/go-client/v2"
+)
+
+// Set of errors returned by the indexes.
+var (
+	ErrExists    = errors.New("id already exists")
+	ErrNotFound  = errors.New("id not found")
+	ErrDimension = errors.New("vector dimension mismatch")
+)
+
+// Index represents the behavior of the vector indexes in this package.
+type Index interface {
+	Add(items ...Item) error
+	Update(item Item) error
+	Delete(ids ...string) int
+	Get(id string) (Item, bool)
+	Len() int
+	Search(query []float64, k int, filter Filter) ([]Result, error)
+}
+
+// Compile time checks that the indexes implement Index.
+var (
+	_ Index = (*Flat)(nil)
+	_ Index = (*HNSW)(nil)
+)
+
+// Item represents a vector stored in an index.
+type Item struct {
+	ID       string
+	Vector   []float64
+	Metadata map[string]any
+}
+
+// clone returns a copy of the item that does not share the vector with the
+// caller, so the stored vector and its norm can't go out of sync.
+func (item Item) clone() Item {
+	item.Vector = slices.Clone(item.Vector)
+	return item
+}
+
+// Result represents a single search match. For Cosine and DotProduct the
+// score is the similarity and higher is better. For L2 the score is the
+// euclidean distance and lower is better.
+type Result struct {
+	ID       string
+	Score    float64
+	Metadata map[string]any
+}
+
+// Filter restricts a search to the items whose metadata it accepts.
+type Filter func(metadata map[string]any) bool
+
+// Match returns a filter that accepts items whose metadata contains every
+// key and value in the specified set. Values are compared with
+// reflect.DeepEqual, so slices and maps can be matched.
+func Match(values map[string]any) Filter {
+	return func(metadata map[string]any) bool {
+		for k, v := range values {
+			if mv, exists := metadata[k]; !exists || !reflect.DeepEqual(mv, v) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FromEmbedding constructs the items for an embeddings response. The ids and
+// metadata are matched to the response data using EmbeddingData.Index, so
+// they must be in the same order as the inputs of the request. The metadata
+// can be nil.
+func FromEmbedding(resp client.Embedding, ids []string, metadata []map[string]any) ([]Item, error) {
+	items := make([]Item, len(resp.Data))
+
+	for i, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(ids) {
+			return nil, fmt.Errorf("embedding index %d has no id", data.Index)
+		}
+
+		item := Item{
+			ID:     ids[data.Index],
+			Vector: data.Embedding,
+		}
+
+		if data.Index < len(metadata) {
+			item.Metadata = metadata[data.Index]
+		}
+
+		items[i] = item
+	}
+
+	return items, nil
+}
+
+// =============================================================================
+
+func dot(a []float64, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func norm(a []float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+func l2(a []float64, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// similarity returns a score where higher is always better, so the search
+// code doesn't need to know which metric is in use. The norms are passed in
+// so they can be calculated once per vector.
+func similarity(metric Metric, a []float64, aNorm float64, b []float64, bNorm float64) float64 {
+	switch metric {
+	case Metrics.DotProduct:
+		return dot(a, b)
+
+	case Metrics.L2:
+		return -l2(a, b)
+
+	default:
+		if aNorm == 0 || bNorm == 0 {
+			return 0
+		}
+		return dot(a, b) / (aNorm * bNorm)
+	}
+}
+
+// externalScore converts an internal similarity into the score reported
+// in a Result.
+func externalScore(metric Metric, sim float64) float64 {
+	if metric == Metrics.L2 {
+		return -sim
+	}
+	return sim
+}
+
+// =============================================================================
+
+type candidate struct {
+	idx int
+	sim float64
+}
+
+// topK keeps the k best candidates seen using a min heap, so the worst of
+// the current best is always at the root.
+type topK struct {
+	k     int
+	items []candidate
+}
+
+func (t *topK) Len() int           { return len(t.items) }
+func (t *topK) Less(i, j int) bool { return t.items[i].sim < t.items[j].sim }
+func (t *topK) Swap(i, j int)      { t.items[i], t.items[j] = t.items[j], t.items[i] }
+func (t *topK) Push(x any)         { t.items = append(t.items, x.(candidate)) }
+
+func (t *topK) Pop() any {
+	n := len(t.items)
+	c := t.items[n-1]
+	t.items = t.items[:n-1]
+	return c
+}
+
+func (t *topK) offer(c candidate) {
+	switch {
+	case len(t.items) < t.k:
+		heap.Push(t, c)
+
+	case c.sim > t.items[0].sim:
+		t.items[0] = c
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted drains the heap returning the candidates from best to worst.
+func (t *topK) sorted() []candidate {
+	out := make([]candidate, len(t.items))
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(t).(candidate)
+	}
+	return out
+}
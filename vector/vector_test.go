@@ -0,0 +1,143 @@
+package vector_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/predictionguard/go-client/v2"
+	"github.com/predictionguard/go-client/v2/vector"
+)
+
+func Test_Flat(t *testing.T) {
+	items := []vector.Item{
+		{ID: "a", Vector: []float64{1, 0}, Metadata: map[string]any{"lang": "en", "tags": []string{"x"}}},
+		{ID: "b", Vector: []float64{0, 1}, Metadata: map[string]any{"lang": "es", "tags": []string{"x", "y"}}},
+		{ID: "c", Vector: []float64{2, 2}, Metadata: map[string]any{"lang": "en"}},
+	}
+
+	table := []struct {
+		Name   string
+		Metric vector.Metric
+		Query  []float64
+		Filter vector.Filter
+		ExpIDs []string
+	}{
+		{"cosine", vector.Metrics.Cosine, []float64{1, 0.1}, nil, []string{"a", "c", "b"}},
+		{"dot", vector.Metrics.DotProduct, []float64{1, 0.1}, nil, []string{"c", "a", "b"}},
+		{"l2", vector.Metrics.L2, []float64{0, 0.9}, nil, []string{"b", "a", "c"}},
+		{"filter", vector.Metrics.Cosine, []float64{0, 1}, vector.Match(map[string]any{"lang": "en"}), []string{"c", "a"}},
+		{"filter-slice", vector.Metrics.Cosine, []float64{0, 1}, vector.Match(map[string]any{"tags": []string{"x", "y"}}), []string{"b"}},
+	}
+
+	for _, tt := range table {
+		f := func(t *testing.T) {
+			idx := vector.NewFlat(tt.Metric)
+			if err := idx.Add(items...); err != nil {
+				t.Fatalf("Should be able to add items: %s", err)
+			}
+
+			results, err := idx.Search(tt.Query, 3, tt.Filter)
+			if err != nil {
+				t.Fatalf("Should be able to search: %s", err)
+			}
+
+			if len(results) != len(tt.ExpIDs) {
+				t.Fatalf("Should get %d results, got %d", len(tt.ExpIDs), len(results))
+			}
+
+			for i, id := range tt.ExpIDs {
+				if results[i].ID != id {
+					t.Fatalf("Should get %q at position %d, got %q", id, i, results[i].ID)
+				}
+			}
+		}
+
+		t.Run(tt.Name, f)
+	}
+}
+
+func Test_FlatMutations(t *testing.T) {
+	idx := vector.NewFlat(vector.Metrics.Cosine)
+
+	resp := client.Embedding{
+		Data: []client.EmbeddingData{
+			{Index: 1, Embedding: []float64{0, 1}},
+			{Index: 0, Embedding: []float64{1, 0}},
+		},
+	}
+
+	items, err := vector.FromEmbedding(resp, []string{"x", "y"}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to build items: %s", err)
+	}
+
+	if err := idx.Add(items...); err != nil {
+		t.Fatalf("Should be able to add items: %s", err)
+	}
+
+	if got, _ := idx.Get("x"); got.Vector[0] != 1 {
+		t.Fatalf("Should map ids using the embedding index, got %v", got.Vector)
+	}
+
+	if err := idx.Add(vector.Item{ID: "x", Vector: []float64{1, 1}}); !errors.Is(err, vector.ErrExists) {
+		t.Fatalf("Should get ErrExists, got %v", err)
+	}
+
+	if err := idx.Add(vector.Item{ID: "z", Vector: []float64{1}}); !errors.Is(err, vector.ErrDimension) {
+		t.Fatalf("Should get ErrDimension, got %v", err)
+	}
+
+	if err := idx.Update(vector.Item{ID: "x", Vector: []float64{0, 1}}); err != nil {
+		t.Fatalf("Should be able to update: %s", err)
+	}
+
+	// The index keeps its own copy of the vectors.
+	items[0].Vector[0] = 5
+
+	got, _ := idx.Get("y")
+	got.Vector[0] = 5
+
+	if got, _ := idx.Get("y"); got.Vector[0] != 0 {
+		t.Fatalf("Should not share vectors with the caller, got %v", got.Vector)
+	}
+
+	if n := idx.Delete("y", "missing"); n != 1 {
+		t.Fatalf("Should delete 1 item, got %d", n)
+	}
+
+	results, _ := idx.Search([]float64{0, 1}, 5, nil)
+	if len(results) != 1 || results[0].ID != "x" || results[0].Score < 0.99 {
+		t.Fatalf("Should find the updated item, got %v", results)
+	}
+}
+
+func Test_FlatConcurrent(t *testing.T) {
+	idx := vector.NewFlat(vector.Metrics.L2)
+
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				idx.Add(vector.Item{ID: fmt.Sprintf("%d-%d", g, i), Vector: []float64{rand.Float64(), rand.Float64()}})
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				idx.Search([]float64{0.5, 0.5}, 5, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if idx.Len() != 400 {
+		t.Fatalf("Should have 400 items, got %d", idx.Len())
+	}
+}